@@ -0,0 +1,389 @@
+// Package asm assembles CHIP-8, SUPER-CHIP and XO-CHIP programs.
+//
+// The mnemonics are the ones printed by the instruction handlers and the
+// disasm package. A line holds an optional label and a statement:
+//
+//	; comment
+//	loop:	LD V0, 0x05		; numbers: 5, 05, 0x05, #05, $05, 0b101, 'a'
+//		JP loop
+//	WIDTH equ 64			; or WIDTH = 64
+//		org 0x300
+//	data:	db 0xFF, 0x81, "text"
+//		dw 0x1234, data + 2
+//		include "sprites.8s"
+package asm
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/ministergoose/chip8-emu-go/chip8"
+	"github.com/ministergoose/chip8-emu-go/chip8/srcmap"
+)
+
+const MAX_INCLUDE_DEPTH = 16
+
+// Line is an assembled source line.
+type Line struct {
+	Addr   uint16
+	File   string
+	Line   int
+	Bytes  []byte
+	Source string
+}
+
+type Result struct {
+	Start  uint16
+	ROM    []byte // from Start to the last assembled byte
+	Lines  []Line
+	Labels map[string]uint16
+}
+
+// ReadFileFunc reads included files.
+type ReadFileFunc func(path string) ([]byte, error)
+
+type stmt struct {
+	file   string
+	line   int
+	source string
+	addr   uint16
+	op     string   // lower case mnemonic or directive
+	args   []string // raw operands
+	size   int
+}
+
+type assembler struct {
+	readFile  ReadFileFunc
+	stmts     []*stmt
+	labels    map[string]uint16
+	consts    map[string]string // name -> expression
+	constPos  map[string]*stmt
+	resolving map[string]bool
+	addr      int
+	start     int
+}
+
+func newAssembler(readFile ReadFileFunc) *assembler {
+	return &assembler{
+		readFile:  readFile,
+		labels:    map[string]uint16{},
+		consts:    map[string]string{},
+		constPos:  map[string]*stmt{},
+		resolving: map[string]bool{},
+		addr:      int(chip8.START_ADDR),
+		start:     -1,
+	}
+}
+
+// Assemble assembles src, name is used for the messages and the listing.
+// Included files are read from the file system relative to name.
+func Assemble(name string, src []byte) (*Result, error) {
+	return AssembleWith(name, src, os.ReadFile)
+}
+
+func AssembleWith(name string, src []byte, readFile ReadFileFunc) (*Result, error) {
+	a := newAssembler(readFile)
+	err := a.parse(name, src, 0)
+	if err != nil {
+		return nil, err
+	}
+	return a.emit()
+}
+
+func AssembleFile(filePath string) (*Result, error) {
+	src, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, err
+	}
+	return Assemble(filePath, src)
+}
+
+func errorf(s *stmt, format string, args ...interface{}) error {
+	return fmt.Errorf("%s:%d: %s", s.file, s.line, fmt.Sprintf(format, args...))
+}
+
+// stripComment removes a ; comment outside of quotes.
+func stripComment(line string) string {
+	quote := byte(0)
+	for i := 0; i < len(line); i++ {
+		switch c := line[i]; {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == ';':
+			return line[:i]
+		}
+	}
+	return line
+}
+
+// splitArgs splits operands at commas outside of quotes.
+func splitArgs(s string) []string {
+	var args []string
+	quote := byte(0)
+	last := 0
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == ',':
+			args = append(args, strings.TrimSpace(s[last:i]))
+			last = i + 1
+		}
+	}
+	if strings.TrimSpace(s) != "" {
+		args = append(args, strings.TrimSpace(s[last:]))
+	}
+	return args
+}
+
+func isIdent(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i, c := range s {
+		if !(c == '_' || c == '.' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (i > 0 && c >= '0' && c <= '9')) {
+			return false
+		}
+	}
+	return true
+}
+
+// parse is the first pass, it assigns the addresses of the statements and labels.
+func (a *assembler) parse(name string, src []byte, depth int) error {
+	lines := strings.Split(strings.ReplaceAll(string(src), "\r\n", "\n"), "\n")
+	for n, text := range lines {
+		s := &stmt{file: name, line: n + 1, source: strings.TrimRight(text, " \t")}
+		body := strings.TrimSpace(stripComment(text))
+
+		// label:
+		if i := strings.Index(body, ":"); i > 0 && isIdent(body[:i]) {
+			label := body[:i]
+			err := a.define(s, label)
+			if err != nil {
+				return err
+			}
+			a.labels[label] = uint16(a.addr)
+			body = strings.TrimSpace(body[i+1:])
+		}
+		if body == "" {
+			continue
+		}
+
+		fields := strings.Fields(body)
+		// name equ value, name = value
+		if len(fields) >= 3 && (strings.ToLower(fields[1]) == "equ" || fields[1] == "=") {
+			if !isIdent(fields[0]) {
+				return errorf(s, "bad constant name: %s", fields[0])
+			}
+			err := a.define(s, fields[0])
+			if err != nil {
+				return err
+			}
+			i := strings.Index(body, fields[1]) + len(fields[1])
+			a.consts[fields[0]] = strings.TrimSpace(body[i:])
+			a.constPos[fields[0]] = s
+			continue
+		}
+
+		s.op = strings.ToLower(fields[0])
+		s.args = splitArgs(strings.TrimSpace(body[len(fields[0]):]))
+		s.addr = uint16(a.addr)
+
+		switch s.op {
+		case "org":
+			if len(s.args) != 1 {
+				return errorf(s, "org needs an address")
+			}
+			v, err := a.eval(s, s.args[0])
+			if err != nil {
+				return err
+			}
+			if v < int(chip8.START_ADDR) || v > 0xffff {
+				return errorf(s, "org out of range: 0x%X", v)
+			}
+			a.addr = v
+			continue
+		case "include":
+			if len(s.args) != 1 {
+				return errorf(s, "include needs a file name")
+			}
+			if depth >= MAX_INCLUDE_DEPTH {
+				return errorf(s, "includes nested too deep")
+			}
+			path := strings.Trim(s.args[0], "\"")
+			if !filepath.IsAbs(path) {
+				path = filepath.Join(filepath.Dir(name), path)
+			}
+			data, err := a.readFile(path)
+			if err != nil {
+				return errorf(s, "%v", err)
+			}
+			err = a.parse(path, data, depth+1)
+			if err != nil {
+				return err
+			}
+			continue
+		case "db":
+			size := 0
+			for _, arg := range s.args {
+				if str, ok := stringLit(arg); ok {
+					size += len(str)
+				} else {
+					size++
+				}
+			}
+			s.size = size
+		case "dw":
+			s.size = 2 * len(s.args)
+		default:
+			s.size = 2
+			if s.op == "ld" && len(s.args) == 2 && strings.HasPrefix(strings.ToLower(s.args[1]), "long ") {
+				s.size = 4
+			}
+		}
+
+		// the ROM starts at the first statement, 0x200 unless an org comes first
+		if a.start < 0 {
+			a.start = a.addr
+		}
+		if a.addr < a.start {
+			return errorf(s, "address 0x%X is below the start of the ROM 0x%X", a.addr, a.start)
+		}
+		a.addr += s.size
+		if a.addr > 0x10000 {
+			return errorf(s, "program doesn't fit in memory")
+		}
+		a.stmts = append(a.stmts, s)
+	}
+
+	return nil
+}
+
+func (a *assembler) define(s *stmt, name string) error {
+	_, label := a.labels[name]
+	_, konst := a.consts[name]
+	if label || konst {
+		return errorf(s, "%s redefined", name)
+	}
+	return nil
+}
+
+// emit is the second pass, it encodes the statements.
+func (a *assembler) emit() (*Result, error) {
+	res := &Result{Start: chip8.START_ADDR, Labels: a.labels}
+	if a.start >= 0 {
+		res.Start = uint16(a.start)
+	}
+
+	var rom []byte
+	for _, s := range a.stmts {
+		code, err := a.encode(s)
+		if err != nil {
+			return nil, err
+		}
+
+		off := int(s.addr) - int(res.Start)
+		if need := off + len(code); need > len(rom) {
+			rom = append(rom, make([]byte, need-len(rom))...)
+		}
+		copy(rom[off:], code)
+		res.Lines = append(res.Lines, Line{Addr: s.addr, File: s.file, Line: s.line, Bytes: code, Source: s.source})
+	}
+	res.ROM = rom
+
+	return res, nil
+}
+
+func stringLit(s string) (string, bool) {
+	if len(s) >= 2 && s[0] == '"' && s[len(s)-1] == '"' {
+		return s[1 : len(s)-1], true
+	}
+	return "", false
+}
+
+func (a *assembler) encode(s *stmt) ([]byte, error) {
+	switch s.op {
+	case "db":
+		var code []byte
+		for _, arg := range s.args {
+			if str, ok := stringLit(arg); ok {
+				code = append(code, str...)
+				continue
+			}
+			v, err := a.evalRange(s, arg, -128, 0xff)
+			if err != nil {
+				return nil, err
+			}
+			code = append(code, byte(v))
+		}
+		return code, nil
+	case "dw":
+		var code []byte
+		for _, arg := range s.args {
+			v, err := a.evalRange(s, arg, -0x8000, 0xffff)
+			if err != nil {
+				return nil, err
+			}
+			code = append(code, byte(v>>8), byte(v))
+		}
+		return code, nil
+	}
+
+	return a.encodeInst(s)
+}
+
+// WriteListing writes the listing, its lines start with "ADDR file:line" so
+// it can be used as a source map by the debug adapter.
+func (r *Result) WriteListing(w io.Writer) error {
+	var buf bytes.Buffer
+	for _, l := range r.Lines {
+		hex := ""
+		for i, b := range l.Bytes {
+			if i == 4 {
+				hex += "+"
+				break
+			}
+			hex += fmt.Sprintf("%02X", b)
+		}
+		fmt.Fprintf(&buf, "%04X %s:%d\t%-9s\t%s\n", l.Addr, l.File, l.Line, hex, l.Source)
+	}
+
+	names := make([]string, 0, len(r.Labels))
+	for name := range r.Labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(&buf, "@%s %04X\n", name, r.Labels[name])
+	}
+
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+// SourceMap returns the addresses of the code and data lines.
+func (r *Result) SourceMap() *srcmap.SourceMap {
+	m := srcmap.New()
+	for _, l := range r.Lines {
+		if len(l.Bytes) > 0 {
+			m.AddLine(l.Addr, l.File, l.Line)
+		}
+	}
+	for name, addr := range r.Labels {
+		m.AddLabel(name, addr)
+	}
+	return m
+}
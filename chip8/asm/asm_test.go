@@ -0,0 +1,225 @@
+package asm
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ministergoose/chip8-emu-go/chip8"
+	"github.com/ministergoose/chip8-emu-go/chip8/octo"
+)
+
+const RANDOM_ROMS = 300
+
+var PLATFORMS []chip8.Platform = []chip8.Platform{chip8.PLATFORM_CHIP8, chip8.PLATFORM_SCHIP, chip8.PLATFORM_XOCHIP}
+
+func TestInstructions(t *testing.T) {
+	for src, want := range map[string]string{
+		"CLS":                  "00e0",
+		"RET":                  "00ee",
+		"SCD 4":                "00c4",
+		"SCU 4":                "00d4",
+		"SCR":                  "00fb",
+		"EXIT":                 "00fd",
+		"HIGH":                 "00ff",
+		"SYS 0x123":            "0123",
+		"JP 0x208":             "1208",
+		"JP V0, 0x300":         "b300",
+		"JP V3, 0x310":         "b310",
+		"CALL 0x400":           "2400",
+		"SE V1, 0x20":          "3120",
+		"SE V1, V2":            "5120",
+		"SNE V1, -1":           "41ff",
+		"SNE V1, V2":           "9120",
+		"LD V0, 5":             "6005",
+		"LD V0, 05":            "6005",
+		"LD V0, #05":           "6005",
+		"LD V0, $05":           "6005",
+		"LD V0, 0b101":         "6005",
+		"LD V0, 'a'":           "6061",
+		"ld va, vb":            "8ab0",
+		"LD I, 0x300":          "a300",
+		"LD I, long 0x1234":    "f0001234",
+		"LD V2, DT":            "f207",
+		"LD V2, K":             "f20a",
+		"LD DT, V2":            "f215",
+		"LD ST, V2":            "f218",
+		"LD F, V2":             "f229",
+		"LD HF, V2":            "f230",
+		"LD B, V2":             "f233",
+		"LD [I], V2":           "f255",
+		"LD V2, [I]":           "f265",
+		"LD R, V2":             "f275",
+		"LD V2, R":             "f285",
+		"LD [I], V1-V3":        "5132",
+		"LD V3-V1, [I]":        "5313",
+		"ADD V1, 1":            "7101",
+		"ADD V1, V2":           "8124",
+		"ADD I, V2":            "f21e",
+		"OR V1, V2":            "8121",
+		"AND V1, V2":           "8122",
+		"XOR V1, V2":           "8123",
+		"SUB V1, V2":           "8125",
+		"SUBN V1, V2":          "8127",
+		"SHR V1":               "8116",
+		"SHR V1, V2":           "8126",
+		"SHL V1":               "811e",
+		"RND V1, 0xFF":         "c1ff",
+		"DRW V1, V2, 5":        "d125",
+		"SKP V5":               "e59e",
+		"SKNP V5":              "e5a1",
+		"SKPN V5":              "e5a1",
+		"PLANE 3":              "f301",
+		"AUDIO":                "f002",
+		"PITCH V4":             "f43a",
+		"LD V0, 1 + 7 - 2":     "6006",
+		"db 1, 0x81, \"ab\"":   "01816162",
+		"dw 0x1234, 0x200 + 2": "12340202",
+	} {
+		res, err := Assemble("test.8s", []byte(src))
+		if err != nil {
+			t.Errorf("%s: %v", src, err)
+			continue
+		}
+		if got := hex.EncodeToString(res.ROM); got != strings.Replace(want, " ", "", -1) {
+			t.Errorf("%s: got %s, want %s", src, got, want)
+		}
+	}
+}
+
+const PROGRAM = `; the example of the package documentation
+loop:	LD V0, 0x05
+	JP loop
+WIDTH equ 64
+HEIGHT = WIDTH - 32
+	org 0x300
+data:	db 0xFF, 0x81, "text"	; a comment; with "quotes"
+	dw 0x1234, data + 2
+	include "sprites.8s"
+	LD V1, HEIGHT
+`
+
+func TestAssemble(t *testing.T) {
+	files := map[string]string{filepath.Join("src", "sprites.8s"): "sprite:\tdb 0x3C, 0x42\n"}
+	readFile := func(path string) ([]byte, error) {
+		src, ok := files[path]
+		if !ok {
+			return nil, fmt.Errorf("%s not found", path)
+		}
+		return []byte(src), nil
+	}
+
+	res, err := AssembleWith(filepath.Join("src", "game.8s"), []byte(PROGRAM), readFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Start != 0x200 || len(res.ROM) != 0x10E {
+		t.Fatalf("%d bytes from 0x%X", len(res.ROM), res.Start)
+	}
+	if got := hex.EncodeToString(res.ROM[:4]); got != "60051200" {
+		t.Errorf("code is %s", got)
+	}
+	if got, want := hex.EncodeToString(res.ROM[0x100:]), "ff8174657874123403023c426120"; got != want {
+		t.Errorf("data is %s, want %s", got, want)
+	}
+	for label, addr := range map[string]uint16{"loop": 0x200, "data": 0x300, "sprite": 0x30A} {
+		if res.Labels[label] != addr {
+			t.Errorf("%s at 0x%X, want 0x%X", label, res.Labels[label], addr)
+		}
+	}
+
+	var listing bytes.Buffer
+	err = res.WriteListing(&listing)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range []string{"030A src/sprites.8s:1\t3C42", "@data 0300"} {
+		if !strings.Contains(listing.String(), filepath.FromSlash(line)) {
+			t.Errorf("listing without %q:\n%s", line, listing.String())
+		}
+	}
+}
+
+func TestErrors(t *testing.T) {
+	for _, src := range []string{
+		"FOO V1",
+		"LD V1",
+		"LD V1, V2, V3",
+		"JP nowhere",
+		"LD V0, 0x100",
+		"LD VG, 1",
+		"DRW V1, V2, 16",
+		"JP V3, 0x400",
+		"x: CLS\nx: CLS",
+		"X equ 1\nX equ 2",
+		"A equ B\nB equ A\nLD V0, A",
+		"org 0x100",
+		"org 0x300\nCLS\norg 0x200\nCLS",
+		"include \"self.8s\"",
+		"include \"missing.8s\"",
+		"org 0xFFFF\ndw 0",
+	} {
+		_, err := AssembleWith("self.8s", []byte(src), func(path string) ([]byte, error) {
+			if path == "self.8s" {
+				return []byte("include \"self.8s\""), nil
+			}
+			return nil, os.ErrNotExist
+		})
+		if err == nil {
+			t.Errorf("%q: no error", src)
+		}
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	files, err := filepath.Glob("../regression/testdata/roms/*.8o")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, file := range files {
+		res, err := octo.CompileFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = RoundTrip(res.ROM, chip8.Platform(res.Platform))
+		if err != nil {
+			t.Errorf("%s: %v", filepath.Base(file), err)
+		}
+	}
+
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < RANDOM_ROMS; i++ {
+		rom := make([]byte, 1+r.Intn(512))
+		r.Read(rom)
+		p := PLATFORMS[i%len(PLATFORMS)]
+		err := RoundTrip(rom, p)
+		if err != nil {
+			t.Fatalf("%s ROM %x: %v", p, rom, err)
+		}
+	}
+}
+
+func FuzzRoundTrip(f *testing.F) {
+	r := rand.New(rand.NewSource(2))
+	for i := 0; i < 8; i++ {
+		rom := make([]byte, 64)
+		r.Read(rom)
+		f.Add(rom, byte(i))
+	}
+
+	f.Fuzz(func(t *testing.T, rom []byte, platform byte) {
+		if len(rom) > chip8.MEMORY_SIZE_XO-int(chip8.START_ADDR) {
+			return
+		}
+		p := PLATFORMS[int(platform)%len(PLATFORMS)]
+		err := RoundTrip(rom, p)
+		if err != nil {
+			t.Fatalf("%s: %v", p, err)
+		}
+	})
+}
@@ -0,0 +1,283 @@
+package asm
+
+import (
+	"strings"
+)
+
+type argKind byte
+
+const (
+	ARG_VALUE argKind = iota // number, label or expression
+	ARG_REG                  // Vx
+	ARG_RANGE                // Vx-Vy
+	ARG_LONG                 // long value
+	ARG_I                    // I
+	ARG_MEM_I                // [I]
+	ARG_DT
+	ARG_ST
+	ARG_K
+	ARG_F
+	ARG_HF
+	ARG_B
+	ARG_R
+)
+
+var KEYWORDS map[string]argKind = map[string]argKind{
+	"i":   ARG_I,
+	"[i]": ARG_MEM_I,
+	"dt":  ARG_DT,
+	"st":  ARG_ST,
+	"k":   ARG_K,
+	"f":   ARG_F,
+	"hf":  ARG_HF,
+	"b":   ARG_B,
+	"r":   ARG_R,
+}
+
+type arg struct {
+	kind argKind
+	reg  byte   // Vx, the first register of a range
+	reg2 byte   // the last register of a range
+	expr string // ARG_VALUE and ARG_LONG
+}
+
+func parseReg(s string) (byte, bool) {
+	if len(s) != 2 || (s[0] != 'v' && s[0] != 'V') {
+		return 0, false
+	}
+	v, ok := parseNumber("0x" + s[1:])
+	return byte(v), ok
+}
+
+func parseArg(s string) arg {
+	lower := strings.ToLower(s)
+	if kind, ok := KEYWORDS[lower]; ok {
+		return arg{kind: kind}
+	}
+	if r, ok := parseReg(s); ok {
+		return arg{kind: ARG_REG, reg: r}
+	}
+	if i := strings.Index(s, "-"); i > 0 {
+		r1, ok1 := parseReg(strings.TrimSpace(s[:i]))
+		r2, ok2 := parseReg(strings.TrimSpace(s[i+1:]))
+		if ok1 && ok2 {
+			return arg{kind: ARG_RANGE, reg: r1, reg2: r2}
+		}
+	}
+	if strings.HasPrefix(lower, "long ") {
+		return arg{kind: ARG_LONG, expr: strings.TrimSpace(s[5:])}
+	}
+	return arg{kind: ARG_VALUE, expr: s}
+}
+
+// form is an encoding of a mnemonic for a list of operand kinds.
+type form struct {
+	args   []argKind
+	opcode uint16
+	encode func(a *assembler, s *stmt, args []arg, op uint16) ([]byte, error)
+}
+
+func word(op uint16) []byte {
+	return []byte{byte(op >> 8), byte(op)}
+}
+
+func none(a *assembler, s *stmt, args []arg, op uint16) ([]byte, error) {
+	return word(op), nil
+}
+
+// x puts the register of the first Vx operand in the x nibble.
+func x(a *assembler, s *stmt, args []arg, op uint16) ([]byte, error) {
+	for _, arg := range args {
+		if arg.kind == ARG_REG {
+			return word(op | uint16(arg.reg)<<8), nil
+		}
+	}
+	return word(op), nil
+}
+
+func xy(a *assembler, s *stmt, args []arg, op uint16) ([]byte, error) {
+	return word(op | uint16(args[0].reg)<<8 | uint16(args[1].reg)<<4), nil
+}
+
+// xDefaultY encodes SHR/SHL Vx {, Vy}, Vy defaults to Vx.
+func xDefaultY(a *assembler, s *stmt, args []arg, op uint16) ([]byte, error) {
+	y := args[0].reg
+	if len(args) > 1 {
+		y = args[1].reg
+	}
+	return word(op | uint16(args[0].reg)<<8 | uint16(y)<<4), nil
+}
+
+func rangeXY(a *assembler, s *stmt, args []arg, op uint16) ([]byte, error) {
+	for _, arg := range args {
+		if arg.kind == ARG_RANGE {
+			return word(op | uint16(arg.reg)<<8 | uint16(arg.reg2)<<4), nil
+		}
+	}
+	return word(op), nil
+}
+
+func nnn(a *assembler, s *stmt, args []arg, op uint16) ([]byte, error) {
+	v, err := a.evalRange(s, args[len(args)-1].expr, 0, 0xfff)
+	if err != nil {
+		return nil, err
+	}
+	return word(op | uint16(v)), nil
+}
+
+func xkk(a *assembler, s *stmt, args []arg, op uint16) ([]byte, error) {
+	v, err := a.evalRange(s, args[1].expr, -128, 0xff)
+	if err != nil {
+		return nil, err
+	}
+	return word(op | uint16(args[0].reg)<<8 | uint16(byte(v))), nil
+}
+
+func n(a *assembler, s *stmt, args []arg, op uint16) ([]byte, error) {
+	v, err := a.evalRange(s, args[len(args)-1].expr, 0, 0xf)
+	if err != nil {
+		return nil, err
+	}
+	return word(op | uint16(v)), nil
+}
+
+func xyn(a *assembler, s *stmt, args []arg, op uint16) ([]byte, error) {
+	v, err := a.evalRange(s, args[2].expr, 0, 0xf)
+	if err != nil {
+		return nil, err
+	}
+	return word(op | uint16(args[0].reg)<<8 | uint16(args[1].reg)<<4 | uint16(v)), nil
+}
+
+func plane(a *assembler, s *stmt, args []arg, op uint16) ([]byte, error) {
+	v, err := a.evalRange(s, args[0].expr, 0, 3)
+	if err != nil {
+		return nil, err
+	}
+	return word(op | uint16(v)<<8), nil
+}
+
+func long(a *assembler, s *stmt, args []arg, op uint16) ([]byte, error) {
+	v, err := a.evalRange(s, args[1].expr, 0, 0xffff)
+	if err != nil {
+		return nil, err
+	}
+	return append(word(op), byte(v>>8), byte(v)), nil
+}
+
+// jumpV0 encodes JP V0, addr and the CHIP-48 form JP Vx, xnn.
+func jumpV0(a *assembler, s *stmt, args []arg, op uint16) ([]byte, error) {
+	v, err := a.evalRange(s, args[1].expr, 0, 0xfff)
+	if err != nil {
+		return nil, err
+	}
+	if args[0].reg != 0 && byte(v>>8) != args[0].reg {
+		return nil, errorf(s, "JP V%X, addr needs an address in 0x%X00-0x%XFF", args[0].reg, args[0].reg, args[0].reg)
+	}
+	return word(op | uint16(v)), nil
+}
+
+const (
+	V  = ARG_REG
+	NN = ARG_VALUE
+)
+
+var FORMS map[string][]form = map[string][]form{
+	"cls":  {{nil, 0x00e0, none}},
+	"ret":  {{nil, 0x00ee, none}},
+	"scd":  {{[]argKind{NN}, 0x00c0, n}},
+	"scu":  {{[]argKind{NN}, 0x00d0, n}},
+	"scr":  {{nil, 0x00fb, none}},
+	"scl":  {{nil, 0x00fc, none}},
+	"exit": {{nil, 0x00fd, none}},
+	"low":  {{nil, 0x00fe, none}},
+	"high": {{nil, 0x00ff, none}},
+	"sys":  {{[]argKind{NN}, 0x0000, nnn}},
+	"jp": {
+		{[]argKind{NN}, 0x1000, nnn},
+		{[]argKind{V, NN}, 0xb000, jumpV0},
+	},
+	"call": {{[]argKind{NN}, 0x2000, nnn}},
+	"se": {
+		{[]argKind{V, NN}, 0x3000, xkk},
+		{[]argKind{V, V}, 0x5000, xy},
+	},
+	"sne": {
+		{[]argKind{V, NN}, 0x4000, xkk},
+		{[]argKind{V, V}, 0x9000, xy},
+	},
+	"ld": {
+		{[]argKind{V, NN}, 0x6000, xkk},
+		{[]argKind{V, V}, 0x8000, xy},
+		{[]argKind{ARG_I, NN}, 0xa000, nnn},
+		{[]argKind{ARG_I, ARG_LONG}, 0xf000, long},
+		{[]argKind{V, ARG_DT}, 0xf007, x},
+		{[]argKind{V, ARG_K}, 0xf00a, x},
+		{[]argKind{ARG_DT, V}, 0xf015, x},
+		{[]argKind{ARG_ST, V}, 0xf018, x},
+		{[]argKind{ARG_F, V}, 0xf029, x},
+		{[]argKind{ARG_HF, V}, 0xf030, x},
+		{[]argKind{ARG_B, V}, 0xf033, x},
+		{[]argKind{ARG_MEM_I, V}, 0xf055, x},
+		{[]argKind{V, ARG_MEM_I}, 0xf065, x},
+		{[]argKind{ARG_R, V}, 0xf075, x},
+		{[]argKind{V, ARG_R}, 0xf085, x},
+		{[]argKind{ARG_MEM_I, ARG_RANGE}, 0x5002, rangeXY},
+		{[]argKind{ARG_RANGE, ARG_MEM_I}, 0x5003, rangeXY},
+	},
+	"add": {
+		{[]argKind{V, NN}, 0x7000, xkk},
+		{[]argKind{V, V}, 0x8004, xy},
+		{[]argKind{ARG_I, V}, 0xf01e, x},
+	},
+	"or":   {{[]argKind{V, V}, 0x8001, xy}},
+	"and":  {{[]argKind{V, V}, 0x8002, xy}},
+	"xor":  {{[]argKind{V, V}, 0x8003, xy}},
+	"sub":  {{[]argKind{V, V}, 0x8005, xy}},
+	"subn": {{[]argKind{V, V}, 0x8007, xy}},
+	"shr": {
+		{[]argKind{V, V}, 0x8006, xDefaultY},
+		{[]argKind{V}, 0x8006, xDefaultY},
+	},
+	"shl": {
+		{[]argKind{V, V}, 0x800e, xDefaultY},
+		{[]argKind{V}, 0x800e, xDefaultY},
+	},
+	"rnd":   {{[]argKind{V, NN}, 0xc000, xkk}},
+	"drw":   {{[]argKind{V, V, NN}, 0xd000, xyn}},
+	"skp":   {{[]argKind{V}, 0xe09e, x}},
+	"sknp":  {{[]argKind{V}, 0xe0a1, x}},
+	"skpn":  {{[]argKind{V}, 0xe0a1, x}}, // as printed by the instruction handler
+	"plane": {{[]argKind{NN}, 0xf001, plane}},
+	"audio": {{nil, 0xf002, none}},
+	"pitch": {{[]argKind{V}, 0xf03a, x}},
+}
+
+func (a *assembler) encodeInst(s *stmt) ([]byte, error) {
+	forms, ok := FORMS[s.op]
+	if !ok {
+		return nil, errorf(s, "unknown instruction: %s", s.op)
+	}
+
+	args := make([]arg, len(s.args))
+	for i, str := range s.args {
+		args[i] = parseArg(str)
+	}
+
+	for _, f := range forms {
+		if len(f.args) != len(args) {
+			continue
+		}
+		match := true
+		for i, kind := range f.args {
+			if args[i].kind != kind {
+				match = false
+			}
+		}
+		if match {
+			return f.encode(a, s, args, f.opcode)
+		}
+	}
+
+	return nil, errorf(s, "bad operands: %s %s", strings.ToUpper(s.op), strings.Join(s.args, ", "))
+}
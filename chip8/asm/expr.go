@@ -0,0 +1,122 @@
+package asm
+
+import (
+	"strconv"
+	"strings"
+)
+
+// parseNumber parses 5, 05, 0x05, #05, $05, 0b101 and 'a', leading zeros are
+// decimal like the instruction handlers print them.
+func parseNumber(s string) (int, bool) {
+	base := 10
+	switch {
+	case len(s) == 3 && s[0] == '\'' && s[2] == '\'':
+		return int(s[1]), true
+	case strings.HasPrefix(s, "0x") || strings.HasPrefix(s, "0X"):
+		s, base = s[2:], 16
+	case strings.HasPrefix(s, "0b") || strings.HasPrefix(s, "0B"):
+		s, base = s[2:], 2
+	case strings.HasPrefix(s, "#") || strings.HasPrefix(s, "$"):
+		s, base = s[1:], 16
+	}
+	if s == "" {
+		return 0, false
+	}
+	v, err := strconv.ParseUint(s, base, 32)
+	if err != nil {
+		return 0, false
+	}
+	return int(v), true
+}
+
+// eval evaluates a sum of numbers, labels, constants and $ (the address of s).
+func (a *assembler) eval(s *stmt, expr string) (int, error) {
+	expr = strings.TrimSpace(expr)
+	if expr == "" {
+		return 0, errorf(s, "missing value")
+	}
+
+	res, sign := 0, 1
+	term := ""
+	flush := func() error {
+		term = strings.TrimSpace(term)
+		if term == "" {
+			return errorf(s, "bad expression: %s", expr)
+		}
+		v, err := a.term(s, term)
+		if err != nil {
+			return err
+		}
+		res += sign * v
+		term = ""
+		return nil
+	}
+
+	for i := 0; i < len(expr); i++ {
+		c := expr[i]
+		switch {
+		case c == '\'' && i+2 < len(expr) && expr[i+2] == '\'':
+			term += expr[i : i+3]
+			i += 2
+		case (c == '+' || c == '-') && strings.TrimSpace(term) == "":
+			// unary sign
+			if c == '-' {
+				sign = -sign
+			}
+		case c == '+' || c == '-':
+			err := flush()
+			if err != nil {
+				return 0, err
+			}
+			sign = 1
+			if c == '-' {
+				sign = -1
+			}
+		default:
+			term += string(c)
+		}
+	}
+	err := flush()
+	if err != nil {
+		return 0, err
+	}
+
+	return res, nil
+}
+
+func (a *assembler) term(s *stmt, term string) (int, error) {
+	if term == "$" {
+		return int(s.addr), nil
+	}
+	if v, ok := parseNumber(term); ok {
+		return v, nil
+	}
+	if !isIdent(term) {
+		return 0, errorf(s, "bad value: %s", term)
+	}
+
+	if addr, ok := a.labels[term]; ok {
+		return int(addr), nil
+	}
+	if expr, ok := a.consts[term]; ok {
+		if a.resolving[term] {
+			return 0, errorf(s, "%s is defined by itself", term)
+		}
+		a.resolving[term] = true
+		defer delete(a.resolving, term)
+		return a.eval(a.constPos[term], expr)
+	}
+
+	return 0, errorf(s, "undefined: %s", term)
+}
+
+func (a *assembler) evalRange(s *stmt, expr string, min, max int) (int, error) {
+	v, err := a.eval(s, expr)
+	if err != nil {
+		return 0, err
+	}
+	if v < min || v > max {
+		return 0, errorf(s, "value out of range: %s = %d", expr, v)
+	}
+	return v, nil
+}
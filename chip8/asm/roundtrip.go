@@ -0,0 +1,33 @@
+package asm
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/ministergoose/chip8-emu-go/chip8"
+	"github.com/ministergoose/chip8-emu-go/chip8/disasm"
+)
+
+// RoundTrip disassembles rom and assembles the source again, the ROM must come back byte for byte.
+func RoundTrip(rom []byte, p chip8.Platform) error {
+	var src bytes.Buffer
+	err := disasm.Disassemble(rom, disasm.Options{Platform: p}).Write(&src)
+	if err != nil {
+		return err
+	}
+
+	res, err := Assemble("roundtrip.8s", src.Bytes())
+	if err != nil {
+		return fmt.Errorf("disassembly doesn't assemble: %v", err)
+	}
+	if !bytes.Equal(res.ROM, rom) {
+		for i := range rom {
+			if i >= len(res.ROM) || res.ROM[i] != rom[i] {
+				return fmt.Errorf("round trip differs at 0x%03X", int(chip8.START_ADDR)+i)
+			}
+		}
+		return fmt.Errorf("round trip is %d bytes longer", len(res.ROM)-len(rom))
+	}
+
+	return nil
+}
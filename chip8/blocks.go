@@ -0,0 +1,153 @@
+package chip8
+
+// The block interpreter decodes straight runs of instructions once and caches
+// them by start address. A block ends with the first instruction that jumps,
+// skips, waits for a key or writes memory, so the code of a block can only be
+// overwritten by its last instruction. Writes bump the version of their page,
+// a block is decoded again when a page it spans has changed.
+
+const (
+	BLOCK_MAX_SIZE  = 128 // bytes, a block spans at most two pages
+	BLOCK_PAGE_BITS = 8   // 256 byte pages
+)
+
+// Interpreter selects how RunFrame executes instructions.
+type Interpreter byte
+
+const (
+	INTERPRETER_STEP   Interpreter = iota // decodes every instruction when it runs
+	INTERPRETER_BLOCKS                    // runs cached pre-decoded blocks
+)
+
+var INTERPRETERS map[string]Interpreter = map[string]Interpreter{
+	"step":   INTERPRETER_STEP,
+	"blocks": INTERPRETER_BLOCKS,
+}
+
+func (i Interpreter) String() string {
+	for name, x := range INTERPRETERS {
+		if x == i {
+			return name
+		}
+	}
+	return "unknown"
+}
+
+type block struct {
+	code     []Instruction
+	first    uint16    // page of the first byte
+	last     uint16    // page of the last byte
+	versions [2]uint32 // of the first and the last page when decoded
+}
+
+type blockCache struct {
+	blocks   []*block // by start address
+	versions []uint32 // by page
+}
+
+// SetInterpreter selects the interpreter, the debugger and Debug always step.
+func (c *Cpu) SetInterpreter(i Interpreter) {
+	c.interpreter = i
+}
+
+func (c *Cpu) Interpreter() Interpreter {
+	return c.interpreter
+}
+
+// StepBlock runs the instructions of the block at PC, at most n of them. It
+// returns how many were run and stops after one that fails, halts the machine
+// or waits for the vertical blank.
+func (c *Cpu) StepBlock(n int) (int, error) {
+	c.cnt = c.wrap(c.cnt)
+	b := c.block(c.cnt)
+	if b == nil {
+		return 1, c.Step()
+	}
+
+	for i, in := range b.code {
+		if i == n {
+			return i, nil
+		}
+		c.cnt += 2
+		err := EXEC[in.Op](c, in)
+		if err != nil || c.waitVBlank || c.halted {
+			return i + 1, err
+		}
+	}
+	return len(b.code), nil
+}
+
+// step runs at most n instructions with the selected interpreter.
+func (c *Cpu) step(n int) (int, error) {
+	if c.interpreter == INTERPRETER_BLOCKS && c.attached() == nil && !c.Debug {
+		return c.StepBlock(n)
+	}
+	return 1, c.Step()
+}
+
+// block returns the block at addr, nil if there is no complete instruction there.
+func (c *Cpu) block(addr uint16) *block {
+	bc := &c.blocks
+	if bc.blocks == nil {
+		bc.blocks = make([]*block, len(c.memory))
+		bc.versions = make([]uint32, (len(c.memory)+(1<<BLOCK_PAGE_BITS)-1)>>BLOCK_PAGE_BITS)
+	}
+
+	b := bc.blocks[addr]
+	if b != nil && bc.versions[b.first] == b.versions[0] && bc.versions[b.last] == b.versions[1] {
+		return b
+	}
+	b = c.decodeBlock(addr)
+	bc.blocks[addr] = b
+	return b
+}
+
+func (c *Cpu) decodeBlock(start uint16) *block {
+	var code []Instruction
+	pc := int(start)
+	for pc-int(start) < BLOCK_MAX_SIZE && pc+1 < len(c.memory) {
+		in := Decode(uint16(c.memory[pc])<<8|uint16(c.memory[pc+1]), c.platform)
+		if pc+int(in.Size()) > len(c.memory) {
+			break
+		}
+		code = append(code, in)
+		pc += int(in.Size())
+		if endsBlock(in.Op) {
+			break
+		}
+	}
+	if len(code) == 0 {
+		return nil
+	}
+
+	b := &block{code: code, first: start >> BLOCK_PAGE_BITS, last: uint16(pc-1) >> BLOCK_PAGE_BITS}
+	b.versions[0] = c.blocks.versions[b.first]
+	b.versions[1] = c.blocks.versions[b.last]
+	return b
+}
+
+func endsBlock(op Op) bool {
+	switch op {
+	case OP_UNKNOWN, OP_RET, OP_EXIT, OP_JP, OP_CALL, OP_JP_V0, OP_LD_VX_K,
+		OP_SE_BYTE, OP_SNE_BYTE, OP_SE_REG, OP_SNE_REG, OP_SKP, OP_SKNP,
+		OP_SAVE_RANGE, OP_LD_B_VX, OP_SAVE:
+		return true
+	}
+	return false
+}
+
+// invalidate drops the blocks decoded from memory at addr.
+func (c *Cpu) invalidate(addr uint16, length int) {
+	versions := c.blocks.versions
+	if versions == nil || length <= 0 {
+		return
+	}
+	for p := int(addr) >> BLOCK_PAGE_BITS; p <= (int(addr)+length-1)>>BLOCK_PAGE_BITS && p < len(versions); p++ {
+		versions[p]++
+	}
+}
+
+// flushBlocks drops all blocks, after the memory was replaced.
+func (c *Cpu) flushBlocks() {
+	c.blocks = blockCache{}
+}
@@ -0,0 +1,125 @@
+package chip8
+
+import (
+	"crypto/sha1"
+	"testing"
+	"time"
+
+	"github.com/ministergoose/chip8-emu-go/chip8/hardware/headless"
+)
+
+const BENCH_TICKRATE = 1000
+
+// a loop of arithmetic, drawing and BCD stores
+var BENCH_ROM []byte = []byte{
+	0x60, 0x00, // 200 LD V0, 0x00
+	0x61, 0x00, // 202 LD V1, 0x00
+	0xA3, 0x00, // 204 LD I, 0x300
+	0x70, 0x01, // 206 ADD V0, 0x01
+	0x81, 0x04, // 208 ADD V1, V0
+	0x82, 0x06, // 20A SHR V2, V0
+	0x83, 0x13, // 20C XOR V3, V1
+	0xF0, 0x1E, // 20E ADD I, V0
+	0xD0, 0x15, // 210 DRW V0, V1, 5
+	0xF2, 0x33, // 212 LD B, V2
+	0x30, 0x00, // 214 SE V0, 0x00
+	0x12, 0x04, // 216 JP 0x204
+	0x12, 0x04, // 218 JP 0x204
+}
+
+func benchmarkInterpreter(b *testing.B, i Interpreter) {
+	c := NewCPU(headless.NewDisplayHeadless(), headless.NewKeyboardHeadless(), headless.NewSoundHeadless(), QUIRKS_CHIP48)
+	c.SetInterpreter(i)
+	c.SetTickRate(BENCH_TICKRATE)
+	err := c.LoadROM(BENCH_ROM)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	b.ResetTimer()
+	start := time.Now()
+	for n := 0; n < b.N; n++ {
+		c.RunFrame()
+	}
+	b.ReportMetric(float64(b.N*BENCH_TICKRATE)/time.Since(start).Seconds(), "instr/s")
+}
+
+func BenchmarkStep(b *testing.B) {
+	benchmarkInterpreter(b, INTERPRETER_STEP)
+}
+
+func BenchmarkBlocks(b *testing.B) {
+	benchmarkInterpreter(b, INTERPRETER_BLOCKS)
+}
+
+// programs that overwrite an instruction they have run and run it again,
+// V5 is the sum of the instruction before and after the write
+var SELF_MODIFYING = []struct {
+	name  string
+	rom   []byte
+	patch func(c *Cpu) // between the two frames
+	v5    byte
+}{
+	{name: "store", v5: 0x11, rom: []byte{
+		0x75, 0x01, // 200 ADD V5, 0x01, becomes ADD V5, 0x10
+		0x4E, 0x00, // 202 SNE VE, 0x00
+		0x12, 0x08, // 204 JP 0x208
+		0x12, 0x06, // 206 JP 0x206
+		0x7E, 0x01, // 208 ADD VE, 0x01
+		0x60, 0x75, // 20A LD V0, 0x75
+		0x61, 0x10, // 20C LD V1, 0x10
+		0xA2, 0x00, // 20E LD I, 0x200
+		0xF1, 0x55, // 210 LD [I], V1
+		0x12, 0x00, // 212 JP 0x200
+	}},
+	{name: "bcd", v5: 0x02, rom: []byte{
+		0x75, 0x00, // 200 ADD V5, 0x00, becomes ADD V5, 0x02
+		0x76, 0x01, // 202 ADD V6, 0x01, becomes SYS 0x304
+		0x4E, 0x00, // 204 SNE VE, 0x00
+		0x12, 0x0A, // 206 JP 0x20A
+		0x12, 0x08, // 208 JP 0x208
+		0x7E, 0x01, // 20A ADD VE, 0x01
+		0x60, 0xEA, // 20C LD V0, 234
+		0xA2, 0x01, // 20E LD I, 0x201
+		0xF0, 0x33, // 210 LD B, V0
+		0x12, 0x00, // 212 JP 0x200
+	}},
+	{name: "dma", v5: 5*0x01 + 5*0x10, rom: []byte{
+		0x75, 0x01, // 200 ADD V5, 0x01, becomes ADD V5, 0x10
+		0x12, 0x00, // 202 JP 0x200
+	}, patch: func(c *Cpu) {
+		c.DMA(0x200, []byte{0x75, 0x10}, 2)
+	}},
+}
+
+func TestSelfModifying(t *testing.T) {
+	for _, test := range SELF_MODIFYING {
+		var hashes [2][sha1.Size]byte
+		for _, i := range []Interpreter{INTERPRETER_STEP, INTERPRETER_BLOCKS} {
+			c := NewCPU(headless.NewDisplayHeadless(), headless.NewKeyboardHeadless(), headless.NewSoundHeadless(), QUIRKS_CHIP48)
+			c.SetInterpreter(i)
+			c.SetTickRate(10)
+			c.Seed(1)
+			err := c.LoadROM(test.rom)
+			if err != nil {
+				t.Fatal(err)
+			}
+			c.RunFrame()
+			if test.patch != nil {
+				test.patch(c)
+			}
+			c.RunFrame()
+
+			if v5 := c.Registers().V[5]; v5 != test.v5 {
+				t.Errorf("%s, %v interpreter: V5 is 0x%02X, want 0x%02X", test.name, i, v5, test.v5)
+			}
+			hashes[i], err = c.StateHash()
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		if hashes[INTERPRETER_STEP] != hashes[INTERPRETER_BLOCKS] {
+			t.Errorf("%s: the interpreters end in different states", test.name)
+		}
+	}
+}
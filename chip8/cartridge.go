@@ -0,0 +1,100 @@
+package chip8
+
+import (
+	"bytes"
+	"image/color"
+	"log"
+
+	"github.com/ministergoose/chip8-emu-go/chip8/octo"
+)
+
+// the memory sizes of the Octo platforms, see Options.MaxSize
+const (
+	OCTO_MAX_SIZE_SCHIP  = 3583
+	OCTO_MAX_SIZE_XOCHIP = 65024
+)
+
+// paletteDisplay is a display with configurable colors
+type paletteDisplay interface {
+	SetPalette(palette [4]color.RGBA)
+}
+
+func (c *Cpu) SetTickRate(n int) {
+	if n < 1 {
+		n = 1
+	}
+	c.tickRate = n
+}
+
+// TickRate returns the number of instructions run per frame.
+func (c *Cpu) TickRate() int {
+	return c.tickRate
+}
+
+// loadCartridge compiles the program of an Octo cartridge and applies its options.
+func (c *Cpu) loadCartridge(filePath string, data []byte) error {
+	cart, err := octo.DecodeCartridge(bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	res, err := octo.Compile(filePath, []byte(cart.Program))
+	if err != nil {
+		return err
+	}
+
+	p := Platform(res.Platform)
+	switch {
+	case cart.Options.MaxSize >= OCTO_MAX_SIZE_XOCHIP:
+		p = PLATFORM_XOCHIP
+	case cart.Options.MaxSize >= OCTO_MAX_SIZE_SCHIP && p < PLATFORM_SCHIP:
+		p = PLATFORM_SCHIP
+	}
+	c.SetPlatform(p)
+	c.SetQuirks(octoQuirks(cart.Options))
+	c.SetTickRate(cart.Options.TickRate)
+
+	if d, ok := c.display.(paletteDisplay); ok {
+		palette, err := cart.Options.Palette()
+		if err != nil {
+			log.Println(err)
+		} else {
+			d.SetPalette(palette)
+		}
+	}
+
+	return c.LoadROM(res.ROM)
+}
+
+func octoQuirks(o octo.Options) Quirks {
+	q := Quirks{
+		VFReset:     o.LogicQuirks,
+		Shift:       o.ShiftQuirks,
+		LoadStore:   LOAD_STORE_INC_X1,
+		Jump:        o.JumpQuirks,
+		Clip:        o.ClipQuirks,
+		DisplayWait: o.VBlankQuirks,
+	}
+	if o.LoadStoreQuirks {
+		q.LoadStore = LOAD_STORE_KEEP
+	}
+	return q
+}
+
+// NewCartridge returns the cartridge of an Octo program with the settings of the emulator.
+func NewCartridge(program string, p Platform, q Quirks, tickRate int) *octo.Cartridge {
+	o := octo.DEFAULT_OPTIONS
+	o.TickRate = tickRate
+	o.LogicQuirks = q.VFReset
+	o.ShiftQuirks = q.Shift
+	o.LoadStoreQuirks = q.LoadStore == LOAD_STORE_KEEP
+	o.JumpQuirks = q.Jump
+	o.ClipQuirks = q.Clip
+	o.VBlankQuirks = q.DisplayWait
+	switch p {
+	case PLATFORM_SCHIP:
+		o.MaxSize = OCTO_MAX_SIZE_SCHIP
+	case PLATFORM_XOCHIP:
+		o.MaxSize = OCTO_MAX_SIZE_XOCHIP
+	}
+	return &octo.Cartridge{Program: program, Options: o}
+}
@@ -0,0 +1,254 @@
+// Package config reads the user's defaults of the emulator from a TOML or
+// JSON file. Flags override them, and so do the settings of a ROM.
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// FILES are the names of the config file in the config directory, the first
+// one found is read.
+var FILES []string = []string{"config.toml", "config.json"}
+
+const (
+	DIR = "chip8-emu"
+	// KEYMAP_FILE is the keymap of the rebinding screen, in the config directory
+	KEYMAP_FILE = "keymap.json"
+)
+
+/*
+   config.toml:
+
+   palette = ["#000000", "#FFFFFF"]   # background, plane 1, plane 2, both planes
+   scale = 8.0
+   ips = 1000                         # or tickrate = 16
+   quirks = "chip48"
+   states = "~/.local/share/chip8-emu/states"
+   layout = "qwerty"
+
+   [keymap]                           # CHIP-8 key = host keys, over the layout
+   1 = "1"
+   4 = ["Q", "UP"]
+
+   [audio]
+   mute = false
+   freq = 440.0
+
+   config.json has the same keys.
+*/
+
+type Config struct {
+	Palette  []string        `json:"palette,omitempty"`
+	Scale    float64         `json:"scale,omitempty"`
+	Layout   string          `json:"layout,omitempty"`
+	Keymap   map[string]Keys `json:"keymap,omitempty"`
+	IPS      int             `json:"ips,omitempty"`
+	TickRate int             `json:"tickrate,omitempty"`
+	Quirks   string          `json:"quirks,omitempty"`
+	States   string          `json:"states,omitempty"` // save state directory, empty for next to the ROM
+	Audio    Audio           `json:"audio"`
+}
+
+// Keys are the host key names of a CHIP-8 key, one name or a list of them.
+type Keys []string
+
+func (k *Keys) UnmarshalJSON(data []byte) error {
+	var name string
+	if json.Unmarshal(data, &name) == nil {
+		*k = Keys{name}
+		return nil
+	}
+	var names []string
+	err := json.Unmarshal(data, &names)
+	if err != nil {
+		return fmt.Errorf("keys are a name or a list of names: %s", data)
+	}
+	*k = names
+	return nil
+}
+
+func (k Keys) MarshalJSON() ([]byte, error) {
+	if len(k) == 1 {
+		return json.Marshal(k[0])
+	}
+	return json.Marshal([]string(k))
+}
+
+type Audio struct {
+	Mute bool    `json:"mute,omitempty"`
+	Freq float64 `json:"freq,omitempty"` // of the beep, 0 for the default
+}
+
+// Dir returns the default config directory.
+func Dir() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, DIR), nil
+}
+
+// Path returns the config file in dir, the first of FILES that exists or
+// else the first of FILES.
+func Path(dir string) string {
+	for _, name := range FILES {
+		filePath := filepath.Join(dir, name)
+		if _, err := os.Stat(filePath); err == nil {
+			return filePath
+		}
+	}
+	return filepath.Join(dir, FILES[0])
+}
+
+// Load reads a config file, TOML unless it ends in .json.
+func Load(filePath string) (Config, error) {
+	var cfg Config
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return cfg, err
+	}
+	if strings.EqualFold(filepath.Ext(filePath), ".json") {
+		err = unmarshalJSON(data, &cfg)
+	} else {
+		err = UnmarshalTOML(data, &cfg)
+	}
+	if err != nil {
+		return cfg, fmt.Errorf("%s: %v", filePath, err)
+	}
+	cfg.States = ExpandHome(cfg.States)
+	return cfg, nil
+}
+
+// unmarshalJSON is json.Unmarshal with an error for the keys without a field,
+// which are misspelt settings.
+func unmarshalJSON(data []byte, v interface{}) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	err := dec.Decode(v)
+	if err != nil {
+		return err
+	}
+	if dec.More() {
+		return fmt.Errorf("data after the JSON value")
+	}
+	return nil
+}
+
+// LoadKeymap reads a keymap file, CHIP-8 key => host keys as JSON, or as
+// TOML unless it ends in .json.
+func LoadKeymap(filePath string) (map[string]Keys, error) {
+	var keymap map[string]Keys
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, err
+	}
+	if strings.EqualFold(filepath.Ext(filePath), ".json") {
+		err = json.Unmarshal(data, &keymap)
+	} else {
+		err = UnmarshalTOML(data, &keymap)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", filePath, err)
+	}
+	return keymap, nil
+}
+
+// SaveKeymap writes a keymap file as JSON.
+func SaveKeymap(filePath string, keymap map[string]Keys) error {
+	data, err := json.MarshalIndent(keymap, "", "    ")
+	if err != nil {
+		return err
+	}
+	err = os.MkdirAll(filepath.Dir(filePath), 0755)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filePath, append(data, '\n'), 0644)
+}
+
+// Ticks returns the instructions per frame of tickrate or ips, 0 for none.
+func (cfg Config) Ticks() int {
+	if cfg.TickRate > 0 {
+		return cfg.TickRate
+	}
+	if cfg.IPS > 0 {
+		return (cfg.IPS + 59) / 60
+	}
+	return 0
+}
+
+// ExpandHome replaces a leading ~ with the home directory.
+func ExpandHome(filePath string) string {
+	if filePath != "~" && !strings.HasPrefix(filePath, "~/") {
+		return filePath
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return filePath
+	}
+	return filepath.Join(home, filePath[1:])
+}
+
+// WriteTOML writes cfg as a config file, notes are comments by key, e.g.
+// "audio.mute".
+func (cfg Config) WriteTOML(w io.Writer, notes map[string]string) error {
+	var b strings.Builder
+	line := func(key, name string, value interface{}) {
+		s := name + " = " + tomlValue(value)
+		if note := notes[key]; note != "" {
+			s = fmt.Sprintf("%-40s # %s", s, note)
+		}
+		b.WriteString(s + "\n")
+	}
+
+	line("palette", "palette", cfg.Palette)
+	line("scale", "scale", cfg.Scale)
+	if cfg.IPS > 0 {
+		line("ips", "ips", cfg.IPS)
+	}
+	if cfg.TickRate > 0 {
+		line("tickrate", "tickrate", cfg.TickRate)
+	}
+	line("quirks", "quirks", cfg.Quirks)
+	line("states", "states", cfg.States)
+	line("layout", "layout", cfg.Layout)
+
+	if len(cfg.Keymap) > 0 {
+		b.WriteString("\n[keymap]")
+		if note := notes["keymap"]; note != "" {
+			b.WriteString(" # " + note)
+		}
+		b.WriteString("\n")
+		var keys []string
+		for key := range cfg.Keymap {
+			keys = append(keys, key)
+		}
+		sort.Slice(keys, func(i, j int) bool {
+			a, _ := strconv.ParseUint(keys[i], 16, 8)
+			b, _ := strconv.ParseUint(keys[j], 16, 8)
+			return a < b
+		})
+		for _, key := range keys {
+			if keys := cfg.Keymap[key]; len(keys) == 1 {
+				line("", tomlKey(key), keys[0])
+			} else {
+				line("", tomlKey(key), []string(keys))
+			}
+		}
+	}
+
+	b.WriteString("\n[audio]\n")
+	line("audio.mute", "mute", cfg.Audio.Mute)
+	line("audio.freq", "freq", cfg.Audio.Freq)
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
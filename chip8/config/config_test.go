@@ -0,0 +1,114 @@
+package config
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const CONFIG_TOML = `# defaults
+palette = [
+    "#000000", # background
+    '#FFFFFF',
+]
+scale = 8.5
+ips = 1_000
+quirks = "chip48"
+states = "/tmp/states"
+layout = "qwerty"
+
+[keymap]
+1 = "1"
+C = "4"
+"4" = ["Q", 'UP']
+
+[audio]
+mute = true
+freq = 440
+`
+
+func TestUnmarshalTOML(t *testing.T) {
+	var cfg Config
+	err := UnmarshalTOML([]byte(CONFIG_TOML), &cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := Config{
+		Palette: []string{"#000000", "#FFFFFF"},
+		Scale:   8.5,
+		Layout:  "qwerty",
+		Keymap:  map[string]Keys{"1": {"1"}, "C": {"4"}, "4": {"Q", "UP"}},
+		IPS:     1000,
+		Quirks:  "chip48",
+		States:  "/tmp/states",
+		Audio:   Audio{Mute: true, Freq: 440},
+	}
+	if !reflect.DeepEqual(cfg, want) {
+		t.Fatalf("got %+v, want %+v", cfg, want)
+	}
+	if cfg.Ticks() != 17 {
+		t.Errorf("%d ticks, want 17", cfg.Ticks())
+	}
+
+	var buf bytes.Buffer
+	err = cfg.WriteTOML(&buf, map[string]string{"scale": "flag"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), "# flag") {
+		t.Errorf("note missing:\n%s", buf.String())
+	}
+	var again Config
+	err = UnmarshalTOML(buf.Bytes(), &again)
+	if err != nil {
+		t.Fatalf("%v\n%s", err, buf.String())
+	}
+	if !reflect.DeepEqual(again, want) {
+		t.Errorf("written config reads as %+v, want %+v", again, want)
+	}
+}
+
+func TestUnmarshalTOMLErrors(t *testing.T) {
+	for _, src := range []string{
+		`{"scael": 3}`,
+		`{"audo": {"mute": true}}`,
+		`{"audio": {"muted": true}}`,
+		`{"scale": 3} {}`,
+	} {
+		filePath := filepath.Join(t.TempDir(), "config.json")
+		err := os.WriteFile(filePath, []byte(src), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = Load(filePath)
+		if err == nil {
+			t.Errorf("%s: no error", src)
+		}
+	}
+
+	for _, src := range []string{
+		`scale = `,
+		`scale = 10 10`,
+		`scale = 010`,
+		`quirks = "vip`,
+		`quirks = "\q"`,
+		"scale = 1\nscale = 2",
+		`scale = "big"`,
+		"scale = 1\n[scale]",
+		`[audio`,
+		"[keymap]\n1 = 1",
+		"scael = 3",
+		"[audo]\nmute = true",
+		"[audio]\nmuted = true",
+	} {
+		var cfg Config
+		err := UnmarshalTOML([]byte(src), &cfg)
+		if err == nil {
+			t.Errorf("%q: no error", src)
+		}
+	}
+}
@@ -0,0 +1,321 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+/*
+   The TOML of the config files: comments, [tables], bare and quoted keys and
+   strings, integers, floats, booleans and arrays of them. Dotted keys, inline
+   tables, dates and multi-line strings are not supported.
+*/
+
+// UnmarshalTOML decodes a TOML document into v like encoding/json, by the
+// json tags of its fields.
+func UnmarshalTOML(data []byte, v interface{}) error {
+	doc, err := parseTOML(string(data))
+	if err != nil {
+		return err
+	}
+	// the tables are JSON objects, so json sets the fields and checks their types
+	js, err := json.Marshal(doc)
+	if err != nil {
+		return err
+	}
+	return unmarshalJSON(js, v)
+}
+
+type tomlParser struct {
+	src  string
+	pos  int
+	line int
+}
+
+func parseTOML(src string) (map[string]interface{}, error) {
+	p := &tomlParser{src: src, line: 1}
+	doc := make(map[string]interface{})
+	table := doc
+
+	for {
+		p.skipSpace(true)
+		if p.pos >= len(p.src) {
+			return doc, nil
+		}
+
+		if p.src[p.pos] == '[' {
+			p.pos++
+			t, err := p.table(doc)
+			if err != nil {
+				return nil, err
+			}
+			table = t
+		} else {
+			key, err := p.key()
+			if err != nil {
+				return nil, err
+			}
+			p.skipSpace(false)
+			if !p.consume('=') {
+				return nil, p.errorf("expected = after %q", key)
+			}
+			p.skipSpace(false)
+			value, err := p.value()
+			if err != nil {
+				return nil, err
+			}
+			if _, ok := table[key]; ok {
+				return nil, p.errorf("duplicate key %q", key)
+			}
+			table[key] = value
+		}
+
+		p.skipSpace(false)
+		if p.pos < len(p.src) && !p.consume('\n') {
+			return nil, p.errorf("unexpected %q", p.src[p.pos])
+		}
+	}
+}
+
+// table reads the name of a [table] header and returns the table.
+func (p *tomlParser) table(doc map[string]interface{}) (map[string]interface{}, error) {
+	table := doc
+	for {
+		p.skipSpace(false)
+		key, err := p.key()
+		if err != nil {
+			return nil, err
+		}
+		switch t := table[key].(type) {
+		case nil:
+			next := make(map[string]interface{})
+			table[key] = next
+			table = next
+		case map[string]interface{}:
+			table = t
+		default:
+			return nil, p.errorf("%q is not a table", key)
+		}
+
+		p.skipSpace(false)
+		if p.consume(']') {
+			return table, nil
+		}
+		if !p.consume('.') {
+			return nil, p.errorf("expected ] after table name")
+		}
+	}
+}
+
+func (p *tomlParser) key() (string, error) {
+	if p.pos < len(p.src) && (p.src[p.pos] == '"' || p.src[p.pos] == '\'') {
+		return p.string()
+	}
+	start := p.pos
+	for p.pos < len(p.src) && isBareKey(p.src[p.pos]) {
+		p.pos++
+	}
+	if p.pos == start {
+		return "", p.errorf("expected a key")
+	}
+	return p.src[start:p.pos], nil
+}
+
+func isBareKey(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_' || c == '-'
+}
+
+func (p *tomlParser) value() (interface{}, error) {
+	if p.pos >= len(p.src) {
+		return nil, p.errorf("expected a value")
+	}
+	switch p.src[p.pos] {
+	case '"', '\'':
+		return p.string()
+	case '[':
+		p.pos++
+		return p.array()
+	}
+
+	start := p.pos
+	for p.pos < len(p.src) && !strings.ContainsRune(" \t\r\n,]#", rune(p.src[p.pos])) {
+		p.pos++
+	}
+	s := p.src[start:p.pos]
+	switch s {
+	case "true":
+		return true, nil
+	case "false":
+		return false, nil
+	case "inf", "+inf", "-inf", "nan", "+nan", "-nan":
+		return nil, p.errorf("unsupported number %s", s)
+	}
+
+	num := strings.TrimPrefix(strings.Replace(s, "_", "", -1), "+")
+	digits := strings.TrimPrefix(num, "-")
+	if len(digits) > 1 && digits[0] == '0' && digits[1] >= '0' && digits[1] <= '9' {
+		return nil, p.errorf("leading zero in %s", s)
+	}
+	if strings.ContainsAny(digits, ".eE") && !strings.HasPrefix(digits, "0x") {
+		if f, err := strconv.ParseFloat(num, 64); err == nil && !math.IsInf(f, 0) {
+			return f, nil
+		}
+	} else if i, err := strconv.ParseInt(num, 0, 64); err == nil {
+		return i, nil
+	}
+	return nil, p.errorf("bad value %q", s)
+}
+
+func (p *tomlParser) array() ([]interface{}, error) {
+	values := []interface{}{}
+	for {
+		p.skipSpace(true)
+		if p.consume(']') {
+			return values, nil
+		}
+		value, err := p.value()
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, value)
+
+		p.skipSpace(true)
+		if p.consume(']') {
+			return values, nil
+		}
+		if !p.consume(',') {
+			return nil, p.errorf("expected , or ] in array")
+		}
+	}
+}
+
+// string reads a basic "string" with escapes or a literal 'string'.
+func (p *tomlParser) string() (string, error) {
+	quote := p.src[p.pos]
+	p.pos++
+	var b strings.Builder
+	for {
+		if p.pos >= len(p.src) || p.src[p.pos] == '\n' {
+			return "", p.errorf("unterminated string")
+		}
+		c := p.src[p.pos]
+		p.pos++
+		if c == quote {
+			return b.String(), nil
+		}
+		if c != '\\' || quote == '\'' {
+			b.WriteByte(c)
+			continue
+		}
+
+		if p.pos >= len(p.src) {
+			return "", p.errorf("unterminated string")
+		}
+		c = p.src[p.pos]
+		p.pos++
+		switch c {
+		case '"', '\\':
+			b.WriteByte(c)
+		case 'b':
+			b.WriteByte('\b')
+		case 't':
+			b.WriteByte('\t')
+		case 'n':
+			b.WriteByte('\n')
+		case 'f':
+			b.WriteByte('\f')
+		case 'r':
+			b.WriteByte('\r')
+		case 'u', 'U':
+			n := 4
+			if c == 'U' {
+				n = 8
+			}
+			if p.pos+n > len(p.src) {
+				return "", p.errorf("bad escape \\%c", c)
+			}
+			r, err := strconv.ParseUint(p.src[p.pos:p.pos+n], 16, 32)
+			if err != nil || !utf8.ValidRune(rune(r)) {
+				return "", p.errorf("bad escape \\%c%s", c, p.src[p.pos:p.pos+n])
+			}
+			p.pos += n
+			b.WriteRune(rune(r))
+		default:
+			return "", p.errorf("bad escape \\%c", c)
+		}
+	}
+}
+
+// skipSpace skips blanks and comments, and newlines if lines is set.
+func (p *tomlParser) skipSpace(lines bool) {
+	for p.pos < len(p.src) {
+		switch p.src[p.pos] {
+		case ' ', '\t', '\r':
+			p.pos++
+		case '\n':
+			if !lines {
+				return
+			}
+			p.line++
+			p.pos++
+		case '#':
+			for p.pos < len(p.src) && p.src[p.pos] != '\n' {
+				p.pos++
+			}
+		default:
+			return
+		}
+	}
+}
+
+func (p *tomlParser) consume(c byte) bool {
+	if p.pos < len(p.src) && p.src[p.pos] == c {
+		if c == '\n' {
+			p.line++
+		}
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *tomlParser) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("line %d: %s", p.line, fmt.Sprintf(format, args...))
+}
+
+// tomlValue formats a string, number, bool or []string.
+func tomlValue(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return strconv.Quote(v)
+	case float64:
+		s := strconv.FormatFloat(v, 'f', -1, 64)
+		if !strings.Contains(s, ".") {
+			s += ".0"
+		}
+		return s
+	case []string:
+		quoted := make([]string, len(v))
+		for i, s := range v {
+			quoted[i] = strconv.Quote(s)
+		}
+		return "[" + strings.Join(quoted, ", ") + "]"
+	}
+	return fmt.Sprint(value)
+}
+
+func tomlKey(key string) string {
+	for i := 0; i < len(key); i++ {
+		if !isBareKey(key[i]) {
+			return strconv.Quote(key)
+		}
+	}
+	if key == "" {
+		return `""`
+	}
+	return key
+}
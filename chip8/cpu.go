@@ -1,221 +1,360 @@
-package chip8
-
-import (
-	"encoding/hex"
-	"fmt"
-	"log"
-	"math/rand"
-	"os"
-	"time"
-
-	"github.com/ministergoose/chip8-emu-go/chip8/hardware"
-	"github.com/ministergoose/chip8-emu-go/chip8/hardware/empty"
-)
-
-const (
-	MEMORY_SIZE        = 4096
-	SPRITE_ADDR uint16 = 0x00
-	START_ADDR  uint16 = 0x200
-	IPS         int    = 700 // instr per second
-)
-
-var SPRITES []byte = []byte{
-	0xF0, 0x90, 0x90, 0x90, 0xF0, // 0
-	0x20, 0x60, 0x20, 0x20, 0x70, // 1
-	0xF0, 0x10, 0xF0, 0x80, 0xF0, // 2
-	0xF0, 0x10, 0xF0, 0x10, 0xF0, // 3
-	0x90, 0x90, 0xF0, 0x10, 0x10, // 4
-	0xF0, 0x80, 0xF0, 0x10, 0xF0, // 5
-	0xF0, 0x80, 0xF0, 0x90, 0xF0, // 6
-	0xF0, 0x10, 0x20, 0x40, 0x40, // 7
-	0xF0, 0x90, 0xF0, 0x90, 0xF0, // 8
-	0xF0, 0x90, 0xF0, 0x10, 0xF0, // 9
-	0xF0, 0x90, 0xF0, 0x90, 0x90, // A
-	0xE0, 0x90, 0xE0, 0x90, 0xE0, // B
-	0xF0, 0x80, 0x80, 0x80, 0xF0, // C
-	0xE0, 0x90, 0x90, 0x90, 0xE0, // D
-	0xF0, 0x80, 0xF0, 0x80, 0xF0, // E
-	0xF0, 0x80, 0xF0, 0x80, 0x80, // F
-}
-
-type InsFunc func(op uint16) (string, error)
-
-type Opcode struct {
-	Result uint16
-	Mask   uint16
-	f      InsFunc
-}
-
-type Cpu struct {
-	v       [16]byte
-	i       uint16
-	cnt     uint16
-	memory  [MEMORY_SIZE]byte
-	stack   Stack
-	display hardware.Display
-	sound   hardware.Sound
-
-	keyboard hardware.Keyboard
-	kbrd     uint16
-
-	timerDelay byte
-	timerSound byte
-
-	Opcodes []Opcode
-	Debug   bool
-}
-
-func (c *Cpu) RunInst(inst uint16) (string, error) {
-	for _, x := range c.Opcodes {
-		if (inst & x.Mask) == x.Result {
-			return x.f(inst)
-		}
-	}
-
-	return fmt.Sprintf("Unk: 0x%04X", inst), fmt.Errorf("unknown opcode: 0x%04X", inst)
-}
-
-func (c *Cpu) Load(filePath string) error {
-	data, err := os.ReadFile(filePath)
-	if err != nil {
-		return err
-	}
-
-	fsize := len(data)
-
-	if fsize > MEMORY_SIZE-int(START_ADDR) {
-		return fmt.Errorf("program is too big! Length: %d", fsize)
-	}
-
-	if c.Debug {
-		fmt.Printf("Load %d bytes\n", fsize)
-		fmt.Print(hex.Dump(data))
-	}
-
-	c.DMA(START_ADDR, data, uint16(len(data)))
-
-	return nil
-}
-
-func (c *Cpu) Run() {
-	//frameTime := time.Second / 60
-	frameTime := time.Millisecond * 16
-
-	for !c.display.ShouldClose() {
-		c.kbrd = c.keyboard.ReadKeys()
-
-		start := time.Now()
-		for i := 0; i < (IPS / 60); i++ {
-			inst := uint16(uint16(c.memory[c.cnt])<<8) + uint16(c.memory[c.cnt+1])
-			c.cnt += 2
-			//str, err := c.RunInst(inst)
-			str, err := c.RunInstFast(inst)
-			if err != nil {
-				log.Println(err)
-			}
-			if c.Debug {
-				log.Println(str)
-			}
-		}
-		delayTime := frameTime - time.Since(start)
-
-		if delayTime > 0 {
-			time.Sleep(delayTime)
-		}
-
-		c.TimersTick()
-		c.display.Draw()
-	}
-
-}
-
-func (c *Cpu) Reset() {
-	for i := START_ADDR; i < MEMORY_SIZE; i++ {
-		c.memory[i] = 0
-	}
-
-	for i := 0; i <= 15; i++ {
-		c.v[i] = 0
-	}
-
-	c.display.Cls()
-	c.stack.Reset()
-
-	c.i = 0
-	c.cnt = START_ADDR
-	c.timerDelay = 0
-	c.timerSound = 0
-}
-
-func (c *Cpu) checkAddr(addr uint16) error {
-	if addr >= MEMORY_SIZE {
-		return fmt.Errorf("bad address: %03x", addr)
-	}
-
-	return nil
-}
-
-func (c *Cpu) DMA(destPos uint16, src []byte, length uint16) {
-	for i := uint16(0); i < length; i++ {
-		c.memory[i+destPos] = src[i]
-	}
-}
-
-func (c *Cpu) PrintDebug() {
-	fmt.Println("   | 0| 1| 2| 3| 4| 5| 6| 7| 8| 9| A| B| C| D| E| F|")
-	fmt.Print(" v |")
-	for _, v := range c.v {
-		fmt.Printf("%02X|", v)
-	}
-	fmt.Println()
-}
-
-func (c *Cpu) TimersTick() {
-	if c.timerSound > 0 {
-		c.sound.Beep()
-		c.timerSound -= 1
-	}
-	if c.timerDelay > 0 {
-		c.timerDelay -= 1
-	}
-}
-
-func NewCPU(dspl hardware.Display, kbrd hardware.Keyboard, snd hardware.Sound) *Cpu {
-	rand.Seed(time.Now().UnixNano())
-
-	c := Cpu{display: dspl, keyboard: kbrd, sound: snd, stack: NewStackStd()}
-	c.InstructionsInit()
-	c.DMA(SPRITE_ADDR, SPRITES, uint16(len(SPRITES)))
-	c.Reset()
-
-	return &c
-}
-
-func Disassembler(filePath string) {
-	data, err := os.ReadFile(filePath)
-	if err != nil {
-		log.Fatal(err)
-	}
-
-	f, err := os.Create(fmt.Sprintf("%s.dis.txt", filePath))
-	if err != nil {
-		log.Fatal(err)
-	}
-	defer f.Close()
-
-	c := Cpu{display: empty.NewDisplayEmpty(), keyboard: empty.NewKeyboardEmpty(), sound: hardware.NewSoundStd(), stack: empty.NewStackEmpty()}
-	c.InstructionsInit()
-
-	fsize := len(data)
-
-	f.WriteString("Addr : [code] Asm\t\t; Desc\n")
-	for i := 0; i < fsize; i += 2 {
-		inst := uint16(uint16(data[i])<<8) + uint16(data[i+1])
-		str, err := c.RunInst(inst)
-		f.WriteString(fmt.Sprintf("%04Xh: [%04X] %s\n", (0x200 + i), inst, str))
-		if err != nil {
-			f.WriteString(fmt.Sprintf("%v\n", err))
-		}
-	}
-
-}
+package chip8
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/ministergoose/chip8-emu-go/chip8/hardware"
+	"github.com/ministergoose/chip8-emu-go/chip8/octo"
+	"github.com/ministergoose/chip8-emu-go/chip8/romdb"
+)
+
+const (
+	MEMORY_SIZE            = 4096
+	MEMORY_SIZE_XO         = 65536
+	SPRITE_ADDR     uint16 = 0x00
+	BIG_SPRITE_ADDR uint16 = 0x50
+	START_ADDR      uint16 = 0x200
+	IPS             int    = 700 // instr per second
+	RPL_SIZE               = 16
+	RPL_SIZE_SCHIP         = 8
+)
+
+var SPRITES []byte = []byte{
+	0xF0, 0x90, 0x90, 0x90, 0xF0, // 0
+	0x20, 0x60, 0x20, 0x20, 0x70, // 1
+	0xF0, 0x10, 0xF0, 0x80, 0xF0, // 2
+	0xF0, 0x10, 0xF0, 0x10, 0xF0, // 3
+	0x90, 0x90, 0xF0, 0x10, 0x10, // 4
+	0xF0, 0x80, 0xF0, 0x10, 0xF0, // 5
+	0xF0, 0x80, 0xF0, 0x90, 0xF0, // 6
+	0xF0, 0x10, 0x20, 0x40, 0x40, // 7
+	0xF0, 0x90, 0xF0, 0x90, 0xF0, // 8
+	0xF0, 0x90, 0xF0, 0x10, 0xF0, // 9
+	0xF0, 0x90, 0xF0, 0x90, 0x90, // A
+	0xE0, 0x90, 0xE0, 0x90, 0xE0, // B
+	0xF0, 0x80, 0x80, 0x80, 0xF0, // C
+	0xE0, 0x90, 0x90, 0x90, 0xE0, // D
+	0xF0, 0x80, 0xF0, 0x80, 0xF0, // E
+	0xF0, 0x80, 0xF0, 0x80, 0x80, // F
+}
+
+var BIG_SPRITES []byte = []byte{
+	0xFF, 0xFF, 0xC3, 0xC3, 0xC3, 0xC3, 0xC3, 0xC3, 0xFF, 0xFF, // 0
+	0x18, 0x78, 0x78, 0x18, 0x18, 0x18, 0x18, 0x18, 0xFF, 0xFF, // 1
+	0xFF, 0xFF, 0x03, 0x03, 0xFF, 0xFF, 0xC0, 0xC0, 0xFF, 0xFF, // 2
+	0xFF, 0xFF, 0x03, 0x03, 0xFF, 0xFF, 0x03, 0x03, 0xFF, 0xFF, // 3
+	0xC3, 0xC3, 0xC3, 0xC3, 0xFF, 0xFF, 0x03, 0x03, 0x03, 0x03, // 4
+	0xFF, 0xFF, 0xC0, 0xC0, 0xFF, 0xFF, 0x03, 0x03, 0xFF, 0xFF, // 5
+	0xFF, 0xFF, 0xC0, 0xC0, 0xFF, 0xFF, 0xC3, 0xC3, 0xFF, 0xFF, // 6
+	0xFF, 0xFF, 0x03, 0x03, 0x06, 0x0C, 0x18, 0x18, 0x18, 0x18, // 7
+	0xFF, 0xFF, 0xC3, 0xC3, 0xFF, 0xFF, 0xC3, 0xC3, 0xFF, 0xFF, // 8
+	0xFF, 0xFF, 0xC3, 0xC3, 0xFF, 0xFF, 0x03, 0x03, 0xFF, 0xFF, // 9
+	0x7E, 0xFF, 0xC3, 0xC3, 0xC3, 0xFF, 0xFF, 0xC3, 0xC3, 0xC3, // A
+	0xFC, 0xFC, 0xC3, 0xC3, 0xFC, 0xFC, 0xC3, 0xC3, 0xFC, 0xFC, // B
+	0x3C, 0xFF, 0xC3, 0xC0, 0xC0, 0xC0, 0xC0, 0xC3, 0xFF, 0x3C, // C
+	0xFC, 0xFE, 0xC3, 0xC3, 0xC3, 0xC3, 0xC3, 0xC3, 0xFE, 0xFC, // D
+	0xFF, 0xFF, 0xC0, 0xC0, 0xFF, 0xFF, 0xC0, 0xC0, 0xFF, 0xFF, // E
+	0xFF, 0xFF, 0xC0, 0xC0, 0xFF, 0xFF, 0xC0, 0xC0, 0xC0, 0xC0, // F
+}
+
+type Cpu struct {
+	v       [16]byte
+	i       uint16
+	cnt     uint16
+	memory  []byte
+	stack   Stack
+	display hardware.Display
+	sound   hardware.Sound
+
+	keyboard hardware.Keyboard
+	kbrd     uint16
+
+	timerDelay byte
+	timerSound byte
+
+	quirks     Quirks
+	waitVBlank bool
+	tickRate   int  // instructions per frame
+	frameInsts int  // instructions run of the current frame
+	midFrame   bool // a debugger stop interrupted the current frame
+
+	platform Platform
+	rpl      [RPL_SIZE]byte // SUPER-CHIP/XO-CHIP user flags
+	planes   byte           // XO-CHIP drawing planes
+	halted   bool
+
+	audioPattern *[hardware.PATTERN_SIZE]byte // XO-CHIP audio pattern, nil until F002
+	audioPitch   byte
+
+	romHash [sha1.Size]byte
+
+	Debug       bool // logs every instruction
+	interpreter Interpreter
+	blocks      blockCache
+	speed       speed
+	random      random
+
+	// OnFrame is called by Run before every frame, returning true skips the emulation of the frame.
+	OnFrame func(c *Cpu) bool
+	// Rewind keeps the last frames when not nil
+	Rewind *Rewind
+	// RomDB picks the settings of known ROMs in Load when not nil
+	RomDB *romdb.Database
+
+	debugger atomic.Value // *Debugger, set by NewDebugger and Detach
+}
+
+// Load loads a ROM file, Octo sources (.8o) are compiled first and
+// Octo cartridges (.gif) also bring their settings.
+func (c *Cpu) Load(filePath string) error {
+	if strings.EqualFold(filepath.Ext(filePath), ".8o") {
+		res, err := octo.CompileFile(filePath)
+		if err != nil {
+			return err
+		}
+		// the program needs a newer platform than the configured one
+		if p := Platform(res.Platform); p > c.platform {
+			c.SetPlatform(p)
+			c.SetQuirks(p.DefaultQuirks())
+		}
+		return c.LoadROM(res.ROM)
+	}
+
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return err
+	}
+	if octo.IsCartridge(data) {
+		return c.loadCartridge(filePath, data)
+	}
+	if c.RomDB != nil {
+		c.applyRomDB(data)
+	}
+	return c.LoadROM(data)
+}
+
+// LoadROM copies a program to START_ADDR.
+func (c *Cpu) LoadROM(data []byte) error {
+	fsize := len(data)
+
+	if fsize > len(c.memory)-int(START_ADDR) {
+		return fmt.Errorf("program is too big! Length: %d", fsize)
+	}
+
+	if c.Debug {
+		fmt.Printf("Load %d bytes\n", fsize)
+		fmt.Print(hex.Dump(data))
+	}
+
+	c.DMA(START_ADDR, data, uint16(len(data)))
+	c.romHash = sha1.Sum(data)
+
+	return nil
+}
+
+// Run emulates frames until the display is closed or the machine halts,
+// at the pace set by SetFastForward, SetUncapped and SetPaused.
+func (c *Cpu) Run() {
+	for !c.display.ShouldClose() && !c.halted {
+		if c.OnFrame != nil && c.OnFrame(c) {
+			c.display.Draw()
+			continue
+		}
+
+		start := time.Now()
+		if d := c.attached(); (d != nil && d.Paused()) || (c.speed.paused && !c.speed.advance) {
+			time.Sleep(FRAME_TIME)
+			c.display.Draw()
+			continue
+		}
+
+		c.runFrames(start)
+		c.display.Draw()
+
+		delayTime := FRAME_TIME - time.Since(start)
+
+		if delayTime > 0 {
+			time.Sleep(delayTime)
+		}
+	}
+
+}
+
+// ReadKeys takes the keys from the keyboard, RunFrame does it once per frame.
+func (c *Cpu) ReadKeys() {
+	c.kbrd = c.keyboard.ReadKeys()
+}
+
+// RunFrame emulates one frame without waiting for the next one:
+// reads the keys, runs the instructions of the frame, ticks the timers and draws.
+func (c *Cpu) RunFrame() {
+	c.emulateFrame()
+	c.display.Draw()
+}
+
+// emulateFrame is RunFrame without drawing. A frame that a debugger stop
+// interrupts carries on in the next call, the timers only tick at its end.
+func (c *Cpu) emulateFrame() {
+	if !c.midFrame {
+		c.ReadKeys()
+		c.frameInsts = 0
+		c.waitVBlank = false
+	}
+
+	// the debugger stays attached until the frame is done, Detach waits for it
+	d := c.attached()
+	d.lock()
+	c.midFrame = false
+	for c.frameInsts < c.tickRate && !c.waitVBlank && !c.halted {
+		if d != nil && d.check() {
+			c.midFrame = true
+			break
+		}
+		n, err := c.step(c.tickRate - c.frameInsts)
+		c.frameInsts += n
+		if err != nil {
+			log.Println(err)
+		}
+		if d != nil && d.stepped() {
+			c.midFrame = true
+			break
+		}
+	}
+	if c.midFrame && c.frameInsts < c.tickRate && !c.waitVBlank && !c.halted {
+		d.unlock()
+		return
+	}
+	c.midFrame = false
+
+	c.TimersTick()
+	c.speed.frames++
+
+	if c.Rewind != nil {
+		err := c.Rewind.Capture(c)
+		if err != nil {
+			log.Println(err)
+		}
+	}
+	d.unlock()
+}
+
+// Step fetches and executes one instruction.
+func (c *Cpu) Step() error {
+	pc := c.wrap(c.cnt)
+	in := Decode(uint16(c.memory[pc])<<8|uint16(c.memory[c.wrap(pc+1)]), c.platform)
+	c.cnt = pc + 2
+
+	if c.Debug {
+		log.Println(c.Trace(pc, in))
+	}
+
+	return c.Exec(in)
+}
+
+// Halt stops the Run loop.
+func (c *Cpu) Halt() {
+	c.halted = true
+}
+
+func (c *Cpu) Halted() bool {
+	return c.halted
+}
+
+func (c *Cpu) Reset() {
+	for i := int(START_ADDR); i < len(c.memory); i++ {
+		c.memory[i] = 0
+	}
+	c.flushBlocks()
+
+	for i := 0; i <= 15; i++ {
+		c.v[i] = 0
+	}
+
+	c.planes = 1
+	c.display.SetPlanes(c.planes)
+	c.display.SetHiRes(false)
+	c.stack.Reset()
+
+	c.i = 0
+	c.cnt = START_ADDR
+	c.timerDelay = 0
+	c.timerSound = 0
+	c.halted = false
+	c.midFrame = false
+	c.audioPattern = nil
+	c.audioPitch = hardware.DEFAULT_PITCH
+}
+
+func (c *Cpu) checkAddr(addr uint16) error {
+	if int(addr) >= len(c.memory) {
+		return fmt.Errorf("bad address: %03x", addr)
+	}
+
+	return nil
+}
+
+// wrap ignores the address bits above the memory size, like the VIP does.
+func (c *Cpu) wrap(addr uint16) uint16 {
+	return addr & uint16(len(c.memory)-1)
+}
+
+func (c *Cpu) read(addr uint16) byte {
+	addr = c.wrap(addr)
+	if d := c.attached(); d != nil {
+		d.access(addr, WATCH_READ)
+	}
+	return c.memory[addr]
+}
+
+func (c *Cpu) write(addr uint16, b byte) {
+	addr = c.wrap(addr)
+	if d := c.attached(); d != nil {
+		d.access(addr, WATCH_WRITE)
+	}
+	c.memory[addr] = b
+	if c.blocks.versions != nil {
+		c.blocks.versions[addr>>BLOCK_PAGE_BITS]++
+	}
+}
+
+func (c *Cpu) DMA(destPos uint16, src []byte, length uint16) {
+	for i := uint16(0); i < length; i++ {
+		c.memory[i+destPos] = src[i]
+	}
+	c.invalidate(destPos, int(length))
+}
+
+func (c *Cpu) PrintDebug() {
+	fmt.Println("   | 0| 1| 2| 3| 4| 5| 6| 7| 8| 9| A| B| C| D| E| F|")
+	fmt.Print(" v |")
+	for _, v := range c.v {
+		fmt.Printf("%02X|", v)
+	}
+	fmt.Println()
+}
+
+func (c *Cpu) TimersTick() {
+	if c.timerSound > 0 {
+		c.sound.Beep()
+		c.timerSound -= 1
+	}
+	if c.timerDelay > 0 {
+		c.timerDelay -= 1
+	}
+}
+
+func NewCPU(dspl hardware.Display, kbrd hardware.Keyboard, snd hardware.Sound, quirks Quirks) *Cpu {
+	c := Cpu{display: dspl, keyboard: kbrd, sound: snd, stack: NewStackStd(), quirks: quirks, tickRate: IPS / 60}
+	c.SetPlatform(PLATFORM_CHIP8)
+	c.Seed(uint64(time.Now().UnixNano()))
+
+	return &c
+}
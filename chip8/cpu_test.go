@@ -0,0 +1,66 @@
+package chip8
+
+import (
+	"io"
+	"log"
+	"os"
+	"testing"
+
+	"github.com/ministergoose/chip8-emu-go/chip8/hardware/headless"
+)
+
+// programs that access memory past its end, the addresses wrap around
+var WRAPPING map[string][]byte = map[string][]byte{
+	"store": {
+		0x61, 0xAB, // 200 LD V1, 0xAB
+		0xAF, 0xFF, // 202 LD I, 0xFFF
+		0xF1, 0x55, // 204 LD [I], V1, writes 0xFFF and 0x000
+		0x12, 0x06, // 206 JP 0x206
+	},
+	"sprite": {
+		0xAF, 0xFF, // 200 LD I, 0xFFF
+		0xD0, 0x05, // 202 DRW V0, V0, 5
+		0x12, 0x04, // 204 JP 0x204
+	},
+	"bcd": {
+		0x60, 0xFF, // 200 LD V0, 0xFF
+		0xAF, 0xFF, // 202 LD I, 0xFFF
+		0xF0, 0x33, // 204 LD B, V0, writes 0xFFF to 0x001
+		0x12, 0x06, // 206 JP 0x206
+	},
+	"pc": {
+		0x1F, 0xFE, // 200 JP 0xFFE, runs into 0x000 through the empty memory
+	},
+}
+
+func TestMemoryWraps(t *testing.T) {
+	// the font at 0x000 runs as unknown opcodes after the PC wraps
+	log.SetOutput(io.Discard)
+	defer log.SetOutput(os.Stderr)
+
+	for name, rom := range WRAPPING {
+		for _, i := range []Interpreter{INTERPRETER_STEP, INTERPRETER_BLOCKS} {
+			c := NewCPU(headless.NewDisplayHeadless(), headless.NewKeyboardHeadless(), headless.NewSoundHeadless(), QUIRKS_SCHIP)
+			c.SetInterpreter(i)
+			err := c.LoadROM(rom)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for frame := 0; frame < 10; frame++ {
+				c.RunFrame()
+			}
+
+			mem := c.ReadMemory(0, 2)
+			switch name {
+			case "store":
+				if m := c.ReadMemory(0xFFF, 1); m[0] != 0 || mem[0] != 0xAB {
+					t.Errorf("%s, %v: 0xFFF = 0x%02X, 0x000 = 0x%02X", name, i, m[0], mem[0])
+				}
+			case "bcd":
+				if mem[0] != 5 || mem[1] != 5 {
+					t.Errorf("%s, %v: 0x000 = 0x%02X, 0x001 = 0x%02X", name, i, mem[0], mem[1])
+				}
+			}
+		}
+	}
+}
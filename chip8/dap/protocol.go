@@ -0,0 +1,172 @@
+// Package dap implements a Debug Adapter Protocol server for the CHIP-8 debugger.
+package dap
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// MAX_CONTENT_LENGTH is the size limit of a message.
+const MAX_CONTENT_LENGTH = 1 << 20
+
+type Message struct {
+	Seq     int             `json:"seq"`
+	Type    string          `json:"type"`
+	Command string          `json:"command,omitempty"`
+	Event   string          `json:"event,omitempty"`
+	Args    json.RawMessage `json:"arguments,omitempty"`
+
+	RequestSeq int             `json:"request_seq,omitempty"`
+	Success    bool            `json:"success"`
+	ErrMessage string          `json:"message,omitempty"`
+	Body       json.RawMessage `json:"body,omitempty"`
+}
+
+// Conn reads and writes Content-Length framed DAP messages.
+type Conn struct {
+	r   *bufio.Reader
+	mu  sync.Mutex
+	w   io.Writer
+	seq int
+}
+
+func NewConn(r io.Reader, w io.Writer) *Conn {
+	return &Conn{r: bufio.NewReader(r), w: w}
+}
+
+func (c *Conn) Read() (*Message, error) {
+	hdr, err := textproto.NewReader(c.r).ReadMIMEHeader()
+	if err != nil {
+		return nil, err
+	}
+	length, err := strconv.Atoi(strings.TrimSpace(hdr.Get("Content-Length")))
+	if err != nil || length < 0 || length > MAX_CONTENT_LENGTH {
+		return nil, fmt.Errorf("bad Content-Length: %q", hdr.Get("Content-Length"))
+	}
+
+	data := make([]byte, length)
+	_, err = io.ReadFull(c.r, data)
+	if err != nil {
+		return nil, err
+	}
+
+	var msg Message
+	err = json.Unmarshal(data, &msg)
+	if err != nil {
+		return nil, err
+	}
+	return &msg, nil
+}
+
+// Write sends msg with the next sequence number.
+func (c *Conn) Write(msg *Message) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.seq++
+	msg.Seq = c.seq
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(c.w, "Content-Length: %d\r\n\r\n%s", len(data), data)
+	return err
+}
+
+func (c *Conn) Respond(req *Message, body interface{}, err error) error {
+	res := &Message{Type: "response", Command: req.Command, RequestSeq: req.Seq, Success: err == nil}
+	if err != nil {
+		res.ErrMessage = err.Error()
+	}
+	if body != nil {
+		data, jerr := json.Marshal(body)
+		if jerr != nil {
+			return jerr
+		}
+		res.Body = data
+	}
+	return c.Write(res)
+}
+
+func (c *Conn) SendEvent(event string, body interface{}) error {
+	msg := &Message{Type: "event", Event: event}
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		msg.Body = data
+	}
+	return c.Write(msg)
+}
+
+// Client is a minimal DAP client for scripting sessions against the server.
+type Client struct {
+	conn   *Conn
+	Events []*Message // events received while waiting for responses
+}
+
+func NewClient(r io.Reader, w io.Writer) *Client {
+	return &Client{conn: NewConn(r, w)}
+}
+
+// Request sends a request and waits for its response, collecting events meanwhile.
+func (c *Client) Request(command string, args interface{}) (*Message, error) {
+	req := &Message{Type: "request", Command: command}
+	if args != nil {
+		data, err := json.Marshal(args)
+		if err != nil {
+			return nil, err
+		}
+		req.Args = data
+	}
+	err := c.conn.Write(req)
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		msg, err := c.conn.Read()
+		if err != nil {
+			return nil, err
+		}
+		if msg.Type == "event" {
+			c.Events = append(c.Events, msg)
+			continue
+		}
+		if msg.Type == "response" && msg.RequestSeq == req.Seq {
+			if !msg.Success {
+				return msg, fmt.Errorf("%s: %s", command, msg.ErrMessage)
+			}
+			return msg, nil
+		}
+	}
+}
+
+// WaitEvent returns the first collected or incoming event with the given name.
+func (c *Client) WaitEvent(event string) (*Message, error) {
+	for i, msg := range c.Events {
+		if msg.Event == event {
+			c.Events = append(c.Events[:i], c.Events[i+1:]...)
+			return msg, nil
+		}
+	}
+	for {
+		msg, err := c.conn.Read()
+		if err != nil {
+			return nil, err
+		}
+		if msg.Type == "event" && msg.Event == event {
+			return msg, nil
+		}
+		if msg.Type == "event" {
+			c.Events = append(c.Events, msg)
+		}
+	}
+}
@@ -0,0 +1,727 @@
+package dap
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/ministergoose/chip8-emu-go/chip8"
+	"github.com/ministergoose/chip8-emu-go/chip8/octo"
+	"github.com/ministergoose/chip8-emu-go/chip8/srcmap"
+)
+
+const (
+	THREAD_ID = 1
+
+	REF_REGISTERS = 1
+	REF_TIMERS    = 2
+	REF_MEMORY    = 3
+	REF_PAGE      = 0x100 // + page number, 256 bytes per page
+	PAGE_SIZE     = 0x100
+	ROW_SIZE      = 16
+)
+
+type LaunchArgs struct {
+	Program     string `json:"program"`
+	SourceMap   string `json:"sourceMap"` // assembler listing or Octo symbol file
+	StopOnEntry bool   `json:"stopOnEntry"`
+	Platform    string `json:"platform"`
+	Quirks      string `json:"quirks"`
+}
+
+type Source struct {
+	Name string `json:"name,omitempty"`
+	Path string `json:"path,omitempty"`
+}
+
+type Breakpoint struct {
+	Id                   int     `json:"id,omitempty"`
+	Verified             bool    `json:"verified"`
+	Line                 int     `json:"line,omitempty"`
+	Source               *Source `json:"source,omitempty"`
+	InstructionReference string  `json:"instructionReference,omitempty"`
+	Message              string  `json:"message,omitempty"`
+}
+
+type StackFrame struct {
+	Id                          int     `json:"id"`
+	Name                        string  `json:"name"`
+	Source                      *Source `json:"source,omitempty"`
+	Line                        int     `json:"line"`
+	Column                      int     `json:"column"`
+	InstructionPointerReference string  `json:"instructionPointerReference,omitempty"`
+}
+
+type Variable struct {
+	Name               string `json:"name"`
+	Value              string `json:"value"`
+	VariablesReference int    `json:"variablesReference"`
+	MemoryReference    string `json:"memoryReference,omitempty"`
+}
+
+type Server struct {
+	conn *Conn
+	cpu  *chip8.Cpu
+	dbg  *chip8.Debugger
+
+	srcmap    *srcmap.SourceMap
+	mapDir    string
+	sourceBps map[string][]uint16
+	instrBps  []uint16
+	dataBps   []chip8.Watchpoint
+	bpId      int
+
+	launch       LaunchArgs
+	launched     chan struct{}
+	launchedOnce sync.Once
+
+	mu sync.Mutex // guards instrBps, read by the event pump
+}
+
+// NewServer creates a server driving cpu, the caller runs cpu.Run after Launched.
+func NewServer(cpu *chip8.Cpu) *Server {
+	return &Server{cpu: cpu, srcmap: srcmap.New(), sourceBps: map[string][]uint16{}, launched: make(chan struct{})}
+}
+
+// Launched is closed when the client has launched the program.
+func (s *Server) Launched() <-chan struct{} {
+	return s.launched
+}
+
+// Terminated reports the end of the program to the client.
+func (s *Server) Terminated() {
+	if s.conn == nil {
+		return
+	}
+	s.conn.SendEvent("exited", map[string]int{"exitCode": 0})
+	s.conn.SendEvent("terminated", nil)
+}
+
+func (s *Server) Serve(r io.Reader, w io.Writer) error {
+	s.conn = NewConn(r, w)
+	for {
+		msg, err := s.conn.Read()
+		if err != nil {
+			if err == io.EOF {
+				s.cpu.Halt()
+				return nil
+			}
+			return err
+		}
+		if msg.Type != "request" {
+			continue
+		}
+
+		done, err := s.handle(msg)
+		if err != nil {
+			return err
+		}
+		if done {
+			return nil
+		}
+	}
+}
+
+func (s *Server) handle(req *Message) (bool, error) {
+	var body interface{}
+	var err error
+
+	switch req.Command {
+	case "initialize", "launch", "disconnect", "terminate", "setExceptionBreakpoints":
+	default:
+		if s.dbg == nil {
+			return false, s.conn.Respond(req, nil, fmt.Errorf("%s: program not launched", req.Command))
+		}
+	}
+
+	switch req.Command {
+	case "initialize":
+		body = map[string]interface{}{
+			"supportsConfigurationDoneRequest": true,
+			"supportsSetVariable":              true,
+			"supportsReadMemoryRequest":        true,
+			"supportsWriteMemoryRequest":       true,
+			"supportsInstructionBreakpoints":   true,
+			"supportsDataBreakpoints":          true,
+			"supportsEvaluateForHovers":        true,
+		}
+		err = s.conn.Respond(req, body, nil)
+		if err != nil {
+			return false, err
+		}
+		return false, s.conn.SendEvent("initialized", nil)
+	case "launch":
+		err = s.doLaunch(req)
+	case "setBreakpoints":
+		body, err = s.setBreakpoints(req)
+	case "setInstructionBreakpoints":
+		body, err = s.setInstructionBreakpoints(req)
+	case "setExceptionBreakpoints":
+		body = map[string]interface{}{"breakpoints": []Breakpoint{}}
+	case "dataBreakpointInfo":
+		body, err = s.dataBreakpointInfo(req)
+	case "setDataBreakpoints":
+		body, err = s.setDataBreakpoints(req)
+	case "configurationDone":
+		err = s.conn.Respond(req, nil, nil)
+		if err != nil {
+			return false, err
+		}
+		s.start()
+		return false, nil
+	case "threads":
+		body = map[string]interface{}{"threads": []map[string]interface{}{{"id": THREAD_ID, "name": "chip8"}}}
+	case "stackTrace":
+		body = s.stackTrace()
+	case "scopes":
+		body = map[string]interface{}{"scopes": []map[string]interface{}{
+			{"name": "Registers", "variablesReference": REF_REGISTERS, "expensive": false},
+			{"name": "Timers", "variablesReference": REF_TIMERS, "expensive": false},
+			{"name": "Memory", "variablesReference": REF_MEMORY, "expensive": true},
+		}}
+	case "variables":
+		body, err = s.variables(req)
+	case "setVariable":
+		body, err = s.setVariable(req)
+	case "evaluate":
+		body, err = s.evaluate(req)
+	case "readMemory":
+		body, err = s.readMemory(req)
+	case "writeMemory":
+		body, err = s.writeMemory(req)
+	case "continue":
+		s.dbg.Continue()
+		body = map[string]interface{}{"allThreadsContinued": true}
+	case "next":
+		s.dbg.StepOver()
+	case "stepIn":
+		s.dbg.StepInto()
+	case "stepOut":
+		s.dbg.StepOut()
+	case "pause":
+		s.dbg.Pause()
+	case "disconnect", "terminate":
+		s.cpu.Halt()
+		if s.dbg != nil {
+			s.dbg.Continue()
+		}
+		return true, s.conn.Respond(req, nil, nil)
+	default:
+		err = fmt.Errorf("unsupported request: %s", req.Command)
+	}
+
+	return false, s.conn.Respond(req, body, err)
+}
+
+func (s *Server) doLaunch(req *Message) error {
+	err := json.Unmarshal(req.Args, &s.launch)
+	if err != nil {
+		return err
+	}
+	if s.launch.Program == "" {
+		return fmt.Errorf("no program to launch")
+	}
+
+	if s.launch.Platform != "" {
+		p, ok := chip8.PLATFORMS[s.launch.Platform]
+		if !ok {
+			return fmt.Errorf("unknown platform: %s", s.launch.Platform)
+		}
+		s.cpu.SetPlatform(p)
+	}
+	if s.launch.Quirks != "" {
+		q, ok := chip8.QUIRK_PRESETS[s.launch.Quirks]
+		if !ok {
+			return fmt.Errorf("unknown quirks preset: %s", s.launch.Quirks)
+		}
+		s.cpu.SetQuirks(q)
+	}
+
+	err = s.cpu.Load(s.launch.Program)
+	if err != nil {
+		return err
+	}
+
+	if s.launch.SourceMap == "" {
+		s.launch.SourceMap = defaultSourceMap(s.launch.Program)
+	}
+	if s.launch.SourceMap == "" && strings.EqualFold(filepath.Ext(s.launch.Program), ".8o") {
+		// the compiler knows the source lines of the program it just loaded
+		res, err := octo.CompileFile(s.launch.Program)
+		if err != nil {
+			return err
+		}
+		s.srcmap = res.SourceMap()
+	}
+	if s.launch.SourceMap != "" {
+		m, err := srcmap.Load(s.launch.SourceMap)
+		if err != nil {
+			return err
+		}
+		s.srcmap = m
+		s.mapDir = filepath.Dir(s.launch.SourceMap)
+	}
+
+	s.dbg = chip8.NewDebugger(s.cpu)
+	s.dbg.Pause()
+	<-s.dbg.Events()
+	go s.pumpEvents()
+
+	return nil
+}
+
+// defaultSourceMap looks for a symbol file or listing next to the ROM.
+func defaultSourceMap(program string) string {
+	base := strings.TrimSuffix(program, filepath.Ext(program))
+	for _, ext := range []string{".sym", ".lst", ".map"} {
+		_, err := os.Stat(base + ext)
+		if err == nil {
+			return base + ext
+		}
+	}
+	return ""
+}
+
+// start lets the program run once the client is configured.
+func (s *Server) start() {
+	if s.dbg == nil {
+		return
+	}
+	if s.launch.StopOnEntry {
+		s.conn.SendEvent("stopped", map[string]interface{}{"reason": "entry", "threadId": THREAD_ID, "allThreadsStopped": true})
+	} else {
+		s.dbg.Continue()
+	}
+	s.launchedOnce.Do(func() { close(s.launched) })
+}
+
+func (s *Server) pumpEvents() {
+	for ev := range s.dbg.Events() {
+		body := map[string]interface{}{"threadId": THREAD_ID, "allThreadsStopped": true}
+		switch ev.Reason {
+		case chip8.STOP_BREAKPOINT:
+			body["reason"] = "breakpoint"
+			s.mu.Lock()
+			for _, addr := range s.instrBps {
+				if addr == ev.PC {
+					body["reason"] = "instruction breakpoint"
+				}
+			}
+			s.mu.Unlock()
+		case chip8.STOP_WATCHPOINT:
+			body["reason"] = "data breakpoint"
+			body["description"] = fmt.Sprintf("memory access at 0x%03X", ev.Addr)
+		case chip8.STOP_CONDITION:
+			body["reason"] = "breakpoint"
+			body["description"] = ev.Cond.String()
+		case chip8.STOP_STEP:
+			body["reason"] = "step"
+		default:
+			body["reason"] = "pause"
+		}
+		s.conn.SendEvent("stopped", body)
+	}
+}
+
+func (s *Server) sourcePath(file string) string {
+	if filepath.IsAbs(file) || s.mapDir == "" {
+		return file
+	}
+	return filepath.Join(s.mapDir, file)
+}
+
+func (s *Server) location(addr uint16) (*Source, int) {
+	l, ok := s.srcmap.Lookup(addr)
+	if !ok {
+		return nil, 0
+	}
+	path := s.sourcePath(l.File)
+	return &Source{Name: filepath.Base(path), Path: path}, l.Line
+}
+
+// syncBreakpoints sets the union of source and instruction breakpoints on the debugger.
+func (s *Server) syncBreakpoints() {
+	if s.dbg == nil {
+		return
+	}
+	for _, addr := range s.dbg.Breakpoints() {
+		s.dbg.RemoveBreakpoint(addr)
+	}
+	for _, addrs := range s.sourceBps {
+		for _, addr := range addrs {
+			s.dbg.AddBreakpoint(addr)
+		}
+	}
+	for _, addr := range s.instrBps {
+		s.dbg.AddBreakpoint(addr)
+	}
+}
+
+func (s *Server) setBreakpoints(req *Message) (interface{}, error) {
+	var args struct {
+		Source      Source `json:"source"`
+		Breakpoints []struct {
+			Line int `json:"line"`
+		} `json:"breakpoints"`
+	}
+	err := json.Unmarshal(req.Args, &args)
+	if err != nil {
+		return nil, err
+	}
+
+	var addrs []uint16
+	res := []Breakpoint{}
+	for _, bp := range args.Breakpoints {
+		s.bpId++
+		b := Breakpoint{Id: s.bpId, Line: bp.Line, Source: &args.Source}
+		found := s.srcmap.Addrs(args.Source.Path, bp.Line)
+		if len(found) > 0 {
+			b.Verified = true
+			b.InstructionReference = fmt.Sprintf("0x%03X", found[0])
+			addrs = append(addrs, found[0])
+		} else {
+			b.Message = "no code at this line"
+		}
+		res = append(res, b)
+	}
+	s.sourceBps[args.Source.Path] = addrs
+	s.syncBreakpoints()
+
+	return map[string]interface{}{"breakpoints": res}, nil
+}
+
+func (s *Server) setInstructionBreakpoints(req *Message) (interface{}, error) {
+	var args struct {
+		Breakpoints []struct {
+			InstructionReference string `json:"instructionReference"`
+			Offset               int    `json:"offset"`
+		} `json:"breakpoints"`
+	}
+	err := json.Unmarshal(req.Args, &args)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.instrBps = nil
+	res := []Breakpoint{}
+	for _, bp := range args.Breakpoints {
+		s.bpId++
+		b := Breakpoint{Id: s.bpId, InstructionReference: bp.InstructionReference}
+		addr, err := chip8.ParseValue(bp.InstructionReference)
+		if err == nil {
+			addr += uint16(bp.Offset)
+			b.Verified = true
+			s.instrBps = append(s.instrBps, addr)
+		} else {
+			b.Message = err.Error()
+		}
+		res = append(res, b)
+	}
+	s.syncBreakpoints()
+
+	return map[string]interface{}{"breakpoints": res}, nil
+}
+
+// dataBreakpointInfo offers watchpoints on the memory rows, the data id is "addr/len".
+func (s *Server) dataBreakpointInfo(req *Message) (interface{}, error) {
+	var args struct {
+		VariablesReference int    `json:"variablesReference"`
+		Name               string `json:"name"`
+	}
+	err := json.Unmarshal(req.Args, &args)
+	if err != nil {
+		return nil, err
+	}
+
+	if args.VariablesReference >= REF_PAGE {
+		addr, err := chip8.ParseValue(args.Name)
+		if err == nil {
+			return map[string]interface{}{
+				"dataId":      fmt.Sprintf("0x%03X/%d", addr, ROW_SIZE),
+				"description": fmt.Sprintf("memory %s..0x%03X", args.Name, int(addr)+ROW_SIZE-1),
+				"accessTypes": []string{"read", "write", "readWrite"},
+			}, nil
+		}
+	}
+	return map[string]interface{}{"dataId": nil, "description": "not a memory row"}, nil
+}
+
+func (s *Server) setDataBreakpoints(req *Message) (interface{}, error) {
+	var args struct {
+		Breakpoints []struct {
+			DataId     string `json:"dataId"`
+			AccessType string `json:"accessType"`
+		} `json:"breakpoints"`
+	}
+	err := json.Unmarshal(req.Args, &args)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, w := range s.dataBps {
+		s.dbg.RemoveWatchpoint(w)
+	}
+	s.dataBps = nil
+
+	res := []Breakpoint{}
+	for _, bp := range args.Breakpoints {
+		s.bpId++
+		b := Breakpoint{Id: s.bpId}
+		parts := strings.SplitN(bp.DataId, "/", 2)
+		addr, err1 := chip8.ParseValue(parts[0])
+		length := 1
+		var err2 error
+		if len(parts) == 2 {
+			length, err2 = strconv.Atoi(parts[1])
+		}
+		if err1 != nil || err2 != nil {
+			b.Message = "bad data id: " + bp.DataId
+			res = append(res, b)
+			continue
+		}
+
+		kind := chip8.WATCH_WRITE
+		switch bp.AccessType {
+		case "read":
+			kind = chip8.WATCH_READ
+		case "readWrite":
+			kind = chip8.WATCH_ACCESS
+		}
+		w := chip8.Watchpoint{Addr: addr, Len: uint16(length), Kind: kind}
+		s.dbg.AddWatchpoint(w)
+		s.dataBps = append(s.dataBps, w)
+		b.Verified = true
+		res = append(res, b)
+	}
+
+	return map[string]interface{}{"breakpoints": res}, nil
+}
+
+func (s *Server) frame(id int, addr uint16) StackFrame {
+	name, ok := s.srcmap.Symbol(addr)
+	if !ok {
+		name = fmt.Sprintf("0x%03X", addr)
+	}
+	f := StackFrame{Id: id, Name: name, Column: 1, InstructionPointerReference: fmt.Sprintf("0x%03X", addr)}
+	f.Source, f.Line = s.location(addr)
+	return f
+}
+
+// stackTrace reports the PC and the CALL sites of the return addresses on the stack.
+func (s *Server) stackTrace() interface{} {
+	regs := s.dbg.Registers()
+	stack := s.dbg.CallStack()
+
+	frames := []StackFrame{s.frame(0, regs.PC)}
+	for i := len(stack) - 1; i >= 0; i-- {
+		frames = append(frames, s.frame(len(frames), stack[i]-2))
+	}
+
+	return map[string]interface{}{"stackFrames": frames, "totalFrames": len(frames)}
+}
+
+func (s *Server) variables(req *Message) (interface{}, error) {
+	var args struct {
+		VariablesReference int `json:"variablesReference"`
+	}
+	err := json.Unmarshal(req.Args, &args)
+	if err != nil {
+		return nil, err
+	}
+
+	regs := s.dbg.Registers()
+	vars := []Variable{}
+	switch ref := args.VariablesReference; {
+	case ref == REF_REGISTERS:
+		for reg := chip8.REG_V0; reg <= chip8.REG_SP; reg++ {
+			v := Variable{Name: reg.String(), Value: fmt.Sprintf("0x%02X", regs.Get(reg))}
+			if reg == chip8.REG_I || reg == chip8.REG_PC {
+				v.Value = fmt.Sprintf("0x%03X", regs.Get(reg))
+				v.MemoryReference = v.Value
+			}
+			vars = append(vars, v)
+		}
+	case ref == REF_TIMERS:
+		vars = append(vars, Variable{Name: "DT", Value: strconv.Itoa(int(regs.DT))})
+		vars = append(vars, Variable{Name: "ST", Value: strconv.Itoa(int(regs.ST))})
+	case ref == REF_MEMORY:
+		size := 0
+		s.dbg.Exec(func(c *chip8.Cpu) { size = c.MemorySize() })
+		for page := 0; page < size/PAGE_SIZE; page++ {
+			addr := page * PAGE_SIZE
+			vars = append(vars, Variable{
+				Name:               fmt.Sprintf("0x%04X", addr),
+				Value:              fmt.Sprintf("0x%04X..0x%04X", addr, addr+PAGE_SIZE-1),
+				VariablesReference: REF_PAGE + page,
+				MemoryReference:    fmt.Sprintf("0x%04X", addr),
+			})
+		}
+	case ref >= REF_PAGE:
+		base := uint16((ref - REF_PAGE) * PAGE_SIZE)
+		mem := s.dbg.ReadMemory(base, PAGE_SIZE)
+		for row := 0; row+ROW_SIZE <= len(mem); row += ROW_SIZE {
+			hex := make([]string, ROW_SIZE)
+			for i := range hex {
+				hex[i] = fmt.Sprintf("%02X", mem[row+i])
+			}
+			vars = append(vars, Variable{
+				Name:            fmt.Sprintf("0x%04X", int(base)+row),
+				Value:           strings.Join(hex, " "),
+				MemoryReference: fmt.Sprintf("0x%04X", int(base)+row),
+			})
+		}
+	default:
+		return nil, fmt.Errorf("unknown variables reference: %d", ref)
+	}
+
+	return map[string]interface{}{"variables": vars}, nil
+}
+
+func (s *Server) setVariable(req *Message) (interface{}, error) {
+	var args struct {
+		VariablesReference int    `json:"variablesReference"`
+		Name               string `json:"name"`
+		Value              string `json:"value"`
+	}
+	err := json.Unmarshal(req.Args, &args)
+	if err != nil {
+		return nil, err
+	}
+
+	if args.VariablesReference >= REF_PAGE {
+		addr, err := chip8.ParseValue(args.Name)
+		if err != nil {
+			return nil, err
+		}
+		var data []byte
+		for _, f := range strings.Fields(args.Value) {
+			b, err := strconv.ParseUint(f, 16, 8)
+			if err != nil {
+				return nil, err
+			}
+			data = append(data, byte(b))
+		}
+		err = s.dbg.WriteMemory(addr, data)
+		if err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{"value": args.Value}, nil
+	}
+
+	reg, err := chip8.ParseReg(args.Name)
+	if err != nil {
+		return nil, err
+	}
+	val, err := chip8.ParseValue(args.Value)
+	if err != nil {
+		return nil, err
+	}
+	err = s.dbg.SetRegister(reg, val)
+	if err != nil {
+		return nil, err
+	}
+
+	return map[string]interface{}{"value": args.Value}, nil
+}
+
+// evaluate supports register names, labels and [addr] memory bytes.
+func (s *Server) evaluate(req *Message) (interface{}, error) {
+	var args struct {
+		Expression string `json:"expression"`
+	}
+	err := json.Unmarshal(req.Args, &args)
+	if err != nil {
+		return nil, err
+	}
+	expr := strings.TrimSpace(args.Expression)
+
+	if reg, err := chip8.ParseReg(expr); err == nil {
+		regs := s.dbg.Registers()
+		return map[string]interface{}{"result": fmt.Sprintf("0x%02X", regs.Get(reg)), "variablesReference": 0}, nil
+	}
+	if addr, ok := s.srcmap.Labels[expr]; ok {
+		return map[string]interface{}{"result": fmt.Sprintf("0x%03X", addr), "variablesReference": 0, "memoryReference": fmt.Sprintf("0x%03X", addr)}, nil
+	}
+	if strings.HasPrefix(expr, "[") && strings.HasSuffix(expr, "]") {
+		addr, err := chip8.ParseValue(strings.TrimSpace(expr[1 : len(expr)-1]))
+		if err != nil {
+			return nil, err
+		}
+		mem := s.dbg.ReadMemory(addr, 1)
+		if len(mem) == 0 {
+			return nil, fmt.Errorf("bad address: %s", expr)
+		}
+		return map[string]interface{}{"result": fmt.Sprintf("0x%02X", mem[0]), "variablesReference": 0}, nil
+	}
+
+	return nil, fmt.Errorf("cannot evaluate: %s", expr)
+}
+
+func (s *Server) readMemory(req *Message) (interface{}, error) {
+	var args struct {
+		MemoryReference string `json:"memoryReference"`
+		Offset          int    `json:"offset"`
+		Count           int    `json:"count"`
+	}
+	err := json.Unmarshal(req.Args, &args)
+	if err != nil {
+		return nil, err
+	}
+	addr, err := chip8.ParseValue(args.MemoryReference)
+	if err != nil {
+		return nil, err
+	}
+	size := 0
+	s.dbg.Exec(func(c *chip8.Cpu) { size = c.MemorySize() })
+	if args.Count < 0 || args.Count > size {
+		return nil, fmt.Errorf("bad count: %d", args.Count)
+	}
+
+	start := int(addr) + args.Offset
+	if start < 0 || start > 0xffff {
+		return map[string]interface{}{"address": fmt.Sprintf("0x%X", start), "unreadableBytes": args.Count}, nil
+	}
+	mem := s.dbg.ReadMemory(uint16(start), args.Count)
+
+	return map[string]interface{}{
+		"address":         fmt.Sprintf("0x%04X", start),
+		"data":            base64.StdEncoding.EncodeToString(mem),
+		"unreadableBytes": args.Count - len(mem),
+	}, nil
+}
+
+func (s *Server) writeMemory(req *Message) (interface{}, error) {
+	var args struct {
+		MemoryReference string `json:"memoryReference"`
+		Offset          int    `json:"offset"`
+		Data            string `json:"data"`
+	}
+	err := json.Unmarshal(req.Args, &args)
+	if err != nil {
+		return nil, err
+	}
+	addr, err := chip8.ParseValue(args.MemoryReference)
+	if err != nil {
+		return nil, err
+	}
+	data, err := base64.StdEncoding.DecodeString(args.Data)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.dbg.WriteMemory(addr+uint16(args.Offset), data)
+	if err != nil {
+		return nil, err
+	}
+
+	return map[string]interface{}{"bytesWritten": len(data)}, nil
+}
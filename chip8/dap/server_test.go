@@ -0,0 +1,216 @@
+package dap
+
+import (
+	"encoding/json"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ministergoose/chip8-emu-go/chip8"
+	"github.com/ministergoose/chip8-emu-go/chip8/hardware/headless"
+)
+
+// a main program calling a subroutine that stores V0 at 0x300
+var ROM []byte = []byte{
+	0x60, 0x05, // 200 LD V0, 0x05
+	0x22, 0x08, // 202 CALL 0x208
+	0x12, 0x04, // 204 JP 0x204
+	0x00, 0x00,
+	0xA3, 0x00, // 208 LD I, 0x300
+	0xF0, 0x55, // 20A LD [I], V0
+	0x00, 0xEE, // 20C RET
+}
+
+const SOURCE_MAP = `; game.asm
+@main 0200
+@sub 0208
+0200 game.asm:1
+0202 game.asm:2
+0204 game.asm:3
+0208 game.asm:6
+020A game.asm:7
+020C game.asm:8
+`
+
+// session launches ROM in a Server over a pipe and runs it like Cpu.Run,
+// until the test ends.
+func session(t *testing.T) *Client {
+	dir := t.TempDir()
+	program := filepath.Join(dir, "game.ch8")
+	err := os.WriteFile(program, ROM, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.WriteFile(filepath.Join(dir, "game.map"), []byte(SOURCE_MAP), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := chip8.NewCPU(headless.NewDisplayHeadless(), headless.NewKeyboardHeadless(), headless.NewSoundHeadless(), chip8.QUIRKS_CHIP48)
+	srv := NewServer(c)
+	conn, serverConn := net.Pipe()
+	go srv.Serve(serverConn, serverConn)
+
+	quit := make(chan bool)
+	stopped := make(chan bool)
+	go func() {
+		defer close(stopped)
+		select {
+		case <-srv.Launched():
+		case <-quit:
+			return
+		}
+		for {
+			select {
+			case <-quit:
+				return
+			default:
+				if !srv.dbg.Paused() {
+					c.RunFrame()
+				}
+				time.Sleep(time.Millisecond)
+			}
+		}
+	}()
+	t.Cleanup(func() {
+		close(quit)
+		<-stopped
+		conn.Close()
+	})
+
+	conn.SetDeadline(time.Now().Add(10 * time.Second))
+	cl := NewClient(conn, conn)
+
+	res, err := cl.Request("initialize", map[string]interface{}{"adapterID": "chip8"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(res.Body), `"supportsReadMemoryRequest":true`) {
+		t.Errorf("initialize: %s", res.Body)
+	}
+	_, err = cl.WaitEvent("initialized")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = cl.Request("launch", LaunchArgs{Program: program, StopOnEntry: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cl
+}
+
+func decode(t *testing.T, msg *Message, v interface{}) {
+	t.Helper()
+	err := json.Unmarshal(msg.Body, v)
+	if err != nil {
+		t.Fatalf("%s: %v", msg.Body, err)
+	}
+}
+
+func TestSession(t *testing.T) {
+	cl := session(t)
+
+	res, err := cl.Request("setBreakpoints", map[string]interface{}{
+		"source":      Source{Path: "/src/game.asm"},
+		"breakpoints": []map[string]int{{"line": 7}, {"line": 4}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var bps struct{ Breakpoints []Breakpoint }
+	decode(t, res, &bps)
+	if len(bps.Breakpoints) != 2 || !bps.Breakpoints[0].Verified || bps.Breakpoints[0].InstructionReference != "0x20A" || bps.Breakpoints[1].Verified {
+		t.Fatalf("setBreakpoints: %s", res.Body)
+	}
+
+	_, err = cl.Request("configurationDone", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ev, err := cl.WaitEvent("stopped")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(ev.Body), `"reason":"entry"`) {
+		t.Fatalf("stopped: %s", ev.Body)
+	}
+
+	_, err = cl.Request("continue", map[string]int{"threadId": THREAD_ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ev, err = cl.WaitEvent("stopped")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(ev.Body), `"reason":"breakpoint"`) {
+		t.Fatalf("stopped: %s", ev.Body)
+	}
+
+	res, err = cl.Request("stackTrace", map[string]int{"threadId": THREAD_ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var trace struct{ StackFrames []StackFrame }
+	decode(t, res, &trace)
+	want := []struct {
+		name string
+		line int
+	}{{"sub", 7}, {"main", 2}}
+	if len(trace.StackFrames) != len(want) {
+		t.Fatalf("stackTrace: %s", res.Body)
+	}
+	for i, f := range trace.StackFrames {
+		if f.Name != want[i].name || f.Line != want[i].line || f.Source == nil || f.Source.Name != "game.asm" {
+			t.Errorf("frame %d: %+v, want %s at game.asm:%d", i, f, want[i].name, want[i].line)
+		}
+	}
+
+	res, err = cl.Request("variables", map[string]int{"variablesReference": REF_REGISTERS})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var vars struct{ Variables []Variable }
+	decode(t, res, &vars)
+	values := map[string]string{}
+	for _, v := range vars.Variables {
+		values[v.Name] = v.Value
+	}
+	for name, value := range map[string]string{"V0": "0x05", "I": "0x300", "PC": "0x20A"} {
+		if values[name] != value {
+			t.Errorf("%s = %s, want %s", name, values[name], value)
+		}
+	}
+}
+
+func TestReadMemory(t *testing.T) {
+	cl := session(t)
+
+	res, err := cl.Request("readMemory", map[string]interface{}{"memoryReference": "0x200", "count": 4})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(res.Body), `"data":"YAUiCA=="`) {
+		t.Errorf("readMemory: %s", res.Body)
+	}
+
+	for _, count := range []int{-1, chip8.MEMORY_SIZE + 1} {
+		res, err = cl.Request("readMemory", map[string]interface{}{"memoryReference": "0x200", "count": count})
+		if err == nil {
+			t.Errorf("readMemory of %d bytes: %s", count, res.Body)
+		}
+	}
+}
+
+func TestContentLength(t *testing.T) {
+	for _, length := range []string{"-1", "x", "1073741824"} {
+		conn := NewConn(strings.NewReader("Content-Length: "+length+"\r\n\r\n{}"), nil)
+		_, err := conn.Read()
+		if err == nil {
+			t.Errorf("Content-Length %s: no error", length)
+		}
+	}
+}
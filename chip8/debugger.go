@@ -0,0 +1,421 @@
+package chip8
+
+import (
+	"fmt"
+	"regexp"
+	"sync"
+)
+
+type StopReason byte
+
+const (
+	STOP_PAUSE StopReason = iota
+	STOP_STEP
+	STOP_BREAKPOINT
+	STOP_WATCHPOINT
+	STOP_CONDITION
+)
+
+type WatchKind byte
+
+const (
+	WATCH_READ   WatchKind = 1
+	WATCH_WRITE  WatchKind = 2
+	WATCH_ACCESS WatchKind = WATCH_READ | WATCH_WRITE
+)
+
+type CondOp string
+
+const (
+	COND_EQ CondOp = "=="
+	COND_NE CondOp = "!="
+	COND_LT CondOp = "<"
+	COND_LE CondOp = "<="
+	COND_GT CondOp = ">"
+	COND_GE CondOp = ">="
+)
+
+type stepMode byte
+
+const (
+	STEP_NONE stepMode = iota
+	STEP_INTO
+	STEP_OVER
+	STEP_OUT
+)
+
+type StopEvent struct {
+	Reason StopReason
+	PC     uint16
+	Addr   uint16     // accessed address for STOP_WATCHPOINT
+	Kind   WatchKind  // access kind for STOP_WATCHPOINT
+	Cond   *Condition // for STOP_CONDITION
+}
+
+type Watchpoint struct {
+	Addr uint16
+	Len  uint16
+	Kind WatchKind
+}
+
+// Condition breaks when the comparison of a register with a value becomes true.
+type Condition struct {
+	Reg   Reg
+	Op    CondOp
+	Value uint16
+
+	last bool
+}
+
+func (s StopReason) String() string {
+	return [...]string{"pause", "step", "breakpoint", "watchpoint", "condition"}[s]
+}
+
+func (c *Condition) String() string {
+	return fmt.Sprintf("%s %s 0x%02X", c.Reg, c.Op, c.Value)
+}
+
+var condRe = regexp.MustCompile(`^\s*(\w+)\s*(==|!=|<=|>=|<|>)\s*(\w+)\s*$`)
+
+// ParseCondition parses conditions like "V3 == 0x10" or "I >= 0x300".
+func ParseCondition(s string) (*Condition, error) {
+	m := condRe.FindStringSubmatch(s)
+	if m == nil {
+		return nil, fmt.Errorf("bad condition: %s", s)
+	}
+
+	reg, err := ParseReg(m[1])
+	if err != nil {
+		return nil, err
+	}
+	val, err := ParseValue(m[3])
+	if err != nil {
+		return nil, err
+	}
+
+	return &Condition{Reg: reg, Op: CondOp(m[2]), Value: val}, nil
+}
+
+func (c *Condition) eval(r *Registers) bool {
+	x := r.Get(c.Reg)
+	switch c.Op {
+	case COND_EQ:
+		return x == c.Value
+	case COND_NE:
+		return x != c.Value
+	case COND_LT:
+		return x < c.Value
+	case COND_LE:
+		return x <= c.Value
+	case COND_GT:
+		return x > c.Value
+	case COND_GE:
+		return x >= c.Value
+	}
+	return false
+}
+
+// Debugger controls the Run loop of a Cpu. All methods are safe to call from
+// other goroutines, the stops are reported on the Events channel.
+type Debugger struct {
+	mu  sync.Mutex
+	cpu *Cpu
+
+	paused      bool
+	breakpoints map[uint16]bool
+	watchpoints []Watchpoint
+	conditions  []*Condition
+
+	mode      stepMode
+	stepDepth byte
+	stepAddr  uint16
+	skipBreak bool // don't stop at the breakpoint we are resuming from
+
+	hit    *StopEvent
+	events chan StopEvent
+}
+
+func NewDebugger(c *Cpu) *Debugger {
+	d := &Debugger{cpu: c, breakpoints: map[uint16]bool{}, events: make(chan StopEvent, 16)}
+	c.debugger.Store(d)
+	return d
+}
+
+func (d *Debugger) Detach() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	// under d.mu, so not in the middle of a frame
+	d.cpu.debugger.Store((*Debugger)(nil))
+}
+
+func (d *Debugger) Events() <-chan StopEvent {
+	return d.events
+}
+
+func (d *Debugger) Paused() bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	return d.paused
+}
+
+func (d *Debugger) Pause() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.mode = STEP_NONE
+	d.stop(StopEvent{Reason: STOP_PAUSE})
+}
+
+func (d *Debugger) Continue() {
+	d.resume(STEP_NONE)
+}
+
+func (d *Debugger) StepInto() {
+	d.resume(STEP_INTO)
+}
+
+// StepOver steps into anything but CALL, which runs until the subroutine returns.
+func (d *Debugger) StepOver() {
+	d.resume(STEP_OVER)
+}
+
+// StepOut runs until the current subroutine returns.
+func (d *Debugger) StepOut() {
+	d.resume(STEP_OUT)
+}
+
+func (d *Debugger) resume(mode stepMode) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	c := d.cpu
+	d.mode = mode
+	d.stepDepth = c.stackDepth()
+	d.stepAddr = c.cnt
+	if mode == STEP_OVER && (uint16(c.memory[c.wrap(c.cnt)])>>4) != 0x2 {
+		d.mode = STEP_INTO
+	}
+	d.skipBreak = true
+	d.paused = false
+}
+
+func (d *Debugger) AddBreakpoint(addr uint16) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.breakpoints[addr] = true
+}
+
+func (d *Debugger) RemoveBreakpoint(addr uint16) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	delete(d.breakpoints, addr)
+}
+
+func (d *Debugger) Breakpoints() []uint16 {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	var res []uint16
+	for addr := range d.breakpoints {
+		res = append(res, addr)
+	}
+	return res
+}
+
+func (d *Debugger) AddWatchpoint(w Watchpoint) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if w.Len == 0 {
+		w.Len = 1
+	}
+	d.watchpoints = append(d.watchpoints, w)
+}
+
+func (d *Debugger) RemoveWatchpoint(w Watchpoint) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if w.Len == 0 {
+		w.Len = 1
+	}
+	for i, x := range d.watchpoints {
+		if x == w {
+			d.watchpoints = append(d.watchpoints[:i], d.watchpoints[i+1:]...)
+			return
+		}
+	}
+}
+
+func (d *Debugger) AddCondition(cond *Condition) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	regs := d.cpu.Registers()
+	cond.last = cond.eval(&regs)
+	d.conditions = append(d.conditions, cond)
+}
+
+func (d *Debugger) RemoveCondition(cond *Condition) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	for i, x := range d.conditions {
+		if x == cond {
+			d.conditions = append(d.conditions[:i], d.conditions[i+1:]...)
+			return
+		}
+	}
+}
+
+func (d *Debugger) Registers() Registers {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	return d.cpu.Registers()
+}
+
+func (d *Debugger) SetRegister(reg Reg, val uint16) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	regs := d.cpu.Registers()
+	regs.Set(reg, val)
+	return d.cpu.SetRegisters(regs)
+}
+
+func (d *Debugger) CallStack() []uint16 {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	return d.cpu.CallStack()
+}
+
+func (d *Debugger) ReadMemory(addr uint16, length int) []byte {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	return d.cpu.ReadMemory(addr, length)
+}
+
+func (d *Debugger) WriteMemory(addr uint16, data []byte) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	return d.cpu.WriteMemory(addr, data)
+}
+
+// Exec runs f with the Cpu while the Run loop is held.
+func (d *Debugger) Exec(f func(c *Cpu)) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	f(d.cpu)
+}
+
+// stop pauses the Cpu and reports the event, d.mu must be held.
+func (d *Debugger) stop(ev StopEvent) {
+	ev.PC = d.cpu.cnt
+	d.paused = true
+	d.mode = STEP_NONE
+	select {
+	case d.events <- ev:
+	default:
+	}
+}
+
+// check is called by the Run loop before every instruction and returns true when paused.
+func (d *Debugger) check() bool {
+	if d.paused {
+		return true
+	}
+
+	c := d.cpu
+	if d.breakpoints[c.cnt] && !d.skipBreak {
+		d.stop(StopEvent{Reason: STOP_BREAKPOINT})
+		return true
+	}
+	d.skipBreak = false
+
+	if len(d.conditions) > 0 {
+		regs := c.Registers()
+		for _, cond := range d.conditions {
+			res := cond.eval(&regs)
+			if res && !cond.last {
+				cond.last = res
+				d.stop(StopEvent{Reason: STOP_CONDITION, Cond: cond})
+				return true
+			}
+			cond.last = res
+		}
+	}
+
+	return false
+}
+
+// stepped is called by the Run loop after every instruction and returns true when paused.
+func (d *Debugger) stepped() bool {
+	c := d.cpu
+
+	if d.hit != nil {
+		d.stop(*d.hit)
+		d.hit = nil
+		return true
+	}
+
+	switch d.mode {
+	case STEP_INTO:
+		d.stop(StopEvent{Reason: STOP_STEP})
+	case STEP_OVER:
+		if c.cnt == d.stepAddr+2 && c.stackDepth() <= d.stepDepth {
+			d.stop(StopEvent{Reason: STOP_STEP})
+		}
+	case STEP_OUT:
+		if c.stackDepth() < d.stepDepth {
+			d.stop(StopEvent{Reason: STOP_STEP})
+		}
+	}
+
+	return d.paused
+}
+
+// access is called on every data memory access of an instruction.
+func (d *Debugger) access(addr uint16, kind WatchKind) {
+	if d.hit != nil {
+		return
+	}
+	for _, w := range d.watchpoints {
+		if (w.Kind&kind) != 0 && addr >= w.Addr && uint32(addr) < uint32(w.Addr)+uint32(w.Len) {
+			d.hit = &StopEvent{Reason: STOP_WATCHPOINT, Addr: addr, Kind: kind}
+			return
+		}
+	}
+}
+
+func (c *Cpu) stackDepth() byte {
+	_, index := c.stack.State()
+	return index
+}
+
+// attached returns the debugger of c, nil when there is none. It is loaded
+// once per use since Detach may run on another goroutine.
+func (c *Cpu) attached() *Debugger {
+	d, _ := c.debugger.Load().(*Debugger)
+	return d
+}
+
+func (d *Debugger) lock() {
+	if d != nil {
+		d.mu.Lock()
+	}
+}
+
+func (d *Debugger) unlock() {
+	if d != nil {
+		d.mu.Unlock()
+	}
+}
@@ -0,0 +1,73 @@
+package chip8
+
+import (
+	"testing"
+
+	"github.com/ministergoose/chip8-emu-go/chip8/hardware/headless"
+)
+
+// run with -race: Detach from another goroutine while frames are emulated
+func TestDetachWhileRunning(t *testing.T) {
+	c := NewCPU(headless.NewDisplayHeadless(), headless.NewKeyboardHeadless(), headless.NewSoundHeadless(), QUIRKS_CHIP48)
+	err := c.LoadROM(BENCH_ROM)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan bool)
+	go func() {
+		for i := 0; i < 100; i++ {
+			d := NewDebugger(c)
+			d.AddBreakpoint(0x400)
+			d.Detach()
+		}
+		close(done)
+	}()
+	for running := true; running; {
+		select {
+		case <-done:
+			running = false
+		default:
+			c.RunFrame()
+		}
+	}
+	if c.attached() != nil {
+		t.Error("debugger still attached")
+	}
+}
+
+// sets DT to 60 and reads it in a loop
+var DELAY_ROM []byte = []byte{
+	0x60, 0x3C, // 200 LD V0, 60
+	0xF0, 0x15, // 202 LD DT, V0
+	0xF1, 0x07, // 204 LD V1, DT
+	0x12, 0x04, // 206 JP 0x204
+}
+
+func TestStepTimers(t *testing.T) {
+	c := NewCPU(headless.NewDisplayHeadless(), headless.NewKeyboardHeadless(), headless.NewSoundHeadless(), QUIRKS_CHIP48)
+	err := c.LoadROM(DELAY_ROM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.SetTickRate(20)
+	d := NewDebugger(c)
+	d.Pause()
+
+	// the timers tick once every 20 steps, like when running
+	for step := 1; step <= 50; step++ {
+		d.StepInto()
+		c.RunFrame()
+		if !d.Paused() {
+			t.Fatalf("step %d did not stop", step)
+		}
+		if step >= 2 {
+			if dt, want := c.Registers().DT, byte(60-step/20); dt != want {
+				t.Fatalf("DT is %d after %d steps, want %d", dt, step, want)
+			}
+		}
+	}
+	if c.Frames() != 2 {
+		t.Errorf("%d frames after 50 steps, want 2", c.Frames())
+	}
+}
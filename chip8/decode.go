@@ -0,0 +1,351 @@
+package chip8
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Op is the operation of a decoded instruction.
+type Op byte
+
+const (
+	OP_UNKNOWN    Op = iota
+	OP_CLS           // 00E0
+	OP_RET           // 00EE
+	OP_SCD           // 00Cn, SUPER-CHIP
+	OP_SCU           // 00Dn, XO-CHIP
+	OP_SCR           // 00FB, SUPER-CHIP
+	OP_SCL           // 00FC, SUPER-CHIP
+	OP_EXIT          // 00FD, SUPER-CHIP
+	OP_LOW           // 00FE, SUPER-CHIP
+	OP_HIGH          // 00FF, SUPER-CHIP
+	OP_SYS           // 0nnn
+	OP_JP            // 1nnn
+	OP_CALL          // 2nnn
+	OP_SE_BYTE       // 3xkk
+	OP_SNE_BYTE      // 4xkk
+	OP_SE_REG        // 5xy0
+	OP_SAVE_RANGE    // 5xy2, XO-CHIP
+	OP_LOAD_RANGE    // 5xy3, XO-CHIP
+	OP_LD_BYTE       // 6xkk
+	OP_ADD_BYTE      // 7xkk
+	OP_LD_REG        // 8xy0
+	OP_OR            // 8xy1
+	OP_AND           // 8xy2
+	OP_XOR           // 8xy3
+	OP_ADD_REG       // 8xy4
+	OP_SUB           // 8xy5
+	OP_SHR           // 8xy6
+	OP_SUBN          // 8xy7
+	OP_SHL           // 8xyE
+	OP_SNE_REG       // 9xy0
+	OP_LD_I          // Annn
+	OP_JP_V0         // Bnnn
+	OP_RND           // Cxkk
+	OP_DRW           // Dxyn
+	OP_SKP           // Ex9E
+	OP_SKNP          // ExA1
+	OP_LD_I_LONG     // F000 nnnn, XO-CHIP
+	OP_PLANE         // Fn01, XO-CHIP
+	OP_AUDIO         // F002, XO-CHIP
+	OP_LD_VX_DT      // Fx07
+	OP_LD_VX_K       // Fx0A
+	OP_LD_DT_VX      // Fx15
+	OP_LD_ST_VX      // Fx18
+	OP_ADD_I_VX      // Fx1E
+	OP_LD_F_VX       // Fx29
+	OP_LD_HF_VX      // Fx30, SUPER-CHIP
+	OP_LD_B_VX       // Fx33
+	OP_PITCH         // Fx3A, XO-CHIP
+	OP_SAVE          // Fx55
+	OP_LOAD          // Fx65
+	OP_SAVE_FLAGS    // Fx75, SUPER-CHIP
+	OP_LOAD_FLAGS    // Fx85, SUPER-CHIP
+	OP_COUNT
+)
+
+// Instruction is a decoded opcode with its operands.
+type Instruction struct {
+	Op     Op
+	X, Y   byte   // registers
+	N      byte   // low nibble
+	KK     byte   // low byte
+	NNN    uint16 // address
+	Opcode uint16
+}
+
+var SUB_OPS_8 [16]Op = [16]Op{
+	0x0: OP_LD_REG, 0x1: OP_OR, 0x2: OP_AND, 0x3: OP_XOR, 0x4: OP_ADD_REG,
+	0x5: OP_SUB, 0x6: OP_SHR, 0x7: OP_SUBN, 0xe: OP_SHL,
+}
+
+// Decode decodes an opcode for platform p. Instructions of newer platforms
+// are OP_UNKNOWN, except 00Cn..00FF which are SYS calls on older ones.
+func Decode(opcode uint16, p Platform) Instruction {
+	in := Instruction{
+		X:      byte(opcode>>8) & 0xf,
+		Y:      byte(opcode>>4) & 0xf,
+		N:      byte(opcode) & 0xf,
+		KK:     byte(opcode),
+		NNN:    opcode & 0x0fff,
+		Opcode: opcode,
+	}
+	schip := p >= PLATFORM_SCHIP
+	xochip := p == PLATFORM_XOCHIP
+
+	switch opcode >> 12 {
+	case 0x0:
+		switch {
+		case opcode == 0x00e0:
+			in.Op = OP_CLS
+		case opcode == 0x00ee:
+			in.Op = OP_RET
+		case opcode&0xfff0 == 0x00c0 && schip:
+			in.Op = OP_SCD
+		case opcode&0xfff0 == 0x00d0 && xochip:
+			in.Op = OP_SCU
+		case opcode == 0x00fb && schip:
+			in.Op = OP_SCR
+		case opcode == 0x00fc && schip:
+			in.Op = OP_SCL
+		case opcode == 0x00fd && schip:
+			in.Op = OP_EXIT
+		case opcode == 0x00fe && schip:
+			in.Op = OP_LOW
+		case opcode == 0x00ff && schip:
+			in.Op = OP_HIGH
+		default:
+			in.Op = OP_SYS
+		}
+	case 0x1:
+		in.Op = OP_JP
+	case 0x2:
+		in.Op = OP_CALL
+	case 0x3:
+		in.Op = OP_SE_BYTE
+	case 0x4:
+		in.Op = OP_SNE_BYTE
+	case 0x5:
+		switch {
+		case in.N == 0x0:
+			in.Op = OP_SE_REG
+		case in.N == 0x2 && xochip:
+			in.Op = OP_SAVE_RANGE
+		case in.N == 0x3 && xochip:
+			in.Op = OP_LOAD_RANGE
+		}
+	case 0x6:
+		in.Op = OP_LD_BYTE
+	case 0x7:
+		in.Op = OP_ADD_BYTE
+	case 0x8:
+		in.Op = SUB_OPS_8[in.N]
+	case 0x9:
+		if in.N == 0 {
+			in.Op = OP_SNE_REG
+		}
+	case 0xa:
+		in.Op = OP_LD_I
+	case 0xb:
+		in.Op = OP_JP_V0
+	case 0xc:
+		in.Op = OP_RND
+	case 0xd:
+		in.Op = OP_DRW
+	case 0xe:
+		switch in.KK {
+		case 0x9e:
+			in.Op = OP_SKP
+		case 0xa1:
+			in.Op = OP_SKNP
+		}
+	case 0xf:
+		switch {
+		case opcode == 0xf000 && xochip:
+			in.Op = OP_LD_I_LONG
+		case in.KK == 0x01 && xochip:
+			in.Op = OP_PLANE
+		case opcode == 0xf002 && xochip:
+			in.Op = OP_AUDIO
+		case in.KK == 0x07:
+			in.Op = OP_LD_VX_DT
+		case in.KK == 0x0a:
+			in.Op = OP_LD_VX_K
+		case in.KK == 0x15:
+			in.Op = OP_LD_DT_VX
+		case in.KK == 0x18:
+			in.Op = OP_LD_ST_VX
+		case in.KK == 0x1e:
+			in.Op = OP_ADD_I_VX
+		case in.KK == 0x29:
+			in.Op = OP_LD_F_VX
+		case in.KK == 0x30 && schip:
+			in.Op = OP_LD_HF_VX
+		case in.KK == 0x33:
+			in.Op = OP_LD_B_VX
+		case in.KK == 0x3a && xochip:
+			in.Op = OP_PITCH
+		case in.KK == 0x55:
+			in.Op = OP_SAVE
+		case in.KK == 0x65:
+			in.Op = OP_LOAD
+		case in.KK == 0x75 && schip:
+			in.Op = OP_SAVE_FLAGS
+		case in.KK == 0x85 && schip:
+			in.Op = OP_LOAD_FLAGS
+		}
+	}
+
+	return in
+}
+
+// Size returns the length of the instruction in bytes, F000 nnnn is 4 bytes long.
+func (in Instruction) Size() uint16 {
+	if in.Op == OP_LD_I_LONG {
+		return 4
+	}
+	return 2
+}
+
+// Mnemonic returns the assembler mnemonic and operands of the instruction.
+// The operand of F000 is the second word, which is passed as long.
+func (in Instruction) Mnemonic(long uint16) (string, []string) {
+	x, y := reg(in.X), reg(in.Y)
+
+	switch in.Op {
+	case OP_CLS:
+		return "CLS", nil
+	case OP_RET:
+		return "RET", nil
+	case OP_SCD:
+		return "SCD", []string{fmt.Sprint(in.N)}
+	case OP_SCU:
+		return "SCU", []string{fmt.Sprint(in.N)}
+	case OP_SCR:
+		return "SCR", nil
+	case OP_SCL:
+		return "SCL", nil
+	case OP_EXIT:
+		return "EXIT", nil
+	case OP_LOW:
+		return "LOW", nil
+	case OP_HIGH:
+		return "HIGH", nil
+	case OP_SYS:
+		return "SYS", []string{hexAddr(in.NNN)}
+	case OP_JP:
+		return "JP", []string{hexAddr(in.NNN)}
+	case OP_CALL:
+		return "CALL", []string{hexAddr(in.NNN)}
+	case OP_SE_BYTE:
+		return "SE", []string{x, hexByte(in.KK)}
+	case OP_SNE_BYTE:
+		return "SNE", []string{x, hexByte(in.KK)}
+	case OP_SE_REG:
+		return "SE", []string{x, y}
+	case OP_SAVE_RANGE:
+		return "LD", []string{"[I]", x + "-" + y}
+	case OP_LOAD_RANGE:
+		return "LD", []string{x + "-" + y, "[I]"}
+	case OP_LD_BYTE:
+		return "LD", []string{x, hexByte(in.KK)}
+	case OP_ADD_BYTE:
+		return "ADD", []string{x, hexByte(in.KK)}
+	case OP_LD_REG:
+		return "LD", []string{x, y}
+	case OP_OR:
+		return "OR", []string{x, y}
+	case OP_AND:
+		return "AND", []string{x, y}
+	case OP_XOR:
+		return "XOR", []string{x, y}
+	case OP_ADD_REG:
+		return "ADD", []string{x, y}
+	case OP_SUB:
+		return "SUB", []string{x, y}
+	case OP_SHR:
+		return "SHR", []string{x, y}
+	case OP_SUBN:
+		return "SUBN", []string{x, y}
+	case OP_SHL:
+		return "SHL", []string{x, y}
+	case OP_SNE_REG:
+		return "SNE", []string{x, y}
+	case OP_LD_I:
+		return "LD", []string{"I", hexAddr(in.NNN)}
+	case OP_JP_V0:
+		return "JP", []string{"V0", hexAddr(in.NNN)}
+	case OP_RND:
+		return "RND", []string{x, hexByte(in.KK)}
+	case OP_DRW:
+		return "DRW", []string{x, y, fmt.Sprint(in.N)}
+	case OP_SKP:
+		return "SKP", []string{x}
+	case OP_SKNP:
+		return "SKNP", []string{x}
+	case OP_LD_I_LONG:
+		return "LD", []string{"I", fmt.Sprintf("long 0x%04X", long)}
+	case OP_PLANE:
+		return "PLANE", []string{fmt.Sprint(in.X)}
+	case OP_AUDIO:
+		return "AUDIO", nil
+	case OP_LD_VX_DT:
+		return "LD", []string{x, "DT"}
+	case OP_LD_VX_K:
+		return "LD", []string{x, "K"}
+	case OP_LD_DT_VX:
+		return "LD", []string{"DT", x}
+	case OP_LD_ST_VX:
+		return "LD", []string{"ST", x}
+	case OP_ADD_I_VX:
+		return "ADD", []string{"I", x}
+	case OP_LD_F_VX:
+		return "LD", []string{"F", x}
+	case OP_LD_HF_VX:
+		return "LD", []string{"HF", x}
+	case OP_LD_B_VX:
+		return "LD", []string{"B", x}
+	case OP_PITCH:
+		return "PITCH", []string{x}
+	case OP_SAVE:
+		return "LD", []string{"[I]", x}
+	case OP_LOAD:
+		return "LD", []string{x, "[I]"}
+	case OP_SAVE_FLAGS:
+		return "LD", []string{"R", x}
+	case OP_LOAD_FLAGS:
+		return "LD", []string{x, "R"}
+	}
+	return "db", []string{hexByte(byte(in.Opcode >> 8)), hexByte(byte(in.Opcode))}
+}
+
+// String formats the instruction like the disassembler, F000 without its address.
+func (in Instruction) String() string {
+	mnemonic, args := in.Mnemonic(0)
+	if len(args) == 0 {
+		return mnemonic
+	}
+	return mnemonic + " " + strings.Join(args, ", ")
+}
+
+func reg(r byte) string {
+	return fmt.Sprintf("V%X", r)
+}
+
+func hexByte(b byte) string {
+	return fmt.Sprintf("0x%02X", b)
+}
+
+func hexAddr(a uint16) string {
+	return fmt.Sprintf("0x%03X", a)
+}
+
+// Trace formats the instruction at pc for the debug log, with the address of F000 nnnn.
+func (c *Cpu) Trace(pc uint16, in Instruction) string {
+	var long uint16
+	if in.Op == OP_LD_I_LONG && int(pc)+3 < len(c.memory) {
+		long = uint16(c.memory[pc+2])<<8 | uint16(c.memory[pc+3])
+	}
+	mnemonic, args := in.Mnemonic(long)
+	return fmt.Sprintf("%04X  %04X  %-5s %s", pc, in.Opcode, mnemonic, strings.Join(args, ", "))
+}
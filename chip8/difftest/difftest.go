@@ -0,0 +1,284 @@
+// Package difftest runs the two interpreters of the CPU in lockstep on the
+// same ROM and keys: one machine steps through the instructions, the other
+// runs cached blocks and is resumed from the save state of the first every
+// few frames. It reports the first block after which the machines differ,
+// so stale blocks and state that the save states miss show up.
+package difftest
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"github.com/ministergoose/chip8-emu-go/chip8"
+	"github.com/ministergoose/chip8-emu-go/chip8/disasm"
+	"github.com/ministergoose/chip8-emu-go/chip8/hardware/headless"
+)
+
+const (
+	CONTEXT         = 8              // instructions shown before a divergence
+	STEPS_PER_FRAME = chip8.IPS / 60 // the timers tick and the keys are read every that many steps
+	WRITE_SIZE      = 16             // bytes an instruction writes at most, Fx55 and 5xy2
+	RESUME_FRAMES   = 10             // frames between the resumes of the block machine
+)
+
+type machine struct {
+	cpu  *chip8.Cpu
+	dspl *headless.DisplayHeadless
+	kbrd *headless.KeyboardHeadless
+}
+
+type traceEntry struct {
+	pc   uint16
+	code []byte
+}
+
+type Harness struct {
+	step, blocks machine
+	rom          []byte
+	platform     chip8.Platform
+	quirks       chip8.Quirks
+	steps        int
+	trace        []traceEntry // the last CONTEXT instructions
+}
+
+// Divergence describes the first block after which the machines differ.
+type Divergence struct {
+	Step    int
+	PC      uint16
+	Diffs   []string
+	Context []string // disassembly of the last instructions, the divergent one last
+}
+
+// Panic is a panic of an interpreter, returned by Step even when both
+// machines panicked the same way.
+type Panic struct {
+	Value interface{}
+}
+
+func (p *Panic) Error() string {
+	return fmt.Sprintf("panic: %v", p.Value)
+}
+
+func (d *Divergence) Error() string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "machines diverge at step %d, PC 0x%03X:\n", d.Step, d.PC)
+	for _, line := range d.Context {
+		fmt.Fprintf(&sb, "    %s\n", line)
+	}
+	for _, diff := range d.Diffs {
+		fmt.Fprintf(&sb, "  %s\n", diff)
+	}
+	return sb.String()
+}
+
+func newMachine(rom []byte, p chip8.Platform, q chip8.Quirks, i chip8.Interpreter) (machine, error) {
+	m := machine{dspl: headless.NewDisplayHeadless(), kbrd: headless.NewKeyboardHeadless()}
+	m.cpu = chip8.NewCPU(m.dspl, m.kbrd, headless.NewSoundHeadless(), q)
+	m.cpu.SetPlatform(p)
+	m.cpu.SetInterpreter(i)
+	m.cpu.Seed(0) // both machines draw the same random numbers
+	return m, m.cpu.LoadROM(rom)
+}
+
+func New(rom []byte, p chip8.Platform, q chip8.Quirks) (*Harness, error) {
+	step, err := newMachine(rom, p, q, chip8.INTERPRETER_STEP)
+	if err != nil {
+		return nil, err
+	}
+	blocks, err := newMachine(rom, p, q, chip8.INTERPRETER_BLOCKS)
+	if err != nil {
+		return nil, err
+	}
+	return &Harness{step: step, blocks: blocks, rom: rom, platform: p, quirks: q}, nil
+}
+
+// SetKeys sets the keys held down on both machines, they see them with the next frame.
+func (h *Harness) SetKeys(keys uint16) {
+	h.step.kbrd.SetKeys(keys)
+	h.blocks.kbrd.SetKeys(keys)
+}
+
+// resume replaces the block machine with a new one loaded from the save state of the other.
+func (h *Harness) resume() error {
+	m, err := newMachine(h.rom, h.platform, h.quirks, chip8.INTERPRETER_BLOCKS)
+	if err != nil {
+		return err
+	}
+	var state bytes.Buffer
+	err = h.step.cpu.SaveState(&state)
+	if err != nil {
+		return err
+	}
+	err = m.cpu.LoadState(&state)
+	if err != nil {
+		return err
+	}
+	// the keyboard is not part of the machine
+	*m.kbrd = *h.step.kbrd
+	h.blocks = m
+	return nil
+}
+
+// run runs one instruction or, on the block machine, one block of at most n
+// instructions. A panic of the interpreter is returned as error.
+func run(m machine, n int) (count int, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			count, err = 1, &Panic{Value: r}
+		}
+	}()
+
+	if m.cpu.Interpreter() == chip8.INTERPRETER_BLOCKS {
+		return m.cpu.StepBlock(n)
+	}
+	return 1, m.cpu.Step()
+}
+
+// Step runs one block on the block machine and as many instructions on the
+// other. It returns a *Divergence when they differ afterwards, or the error
+// of the last instruction when both failed the same way, e.g. on a stack
+// overflow.
+func (h *Harness) Step() error {
+	pc := h.step.cpu.Registers().PC
+	limit := STEPS_PER_FRAME - h.steps%STEPS_PER_FRAME
+	count, blocksErr := run(h.blocks, limit)
+
+	var diffs []string
+	var written []uint16
+	var stepErr error
+	for i := 0; i < count; i++ {
+		regs := h.step.cpu.Registers()
+		pc = regs.PC
+		written = append(written, regs.I)
+		h.trace = append(h.trace, traceEntry{pc: pc, code: h.step.cpu.ReadMemory(pc, 4)})
+		if len(h.trace) > CONTEXT {
+			h.trace = h.trace[1:]
+		}
+
+		_, stepErr = run(h.step, 1)
+		h.steps++
+		if stepErr != nil && i < count-1 {
+			diffs = append(diffs, fmt.Sprintf("error: step %s after %d of %d instructions", stepErr, i+1, count))
+			break
+		}
+	}
+
+	frame := h.steps%STEPS_PER_FRAME == 0
+	if frame {
+		for _, m := range []machine{h.step, h.blocks} {
+			m.cpu.TimersTick()
+			m.cpu.ReadKeys()
+		}
+	}
+
+	// instructions only write memory at I, the whole machine is compared once a frame
+	diffs = append(diffs, h.compare(written, frame)...)
+	if errString(stepErr) != errString(blocksErr) {
+		diffs = append([]string{fmt.Sprintf("error: step %s, blocks %s", errString(stepErr), errString(blocksErr))}, diffs...)
+	}
+	if len(diffs) > 0 {
+		return &Divergence{Step: h.steps - 1, PC: pc, Diffs: diffs, Context: h.context()}
+	}
+	if frame && h.steps%(STEPS_PER_FRAME*RESUME_FRAMES) == 0 {
+		err := h.resume()
+		if err != nil {
+			return err
+		}
+	}
+	return stepErr
+}
+
+// Run runs blocks until the machines diverge, an instruction fails or at least n steps are done.
+func (h *Harness) Run(n int) error {
+	for end := h.steps + n; h.steps < end && !h.step.cpu.Halted(); {
+		err := h.Step()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Steps returns the number of instructions run.
+func (h *Harness) Steps() int {
+	return h.steps
+}
+
+func errString(err error) string {
+	if err == nil {
+		return "<nil>"
+	}
+	return err.Error()
+}
+
+// compare returns the differences of the machines, the memory written at
+// the addresses or, with full, all of the memory and the rest of the state.
+func (h *Harness) compare(written []uint16, full bool) []string {
+	var diffs []string
+	a, b := h.step.cpu, h.blocks.cpu
+
+	ar, br := a.Registers(), b.Registers()
+	for r := chip8.REG_V0; r < chip8.REG_COUNT; r++ {
+		if ar.Get(r) != br.Get(r) {
+			diffs = append(diffs, fmt.Sprintf("%s: step 0x%02X, blocks 0x%02X", r, ar.Get(r), br.Get(r)))
+		}
+	}
+
+	if as, bs := fmt.Sprint(a.CallStack()), fmt.Sprint(b.CallStack()); as != bs {
+		diffs = append(diffs, fmt.Sprintf("stack: step %s, blocks %s", as, bs))
+	}
+
+	for _, addr := range written {
+		diffs = append(diffs, memoryDiff(a, b, addr, WRITE_SIZE)...)
+	}
+
+	ad, bd := h.step.dspl, h.blocks.dspl
+	if ad.Width() != bd.Width() || ad.Pixels != bd.Pixels {
+		diffs = append(diffs, "screen differs")
+	}
+
+	if a.Halted() != b.Halted() {
+		diffs = append(diffs, fmt.Sprintf("halted: step %v, blocks %v", a.Halted(), b.Halted()))
+	}
+
+	// the rest of the memory, flags, planes, audio
+	if full && len(diffs) == 0 {
+		var as, bs bytes.Buffer
+		errA, errB := a.SaveState(&as), b.SaveState(&bs)
+		if errA != nil || errB != nil || !bytes.Equal(as.Bytes(), bs.Bytes()) {
+			diffs = append(diffs, memoryDiff(a, b, 0, a.MemorySize())...)
+			if len(diffs) == 0 {
+				diffs = append(diffs, "machine state differs")
+			}
+		}
+	}
+
+	return diffs
+}
+
+func memoryDiff(a, b *chip8.Cpu, addr uint16, length int) []string {
+	am, bm := a.ReadMemory(addr, length), b.ReadMemory(addr, length)
+	for i := range am {
+		if am[i] != bm[i] {
+			return []string{fmt.Sprintf("memory 0x%03X: step 0x%02X, blocks 0x%02X", int(addr)+i, am[i], bm[i])}
+		}
+	}
+	return nil
+}
+
+func (h *Harness) context() []string {
+	var lines []string
+	for i, e := range h.trace {
+		text := fmt.Sprintf("% X", e.code)
+		if in, ok := disasm.Decode(e.code, e.pc, h.platform); ok {
+			text = in.String()
+		}
+		mark := " "
+		if i == len(h.trace)-1 {
+			mark = ">"
+		}
+		lines = append(lines, fmt.Sprintf("%s %04X  %s", mark, e.pc, text))
+	}
+	return lines
+}
@@ -0,0 +1,163 @@
+package difftest
+
+import (
+	"errors"
+	"math/rand"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ministergoose/chip8-emu-go/chip8"
+	"github.com/ministergoose/chip8-emu-go/chip8/octo"
+)
+
+const (
+	PROGRAM_STEPS = 20000
+	RANDOM_ROMS   = 100
+	RANDOM_STEPS  = 2000
+)
+
+var PLATFORMS []chip8.Platform = []chip8.Platform{chip8.PLATFORM_CHIP8, chip8.PLATFORM_SCHIP, chip8.PLATFORM_XOCHIP}
+
+// the second nibble and the low byte of the opcodes with sub-opcodes
+var SUB_OPCODES map[byte][]uint16 = map[byte][]uint16{
+	0x0: {0x0e0, 0x0ee, 0x0c3, 0x0d2, 0x0fb, 0x0fc, 0x0fd, 0x0fe, 0x0ff, 0x123},
+	0x5: {0x0, 0x1, 0x2, 0x3},
+	0x8: {0x0, 0x1, 0x2, 0x3, 0x4, 0x5, 0x6, 0x7, 0xe, 0x9},
+	0x9: {0x0, 0x1},
+	0xe: {0x9e, 0xa1, 0x55},
+	0xf: {0x00, 0x01, 0x02, 0x07, 0x0a, 0x15, 0x18, 0x1e, 0x29, 0x30, 0x33, 0x3a, 0x55, 0x65, 0x75, 0x85, 0x99},
+}
+
+// randomROM returns instructions that are mostly valid for some platform.
+func randomROM(r *rand.Rand, size int) []byte {
+	rom := make([]byte, 0, size)
+	for len(rom) < size {
+		op := byte(r.Intn(16))
+		inst := uint16(op)<<12 | uint16(r.Intn(0x1000))
+		if subs, ok := SUB_OPCODES[op]; ok && r.Intn(8) != 0 {
+			sub := subs[r.Intn(len(subs))]
+			switch op {
+			case 0x0:
+				inst = sub
+			case 0x5, 0x8, 0x9:
+				inst = inst&0xfff0 | sub
+			default:
+				inst = inst&0xff00 | sub
+			}
+		}
+		rom = append(rom, byte(inst>>8), byte(inst))
+	}
+	return rom
+}
+
+func check(t *testing.T, h *Harness, err error) {
+	t.Helper()
+	var d *Divergence
+	if errors.As(err, &d) {
+		t.Fatal(d)
+	}
+	// the machines agree, but the interpreters must not panic
+	var p *Panic
+	if errors.As(err, &p) {
+		t.Fatalf("%v after %d steps\n%s", p, h.Steps(), strings.Join(h.context(), "\n"))
+	}
+}
+
+func TestPrograms(t *testing.T) {
+	files, err := filepath.Glob("../regression/testdata/roms/*.8o")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, file := range files {
+		res, err := octo.CompileFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for name, quirks := range chip8.QUIRK_PRESETS {
+			t.Run(filepath.Base(file)+"/"+name, func(t *testing.T) {
+				h, err := New(res.ROM, chip8.Platform(res.Platform), quirks)
+				if err != nil {
+					t.Fatal(err)
+				}
+				for i := 0; i < PROGRAM_STEPS/100; i++ {
+					h.SetKeys(uint16(i * 0x1234))
+					err = h.Run(100)
+					if err != nil {
+						break
+					}
+				}
+				check(t, h, err)
+			})
+		}
+	}
+}
+
+// a loop that stores a counter into the code it runs next
+var SELF_MODIFYING []byte = []byte{
+	0x6E, 0x00, // 200 LD VE, 0x00
+	0x61, 0x00, // 202 LD V1, 0x00
+	0x60, 0x6E, // 204 LD V0, 0x6E
+	0xA2, 0x0C, // 206 LD I, 0x20C
+	0xF1, 0x55, // 208 LD [I], V1
+	0x71, 0x01, // 20A ADD V1, 0x01
+	0x6E, 0x00, // 20C LD VE, 0x00, rewritten by 208
+	0x12, 0x04, // 20E JP 0x204
+}
+
+func TestSelfModifying(t *testing.T) {
+	for _, p := range PLATFORMS {
+		h, err := New(SELF_MODIFYING, p, p.DefaultQuirks())
+		if err != nil {
+			t.Fatal(err)
+		}
+		check(t, h, h.Run(PROGRAM_STEPS))
+	}
+}
+
+func TestRandom(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < RANDOM_ROMS; i++ {
+		rom := randomROM(r, 256)
+		p := PLATFORMS[i%len(PLATFORMS)]
+		for _, quirks := range chip8.QUIRK_PRESETS {
+			h, err := New(rom, p, quirks)
+			if err != nil {
+				t.Fatal(err)
+			}
+			h.SetKeys(uint16(r.Intn(0x10000)))
+			check(t, h, h.Run(RANDOM_STEPS))
+		}
+	}
+}
+
+func FuzzLockstep(f *testing.F) {
+	r := rand.New(rand.NewSource(2))
+	for i := 0; i < 8; i++ {
+		f.Add(randomROM(r, 64), byte(i), uint16(r.Intn(0x10000)))
+	}
+	// the accesses past the end of memory that used to panic
+	for _, rom := range [][]byte{
+		{0xAF, 0xFF, 0xF1, 0x55},
+		{0xAF, 0xFF, 0xD0, 0x05},
+		{0xAF, 0xFF, 0xF0, 0x33},
+		{0x1F, 0xFE},
+	} {
+		f.Add(rom, byte(0), uint16(0))
+	}
+
+	presets := []chip8.Quirks{chip8.QUIRKS_COSMAC_VIP, chip8.QUIRKS_CHIP48, chip8.QUIRKS_SCHIP, chip8.QUIRKS_XOCHIP}
+	f.Fuzz(func(t *testing.T, rom []byte, config byte, keys uint16) {
+		if len(rom) > chip8.MEMORY_SIZE-int(chip8.START_ADDR) {
+			return
+		}
+		p := PLATFORMS[int(config&0xf)%len(PLATFORMS)]
+		h, err := New(rom, p, presets[int(config>>4)%len(presets)])
+		if err != nil {
+			t.Fatal(err)
+		}
+		h.SetKeys(keys)
+		check(t, h, h.Run(RANDOM_STEPS))
+	})
+}
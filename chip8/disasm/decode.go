@@ -0,0 +1,95 @@
+package disasm
+
+import (
+	"fmt"
+
+	"github.com/ministergoose/chip8-emu-go/chip8"
+)
+
+// flow is how an instruction continues the control flow.
+type flow byte
+
+const (
+	FLOW_NEXT  flow = iota // the next instruction
+	FLOW_JUMP              // the target only
+	FLOW_CALL              // the target and the next instruction
+	FLOW_SKIP              // the next or the one after it
+	FLOW_STOP              // nothing, RET and EXIT
+	FLOW_TABLE             // a computed jump, the targets are unknown
+)
+
+const NO_TARGET = -1
+
+// Instruction is a decoded instruction or a run of data bytes.
+type Instruction struct {
+	Addr    uint16
+	Bytes   []byte
+	Data    bool     // Bytes are data, emitted with db
+	Op      string   // mnemonic, "db" for data
+	Args    []string // formatted operands
+	Target  uint16   // address operand of jumps, calls and LD I
+	TArg    int      // index of the operand holding Target, NO_TARGET if none
+	Label   string   // label defined at Addr
+	Comment string
+
+	flow flow
+}
+
+func hexByte(b byte) string {
+	return fmt.Sprintf("0x%02X", b)
+}
+
+// Decode decodes the instruction at the start of code, which is located at addr.
+// It returns false if code doesn't start with a valid instruction for platform p.
+func Decode(code []byte, addr uint16, p chip8.Platform) (Instruction, bool) {
+	if len(code) < 2 {
+		return Instruction{}, false
+	}
+
+	d := chip8.Decode(uint16(code[0])<<8|uint16(code[1]), p)
+	in := Instruction{Addr: addr, Bytes: code[:2], TArg: NO_TARGET}
+
+	switch d.Op {
+	case chip8.OP_UNKNOWN:
+		return Instruction{}, false
+	case chip8.OP_PLANE:
+		if d.X > 3 {
+			return Instruction{}, false
+		}
+	case chip8.OP_SAVE_FLAGS, chip8.OP_LOAD_FLAGS:
+		if p != chip8.PLATFORM_XOCHIP && d.X >= 8 {
+			return Instruction{}, false
+		}
+	case chip8.OP_RET, chip8.OP_EXIT:
+		in.flow = FLOW_STOP
+	case chip8.OP_SE_BYTE, chip8.OP_SNE_BYTE, chip8.OP_SE_REG, chip8.OP_SNE_REG, chip8.OP_SKP, chip8.OP_SKNP:
+		in.flow = FLOW_SKIP
+	case chip8.OP_JP:
+		in.flow, in.Target, in.TArg = FLOW_JUMP, d.NNN, 0
+	case chip8.OP_CALL:
+		in.flow, in.Target, in.TArg = FLOW_CALL, d.NNN, 0
+	case chip8.OP_LD_I:
+		in.Target, in.TArg = d.NNN, 1
+	case chip8.OP_JP_V0:
+		in.flow, in.Target, in.TArg = FLOW_TABLE, d.NNN, 1
+		in.Comment = "jump table, targets unknown"
+	case chip8.OP_LD_I_LONG:
+		if len(code) < 4 {
+			return Instruction{}, false
+		}
+		in.Bytes = code[:4]
+		in.Target, in.TArg = uint16(code[2])<<8|uint16(code[3]), 1
+	}
+
+	in.Op, in.Args = d.Mnemonic(in.Target)
+	return in, true
+}
+
+// Size returns the size of the instruction at the start of code, 0 if it is not valid.
+func Size(code []byte, p chip8.Platform) int {
+	in, ok := Decode(code, 0, p)
+	if !ok {
+		return 0
+	}
+	return len(in.Bytes)
+}
@@ -0,0 +1,242 @@
+// Package disasm disassembles CHIP-8, SUPER-CHIP and XO-CHIP ROMs.
+//
+// Code is discovered by following the control flow from the entry point:
+// jumps, calls and skips are followed, everything that is never reached
+// is data. The output re-assembles to the same ROM with the asm package.
+package disasm
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/ministergoose/chip8-emu-go/chip8"
+)
+
+const DATA_PER_LINE = 8
+
+type Options struct {
+	Platform chip8.Platform
+	Start    uint16   // load address of the ROM, START_ADDR if 0
+	Entries  []uint16 // more entry points besides Start
+}
+
+type Program struct {
+	Start        uint16
+	ROM          []byte
+	Instructions []Instruction // code and data in address order, covering the whole ROM
+	Labels       map[uint16]string
+}
+
+// Disassemble discovers the code of rom by recursive descent.
+func Disassemble(rom []byte, opts Options) *Program {
+	if opts.Start == 0 {
+		opts.Start = chip8.START_ADDR
+	}
+	p := &Program{Start: opts.Start, ROM: rom, Labels: map[uint16]string{}}
+	end := int(p.Start) + len(rom)
+	inROM := func(addr uint16) bool {
+		return addr >= p.Start && int(addr) < end
+	}
+
+	code := map[uint16]Instruction{} // decoded instructions by address
+	owner := make([]int, len(rom))   // 1 + offset of the instruction owning a byte, 0 for data
+	conflicts := map[uint16]bool{}   // jump targets inside other instructions
+
+	addLabel := func(addr uint16, prefix string) {
+		if !inROM(addr) {
+			return
+		}
+		if _, ok := p.Labels[addr]; !ok || prefix == "sub" {
+			p.Labels[addr] = fmt.Sprintf("%s_%03X", prefix, addr)
+		}
+	}
+
+	work := append([]uint16{p.Start}, opts.Entries...)
+	for len(work) > 0 {
+		addr := work[len(work)-1]
+		work = work[:len(work)-1]
+
+		for inROM(addr) {
+			off := int(addr - p.Start)
+			if owner[off] != 0 {
+				if owner[off] != off+1 {
+					conflicts[addr] = true
+				}
+				break
+			}
+
+			in, ok := Decode(rom[off:], addr, opts.Platform)
+			// zeros are padding or data, never reached by a real program
+			if !ok || (in.Op == "SYS" && in.Bytes[0] == 0 && in.Bytes[1] == 0) {
+				break
+			}
+			overlap := false
+			for i := range in.Bytes {
+				if owner[off+i] != 0 {
+					overlap = true
+				}
+			}
+			if overlap {
+				conflicts[addr] = true
+				break
+			}
+			for i := range in.Bytes {
+				owner[off+i] = off + 1
+			}
+			code[addr] = in
+
+			next := addr + uint16(len(in.Bytes))
+			switch in.flow {
+			case FLOW_JUMP:
+				addLabel(in.Target, "loc")
+				work = append(work, in.Target)
+			case FLOW_CALL:
+				addLabel(in.Target, "sub")
+				work = append(work, in.Target)
+			case FLOW_SKIP:
+				if inROM(next) {
+					work = append(work, next+uint16(Size(rom[next-p.Start:], opts.Platform)))
+				}
+			case FLOW_TABLE:
+				addLabel(in.Target, "table")
+			case FLOW_NEXT:
+				if in.TArg != NO_TARGET {
+					addLabel(in.Target, "data")
+				}
+			}
+			if in.flow == FLOW_JUMP || in.flow == FLOW_STOP || in.flow == FLOW_TABLE {
+				break
+			}
+			addr = next
+		}
+	}
+
+	// conflicting targets are not at an instruction boundary, they can't have a label
+	for addr := range conflicts {
+		if owner[addr-p.Start] == int(addr-p.Start)+1 {
+			continue
+		}
+		if _, ok := p.Labels[addr]; ok {
+			p.Labels[addr] = fmt.Sprintf("mis_%03X", addr)
+		}
+	}
+
+	for off := 0; off < len(rom); {
+		addr := p.Start + uint16(off)
+		if in, ok := code[addr]; ok && owner[off] == off+1 {
+			in.Label = p.Labels[addr]
+			p.Instructions = append(p.Instructions, in)
+			off += len(in.Bytes)
+			continue
+		}
+
+		// a data run ends at code, at a label or after DATA_PER_LINE bytes
+		n := 1
+		for off+n < len(rom) && n < DATA_PER_LINE && owner[off+n] == 0 {
+			if _, ok := p.Labels[addr+uint16(n)]; ok {
+				break
+			}
+			n++
+		}
+		in := Instruction{Addr: addr, Bytes: rom[off : off+n], Data: true, Op: "db", TArg: NO_TARGET, Label: p.Labels[addr]}
+		for _, b := range in.Bytes {
+			in.Args = append(in.Args, hexByte(b))
+		}
+		p.Instructions = append(p.Instructions, in)
+		off += n
+	}
+
+	return p
+}
+
+// Text formats the instruction, targets are replaced with their labels.
+func (in *Instruction) Text(labels map[uint16]string) string {
+	args := in.Args
+	if in.TArg != NO_TARGET {
+		if name, ok := labels[in.Target]; ok {
+			args = append([]string{}, in.Args...)
+			if strings.HasPrefix(args[in.TArg], "long ") {
+				args[in.TArg] = "long " + name
+			} else {
+				args[in.TArg] = name
+			}
+		}
+	}
+
+	s := in.Op
+	if len(args) > 0 {
+		s += " " + strings.Join(args, ", ")
+	}
+	return s
+}
+
+func (in *Instruction) String() string {
+	return in.Text(nil)
+}
+
+// unplaced returns the labels that are not at the start of an instruction, sorted by address.
+func (p *Program) unplaced() []uint16 {
+	placed := map[uint16]bool{}
+	for _, in := range p.Instructions {
+		placed[in.Addr] = true
+	}
+	var res []uint16
+	for addr := range p.Labels {
+		if !placed[addr] {
+			res = append(res, addr)
+		}
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i] < res[j] })
+	return res
+}
+
+// Write writes assembler source that re-assembles to the ROM.
+func (p *Program) Write(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	if p.Start != chip8.START_ADDR {
+		fmt.Fprintf(bw, "\torg 0x%03X\n", p.Start)
+	}
+	for _, addr := range p.unplaced() {
+		fmt.Fprintf(bw, "%s equ 0x%03X\n", p.Labels[addr], addr)
+	}
+
+	for i := range p.Instructions {
+		in := &p.Instructions[i]
+		if in.Label != "" {
+			fmt.Fprintf(bw, "%s:\n", in.Label)
+		}
+		line := "\t" + in.Text(p.Labels)
+		if in.Comment != "" {
+			line += "\t; " + in.Comment
+		}
+		fmt.Fprintln(bw, line)
+	}
+	return bw.Flush()
+}
+
+// WriteListing writes the instructions with their addresses and bytes.
+func (p *Program) WriteListing(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	for i := range p.Instructions {
+		in := &p.Instructions[i]
+		if in.Label != "" {
+			fmt.Fprintf(bw, "%s:\n", in.Label)
+		}
+		hex := ""
+		for _, b := range in.Bytes {
+			hex += fmt.Sprintf("%02X", b)
+		}
+		if len(hex) > 8 {
+			hex = hex[:8] + "+"
+		}
+		line := fmt.Sprintf("%04X  %-9s  %s", in.Addr, hex, in.Text(p.Labels))
+		if in.Comment != "" {
+			line += "\t; " + in.Comment
+		}
+		fmt.Fprintln(bw, line)
+	}
+	return bw.Flush()
+}
@@ -0,0 +1,504 @@
+// Package gdb exposes a chip8.Debugger over the GDB Remote Serial Protocol.
+package gdb
+
+import (
+	"bufio"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/ministergoose/chip8-emu-go/chip8"
+)
+
+const (
+	PACKET_SIZE = 0x4000
+	INTERRUPT   = "\x03"
+)
+
+// register sizes in bytes in the g/G packets, in chip8.Reg order
+var REG_SIZES []int = []int{1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 2, 2, 1, 1, 1}
+
+type Server struct {
+	dbg     *chip8.Debugger
+	mu      sync.Mutex // guards w and noAck
+	w       *bufio.Writer
+	noAck   bool
+	packets chan string
+}
+
+func NewServer(dbg *chip8.Debugger) *Server {
+	return &Server{dbg: dbg}
+}
+
+// Accept waits for a single client connection on addr.
+func Accept(addr string) (net.Conn, error) {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	defer ln.Close()
+
+	log.Printf("waiting for GDB connection on %s", ln.Addr())
+	return ln.Accept()
+}
+
+// Serve handles the session until the client detaches or the connection is closed.
+func (s *Server) Serve(conn io.ReadWriter) error {
+	s.w = bufio.NewWriter(conn)
+	s.packets = make(chan string)
+	errs := make(chan error, 1)
+	go func() {
+		errs <- s.readPackets(bufio.NewReader(conn))
+		close(s.packets)
+	}()
+
+	for pkt := range s.packets {
+		if pkt == INTERRUPT {
+			continue
+		}
+		detach, err := s.handle(pkt)
+		if err != nil {
+			return err
+		}
+		if detach {
+			return nil
+		}
+	}
+
+	return <-errs
+}
+
+func (s *Server) readPackets(r *bufio.Reader) error {
+	for {
+		b, err := r.ReadByte()
+		if err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+
+		switch b {
+		case INTERRUPT[0]:
+			s.packets <- INTERRUPT
+		case '$':
+			data, err := r.ReadString('#')
+			if err != nil {
+				return err
+			}
+			var sum [2]byte
+			_, err = io.ReadFull(r, sum[:])
+			if err != nil {
+				return err
+			}
+			data = data[:len(data)-1]
+			if s.acking() {
+				if fmt.Sprintf("%02x", checksum(data)) != strings.ToLower(string(sum[:])) {
+					s.writeRaw("-")
+					continue
+				}
+				s.writeRaw("+")
+			}
+			s.packets <- unescape(data)
+		}
+	}
+}
+
+func checksum(data string) byte {
+	var sum byte
+	for i := 0; i < len(data); i++ {
+		sum += data[i]
+	}
+	return sum
+}
+
+func unescape(data string) string {
+	if !strings.Contains(data, "}") {
+		return data
+	}
+	var sb strings.Builder
+	for i := 0; i < len(data); i++ {
+		if data[i] == '}' && i+1 < len(data) {
+			i++
+			sb.WriteByte(data[i] ^ 0x20)
+		} else {
+			sb.WriteByte(data[i])
+		}
+	}
+	return sb.String()
+}
+
+func (s *Server) acking() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return !s.noAck
+}
+
+func (s *Server) writeRaw(data string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.w.WriteString(data)
+	s.w.Flush()
+}
+
+func (s *Server) send(data string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, err := fmt.Fprintf(s.w, "$%s#%02x", data, checksum(data))
+	if err != nil {
+		return err
+	}
+	return s.w.Flush()
+}
+
+func (s *Server) handle(pkt string) (bool, error) {
+	if len(pkt) == 0 {
+		return false, s.send("")
+	}
+
+	switch pkt[0] {
+	case '?':
+		return false, s.send("S05")
+	case 'g':
+		return false, s.send(s.readRegisters())
+	case 'G':
+		return false, s.send(s.writeRegisters(pkt[1:]))
+	case 'p':
+		return false, s.send(s.readRegister(pkt[1:]))
+	case 'P':
+		return false, s.send(s.writeRegister(pkt[1:]))
+	case 'm':
+		return false, s.send(s.readMemory(pkt[1:]))
+	case 'M':
+		return false, s.send(s.writeMemory(pkt[1:]))
+	case 'Z', 'z':
+		return false, s.send(s.breakpoint(pkt[0] == 'Z', pkt[1:]))
+	case 's':
+		return false, s.resume(s.dbg.StepInto)
+	case 'c':
+		return false, s.resume(s.dbg.Continue)
+	case 'H', 'T':
+		return false, s.send("OK")
+	case 'D':
+		s.dbg.Continue()
+		return true, s.send("OK")
+	case 'k':
+		return true, nil
+	case 'v':
+		return false, s.handleV(pkt)
+	case 'q', 'Q':
+		return false, s.handleQuery(pkt)
+	}
+
+	return false, s.send("")
+}
+
+func (s *Server) handleV(pkt string) error {
+	switch {
+	case pkt == "vCont?":
+		return s.send("vCont;c;C;s;S")
+	case strings.HasPrefix(pkt, "vCont;s"), strings.HasPrefix(pkt, "vCont;S"):
+		return s.resume(s.dbg.StepInto)
+	case strings.HasPrefix(pkt, "vCont;c"), strings.HasPrefix(pkt, "vCont;C"):
+		return s.resume(s.dbg.Continue)
+	case pkt == "vMustReplyEmpty":
+		return s.send("")
+	}
+	return s.send("")
+}
+
+func (s *Server) handleQuery(pkt string) error {
+	switch {
+	case strings.HasPrefix(pkt, "qSupported"):
+		return s.send(fmt.Sprintf("PacketSize=%x;qXfer:features:read+;QStartNoAckMode+;swbreak+", PACKET_SIZE))
+	case pkt == "QStartNoAckMode":
+		// set before the reply, the packets after it come without checksums to check
+		s.mu.Lock()
+		s.noAck = true
+		s.mu.Unlock()
+		return s.send("OK")
+	case strings.HasPrefix(pkt, "qXfer:features:read:target.xml:"):
+		return s.send(xfer(TargetXML(), strings.TrimPrefix(pkt, "qXfer:features:read:target.xml:")))
+	case pkt == "qAttached":
+		return s.send("1")
+	case pkt == "qC":
+		return s.send("QC1")
+	case pkt == "qfThreadInfo":
+		return s.send("m1")
+	case pkt == "qsThreadInfo":
+		return s.send("l")
+	case strings.HasPrefix(pkt, "qOffsets"):
+		return s.send("Text=0;Data=0;Bss=0")
+	}
+	return s.send("")
+}
+
+// resume runs the Cpu until it stops or the client interrupts, then reports the stop.
+func (s *Server) resume(f func()) error {
+drain:
+	for {
+		select {
+		case <-s.dbg.Events():
+		default:
+			break drain
+		}
+	}
+
+	f()
+	for {
+		select {
+		case ev := <-s.dbg.Events():
+			return s.send(stopReply(ev))
+		case pkt, ok := <-s.packets:
+			if !ok {
+				s.dbg.Pause()
+				return nil
+			}
+			if pkt == INTERRUPT {
+				s.dbg.Pause()
+			}
+		}
+	}
+}
+
+func stopReply(ev chip8.StopEvent) string {
+	switch ev.Reason {
+	case chip8.STOP_BREAKPOINT:
+		return "T05swbreak:;thread:1;"
+	case chip8.STOP_WATCHPOINT:
+		kind := "awatch"
+		if ev.Kind == chip8.WATCH_WRITE {
+			kind = "watch"
+		} else if ev.Kind == chip8.WATCH_READ {
+			kind = "rwatch"
+		}
+		return fmt.Sprintf("T05%s:%x;thread:1;", kind, ev.Addr)
+	case chip8.STOP_PAUSE:
+		return "T02thread:1;"
+	}
+	return "T05thread:1;"
+}
+
+func xfer(data, args string) string {
+	parts := strings.Split(args, ",")
+	if len(parts) != 2 {
+		return "E01"
+	}
+	offset, err1 := strconv.ParseUint(parts[0], 16, 32)
+	length, err2 := strconv.ParseUint(parts[1], 16, 32)
+	if err1 != nil || err2 != nil {
+		return "E01"
+	}
+
+	if offset >= uint64(len(data)) {
+		return "l"
+	}
+	end := offset + length
+	if end >= uint64(len(data)) {
+		return "l" + data[offset:]
+	}
+	return "m" + data[offset:end]
+}
+
+// encodeReg encodes a register value little endian, as GDB expects by default.
+func encodeReg(val uint16, size int) string {
+	if size == 1 {
+		return fmt.Sprintf("%02x", byte(val))
+	}
+	return fmt.Sprintf("%02x%02x", byte(val), byte(val>>8))
+}
+
+func decodeReg(data string, size int) (uint16, error) {
+	b, err := hex.DecodeString(data)
+	if err != nil || len(b) != size {
+		return 0, fmt.Errorf("bad register value: %s", data)
+	}
+	if size == 1 {
+		return uint16(b[0]), nil
+	}
+	return uint16(b[0]) | uint16(b[1])<<8, nil
+}
+
+func (s *Server) readRegisters() string {
+	regs := s.dbg.Registers()
+	var sb strings.Builder
+	for reg := chip8.REG_V0; reg < chip8.REG_COUNT; reg++ {
+		sb.WriteString(encodeReg(regs.Get(reg), REG_SIZES[reg]))
+	}
+	return sb.String()
+}
+
+func (s *Server) writeRegisters(data string) string {
+	pos := 0
+	for reg := chip8.REG_V0; reg < chip8.REG_COUNT; reg++ {
+		size := REG_SIZES[reg]
+		if pos+size*2 > len(data) {
+			return "E01"
+		}
+		val, err := decodeReg(data[pos:pos+size*2], size)
+		if err != nil {
+			return "E01"
+		}
+		if err = s.dbg.SetRegister(reg, val); err != nil {
+			return "E01"
+		}
+		pos += size * 2
+	}
+	return "OK"
+}
+
+func parseRegNum(data string) (chip8.Reg, bool) {
+	n, err := strconv.ParseUint(data, 16, 8)
+	if err != nil || chip8.Reg(n) >= chip8.REG_COUNT {
+		return 0, false
+	}
+	return chip8.Reg(n), true
+}
+
+func (s *Server) readRegister(data string) string {
+	reg, ok := parseRegNum(data)
+	if !ok {
+		return "E01"
+	}
+	regs := s.dbg.Registers()
+	return encodeReg(regs.Get(reg), REG_SIZES[reg])
+}
+
+func (s *Server) writeRegister(data string) string {
+	parts := strings.SplitN(data, "=", 2)
+	if len(parts) != 2 {
+		return "E01"
+	}
+	reg, ok := parseRegNum(parts[0])
+	if !ok {
+		return "E01"
+	}
+	val, err := decodeReg(parts[1], REG_SIZES[reg])
+	if err != nil {
+		return "E01"
+	}
+	if err = s.dbg.SetRegister(reg, val); err != nil {
+		return "E01"
+	}
+	return "OK"
+}
+
+func parseAddrLen(data string) (uint16, int, error) {
+	parts := strings.SplitN(data, ",", 2)
+	if len(parts) != 2 {
+		return 0, 0, fmt.Errorf("bad address: %s", data)
+	}
+	addr, err := strconv.ParseUint(parts[0], 16, 16)
+	if err != nil {
+		return 0, 0, err
+	}
+	length, err := strconv.ParseUint(parts[1], 16, 32)
+	if err != nil {
+		return 0, 0, err
+	}
+	// the hex of the memory must fit in a packet
+	if length > PACKET_SIZE/2 {
+		return 0, 0, fmt.Errorf("bad length: %s", parts[1])
+	}
+	return uint16(addr), int(length), nil
+}
+
+func (s *Server) readMemory(data string) string {
+	addr, length, err := parseAddrLen(data)
+	if err != nil {
+		return "E01"
+	}
+	mem := s.dbg.ReadMemory(addr, length)
+	if len(mem) == 0 && length > 0 {
+		return "E14"
+	}
+	return hex.EncodeToString(mem)
+}
+
+func (s *Server) writeMemory(data string) string {
+	parts := strings.SplitN(data, ":", 2)
+	if len(parts) != 2 {
+		return "E01"
+	}
+	addr, length, err := parseAddrLen(parts[0])
+	if err != nil {
+		return "E01"
+	}
+	mem, err := hex.DecodeString(parts[1])
+	if err != nil || len(mem) != length {
+		return "E01"
+	}
+	if err = s.dbg.WriteMemory(addr, mem); err != nil {
+		return "E14"
+	}
+	return "OK"
+}
+
+// breakpoint handles Z/z type,addr,kind.
+func (s *Server) breakpoint(insert bool, data string) string {
+	parts := strings.Split(data, ",")
+	if len(parts) < 3 {
+		return "E01"
+	}
+	addr, length, err := parseAddrLen(parts[1] + "," + parts[2])
+	if err != nil {
+		return "E01"
+	}
+
+	var kind chip8.WatchKind
+	switch parts[0] {
+	case "0", "1":
+		if insert {
+			s.dbg.AddBreakpoint(addr)
+		} else {
+			s.dbg.RemoveBreakpoint(addr)
+		}
+		return "OK"
+	case "2":
+		kind = chip8.WATCH_WRITE
+	case "3":
+		kind = chip8.WATCH_READ
+	case "4":
+		kind = chip8.WATCH_ACCESS
+	default:
+		return ""
+	}
+
+	w := chip8.Watchpoint{Addr: addr, Len: uint16(length), Kind: kind}
+	if insert {
+		s.dbg.AddWatchpoint(w)
+	} else {
+		s.dbg.RemoveWatchpoint(w)
+	}
+	return "OK"
+}
+
+// TargetXML describes the CHIP-8 registers in the g/G packet order.
+func TargetXML() string {
+	var sb strings.Builder
+	sb.WriteString(`<?xml version="1.0"?>
+<!DOCTYPE target SYSTEM "gdb-target.dtd">
+<target version="1.0">
+  <feature name="org.chip8.core">
+`)
+	for reg := chip8.REG_V0; reg < chip8.REG_COUNT; reg++ {
+		typ := "uint8"
+		switch reg {
+		case chip8.REG_I:
+			typ = "data_ptr"
+		case chip8.REG_PC:
+			typ = "code_ptr"
+		}
+		fmt.Fprintf(&sb, "    <reg name=\"%s\" bitsize=\"%d\" type=\"%s\" regnum=\"%d\"/>\n", strings.ToLower(reg.String()), REG_SIZES[reg]*8, typ, reg)
+	}
+	sb.WriteString("  </feature>\n</target>\n")
+	return sb.String()
+}
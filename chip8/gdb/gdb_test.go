@@ -0,0 +1,224 @@
+package gdb
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ministergoose/chip8-emu-go/chip8"
+	"github.com/ministergoose/chip8-emu-go/chip8/hardware/headless"
+)
+
+// stores V0 at 0x300, loads it back and increments it, forever
+var ROM []byte = []byte{
+	0x60, 0x05, // 200 LD V0, 0x05
+	0xA3, 0x00, // 202 LD I, 0x300
+	0xF0, 0x55, // 204 LD [I], V0
+	0xF0, 0x65, // 206 LD V0, [I]
+	0x70, 0x01, // 208 ADD V0, 0x01
+	0x12, 0x04, // 20A JP 0x204
+}
+
+type client struct {
+	t     *testing.T
+	conn  net.Conn
+	r     *bufio.Reader
+	noAck bool
+}
+
+// session starts a paused Cpu running ROM and a Server for it, and returns
+// the client end of the connection.
+func session(t *testing.T) *client {
+	c := chip8.NewCPU(headless.NewDisplayHeadless(), headless.NewKeyboardHeadless(), headless.NewSoundHeadless(), chip8.QUIRKS_CHIP48)
+	err := c.LoadROM(ROM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dbg := chip8.NewDebugger(c)
+	dbg.Pause()
+
+	quit := make(chan bool)
+	go func() {
+		for {
+			select {
+			case <-quit:
+				return
+			default:
+				// like Cpu.Run
+				if !dbg.Paused() {
+					c.RunFrame()
+				}
+				time.Sleep(time.Millisecond)
+			}
+		}
+	}()
+
+	conn, serverConn := net.Pipe()
+	errs := make(chan error, 1)
+	go func() {
+		errs <- NewServer(dbg).Serve(serverConn)
+		serverConn.Close()
+	}()
+	t.Cleanup(func() {
+		conn.Close()
+		if err := <-errs; err != nil {
+			t.Error(err)
+		}
+		close(quit)
+	})
+
+	conn.SetDeadline(time.Now().Add(10 * time.Second))
+	return &client{t: t, conn: conn, r: bufio.NewReader(conn)}
+}
+
+// exchange sends a packet and returns the reply.
+func (cl *client) exchange(pkt string) string {
+	cl.t.Helper()
+	_, err := fmt.Fprintf(cl.conn, "$%s#%02x", pkt, checksum(pkt))
+	if err != nil {
+		cl.t.Fatal(err)
+	}
+	if !cl.noAck {
+		ack, err := cl.r.ReadByte()
+		if err != nil || ack != '+' {
+			cl.t.Fatalf("%s: no ack, got %q %v", pkt, ack, err)
+		}
+	}
+	return cl.reply()
+}
+
+// reply reads a packet from the server.
+func (cl *client) reply() string {
+	cl.t.Helper()
+	start, err := cl.r.ReadByte()
+	if err != nil || start != '$' {
+		cl.t.Fatalf("expected a packet, got %q %v", start, err)
+	}
+	data, err := cl.r.ReadString('#')
+	if err != nil {
+		cl.t.Fatal(err)
+	}
+	data = data[:len(data)-1]
+	var sum [2]byte
+	_, err = io.ReadFull(cl.r, sum[:])
+	if err != nil {
+		cl.t.Fatal(err)
+	}
+	if fmt.Sprintf("%02x", checksum(data)) != string(sum[:]) {
+		cl.t.Fatalf("bad checksum of %q: %s", data, sum)
+	}
+	if !cl.noAck {
+		cl.conn.Write([]byte("+"))
+	}
+	return data
+}
+
+func (cl *client) expect(pkt, want string) {
+	cl.t.Helper()
+	if got := cl.exchange(pkt); got != want {
+		cl.t.Fatalf("%s: got %q, want %q", pkt, got, want)
+	}
+}
+
+// pc returns PC from a g reply, it is little endian after V0-VF and I.
+func pc(regs string) string {
+	return regs[38:40] + regs[36:38]
+}
+
+func TestRegisters(t *testing.T) {
+	cl := session(t)
+	cl.expect("?", "S05")
+
+	regs := cl.exchange("g")
+	if len(regs) != 2*(16+2+2+3) {
+		t.Fatalf("g: %d hex digits", len(regs))
+	}
+	if regs[32:40] != "00000002" {
+		t.Fatalf("g: I and PC are %s, want 0000 0002", regs[32:40])
+	}
+
+	// V1 = 0x42, I = 0x0345
+	regs = regs[:2] + "42" + regs[4:32] + "4503" + regs[36:]
+	cl.expect("G"+regs, "OK")
+	cl.expect("p1", "42")
+	cl.expect("p10", "4503")
+	cl.expect("g", regs)
+
+	cl.expect("P0=7f", "OK")
+	cl.expect("p0", "7f")
+	cl.expect("G00", "E01")
+	cl.expect("p20", "E01")
+	cl.expect("D", "OK")
+}
+
+func TestMemory(t *testing.T) {
+	cl := session(t)
+	cl.expect("m200,4", "6005a300")
+	cl.expect("M300,3:abcdef", "OK")
+	cl.expect("m300,3", "abcdef")
+	cl.expect("M300,2:ab", "E01")
+	cl.expect("m0,ffffffff", "E01")
+	cl.expect(fmt.Sprintf("m0,%x", PACKET_SIZE/2+1), "E01")
+	cl.expect("m1000,1", "E14")
+	cl.expect("D", "OK")
+}
+
+func TestBreakpoints(t *testing.T) {
+	cl := session(t)
+
+	cl.expect("Z0,208,2", "OK")
+	cl.expect("c", "T05swbreak:;thread:1;")
+	if got := pc(cl.exchange("g")); got != "0208" {
+		t.Fatalf("breakpoint at %s, want 0208", got)
+	}
+	cl.expect("z0,208,2", "OK")
+
+	cl.expect("Z3,300,1", "OK")
+	cl.expect("c", "T05rwatch:300;thread:1;")
+	// stops after LD V0, [I]
+	if got := pc(cl.exchange("g")); got != "0208" {
+		t.Fatalf("read watchpoint at %s, want 0208", got)
+	}
+	cl.expect("z3,300,1", "OK")
+
+	cl.expect("Z2,300,1", "OK")
+	cl.expect("c", "T05watch:300;thread:1;")
+	if got := pc(cl.exchange("g")); got != "0206" {
+		t.Fatalf("write watchpoint at %s, want 0206", got)
+	}
+	cl.expect("z2,300,1", "OK")
+
+	cl.expect("s", "T05thread:1;")
+	if got := pc(cl.exchange("g")); got != "0208" {
+		t.Fatalf("step to %s, want 0208", got)
+	}
+	cl.expect("vCont;s:1", "T05thread:1;")
+	if got := pc(cl.exchange("g")); got != "020a" {
+		t.Fatalf("step to %s, want 020a", got)
+	}
+	cl.expect("D", "OK")
+}
+
+func TestNoAckMode(t *testing.T) {
+	cl := session(t)
+	if got := cl.exchange("qSupported:swbreak+"); !strings.Contains(got, "QStartNoAckMode+") {
+		t.Fatalf("qSupported: %s", got)
+	}
+	cl.expect("QStartNoAckMode", "OK")
+
+	// the checksums are not checked any more, and there are no acks
+	cl.noAck = true
+	_, err := fmt.Fprintf(cl.conn, "$m200,2#00")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := cl.reply(); got != "6005" {
+		t.Fatalf("m200,2: got %q, want 6005", got)
+	}
+	cl.expect("m202,2", "a300")
+	cl.expect("D", "OK")
+}
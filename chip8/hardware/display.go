@@ -1,16 +1,28 @@
-package hardware
-
-const (
-	DISPLAY_WIDTH  = 64
-	DISPLAY_HEIGHT = 32
-)
-
-type Display interface {
-	Init(title string, scale float32)
-	PutPixel(x, y byte) bool
-	Draw()
-	Cls()
-	Dump()
-	ShouldClose() bool
-	Close()
-}
+package hardware
+
+const (
+	DISPLAY_WIDTH  = 64
+	DISPLAY_HEIGHT = 32
+
+	DISPLAY_HIRES_WIDTH  = 128
+	DISPLAY_HIRES_HEIGHT = 64
+)
+
+type Display interface {
+	Init(title string, scale float32)
+	SetHiRes(hires bool)
+	Width() byte
+	Height() byte
+	SetPlanes(planes byte)
+	PutPixel(x, y, plane byte) bool
+	ScrollUp(n byte)
+	ScrollDown(n byte)
+	ScrollLeft(n byte)
+	ScrollRight(n byte)
+	Draw()
+	Cls()
+	Dump()
+	Buffer() *Framebuffer
+	ShouldClose() bool
+	Close()
+}
@@ -1,34 +1,66 @@
-package empty
-
-type DisplayEmpty struct {
-}
-
-func NewDisplayEmpty() *DisplayEmpty {
-	return &DisplayEmpty{}
-}
-
-func (dspl *DisplayEmpty) Init(title string, scale float32) {
-}
-
-func (dspl *DisplayEmpty) PutPixel(x, y byte) bool {
-	return false
-}
-
-func (dspl *DisplayEmpty) Draw() {
-}
-
-func (dspl *DisplayEmpty) Cls() {
-
-}
-
-func (dspl *DisplayEmpty) Dump() {
-
-}
-
-func (dspl *DisplayEmpty) ShouldClose() bool {
-	return false
-}
-
-func (dspl *DisplayEmpty) Close() {
-
-}
+package empty
+
+import "github.com/ministergoose/chip8-emu-go/chip8/hardware"
+
+type DisplayEmpty struct {
+}
+
+func NewDisplayEmpty() *DisplayEmpty {
+	return &DisplayEmpty{}
+}
+
+func (dspl *DisplayEmpty) Init(title string, scale float32) {
+}
+
+func (dspl *DisplayEmpty) SetHiRes(hires bool) {
+}
+
+func (dspl *DisplayEmpty) Width() byte {
+	return hardware.DISPLAY_WIDTH
+}
+
+func (dspl *DisplayEmpty) Height() byte {
+	return hardware.DISPLAY_HEIGHT
+}
+
+func (dspl *DisplayEmpty) SetPlanes(planes byte) {
+}
+
+func (dspl *DisplayEmpty) PutPixel(x, y, plane byte) bool {
+	return false
+}
+
+func (dspl *DisplayEmpty) ScrollUp(n byte) {
+}
+
+func (dspl *DisplayEmpty) ScrollDown(n byte) {
+}
+
+func (dspl *DisplayEmpty) ScrollLeft(n byte) {
+}
+
+func (dspl *DisplayEmpty) ScrollRight(n byte) {
+}
+
+func (dspl *DisplayEmpty) Draw() {
+}
+
+func (dspl *DisplayEmpty) Cls() {
+
+}
+
+func (dspl *DisplayEmpty) Dump() {
+
+}
+
+func (dspl *DisplayEmpty) Buffer() *hardware.Framebuffer {
+	return nil
+}
+
+func (dspl *DisplayEmpty) ShouldClose() bool {
+	return false
+}
+
+func (dspl *DisplayEmpty) Close() {
+
+}
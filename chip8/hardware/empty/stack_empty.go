@@ -1,20 +1,28 @@
-package empty
-
-type StackEmpty struct {
-}
-
-func NewStackEmpty() *StackEmpty {
-	return &StackEmpty{}
-}
-
-func (s *StackEmpty) Reset() {
-
-}
-
-func (s *StackEmpty) Push(addr uint16) error {
-	return nil
-}
-
-func (s *StackEmpty) Pop() (uint16, error) {
-	return 0, nil
-}
+package empty
+
+type StackEmpty struct {
+}
+
+func NewStackEmpty() *StackEmpty {
+	return &StackEmpty{}
+}
+
+func (s *StackEmpty) Reset() {
+
+}
+
+func (s *StackEmpty) Push(addr uint16) error {
+	return nil
+}
+
+func (s *StackEmpty) Pop() (uint16, error) {
+	return 0, nil
+}
+
+func (s *StackEmpty) State() ([]uint16, byte) {
+	return nil, 0
+}
+
+func (s *StackEmpty) Restore(stack []uint16, index byte) error {
+	return nil
+}
@@ -0,0 +1,146 @@
+package hardware
+
+import "fmt"
+
+const FRAMEBUFFER_STATE_SIZE = 3 + DISPLAY_HIRES_WIDTH*DISPLAY_HIRES_HEIGHT
+
+// Framebuffer keeps the pixels of a 64x32 or 128x64 display and implements
+// the drawing part of the Display interface for the backends.
+// Every pixel is a bitmask of the XO-CHIP planes it is set on, i.e. one of the four colors.
+type Framebuffer struct {
+	Pixels [DISPLAY_HIRES_HEIGHT][DISPLAY_HIRES_WIDTH]byte
+	width  byte
+	height byte
+	planes byte // planes affected by Cls and scrolling
+}
+
+func NewFramebuffer() *Framebuffer {
+	return &Framebuffer{width: DISPLAY_WIDTH, height: DISPLAY_HEIGHT, planes: 1}
+}
+
+// SetHiRes switches the resolution and clears all planes.
+func (fb *Framebuffer) SetHiRes(hires bool) {
+	if hires {
+		fb.width, fb.height = DISPLAY_HIRES_WIDTH, DISPLAY_HIRES_HEIGHT
+	} else {
+		fb.width, fb.height = DISPLAY_WIDTH, DISPLAY_HEIGHT
+	}
+	fb.Pixels = [DISPLAY_HIRES_HEIGHT][DISPLAY_HIRES_WIDTH]byte{}
+}
+
+func (fb *Framebuffer) Width() byte {
+	return fb.width
+}
+
+func (fb *Framebuffer) Height() byte {
+	return fb.height
+}
+
+func (fb *Framebuffer) SetPlanes(planes byte) {
+	fb.planes = planes
+}
+
+func (fb *Framebuffer) PutPixel(x, y, plane byte) bool {
+	if x < fb.width && y < fb.height {
+		fb.Pixels[y][x] ^= plane
+		return (fb.Pixels[y][x] & plane) == 0
+	}
+
+	return false
+}
+
+// move copies the selected planes of pixel (sx, sy) to (x, y), clearing them when the source is off screen.
+func (fb *Framebuffer) move(x, y, sx, sy int) {
+	src := byte(0)
+	if sx >= 0 && sx < int(fb.width) && sy >= 0 && sy < int(fb.height) {
+		src = fb.Pixels[sy][sx] & fb.planes
+	}
+	fb.Pixels[y][x] = (fb.Pixels[y][x] &^ fb.planes) | src
+}
+
+func (fb *Framebuffer) ScrollUp(n byte) {
+	for y := 0; y < int(fb.height); y++ {
+		for x := 0; x < int(fb.width); x++ {
+			fb.move(x, y, x, y+int(n))
+		}
+	}
+}
+
+func (fb *Framebuffer) ScrollDown(n byte) {
+	for y := int(fb.height) - 1; y >= 0; y-- {
+		for x := 0; x < int(fb.width); x++ {
+			fb.move(x, y, x, y-int(n))
+		}
+	}
+}
+
+func (fb *Framebuffer) ScrollLeft(n byte) {
+	for y := 0; y < int(fb.height); y++ {
+		for x := 0; x < int(fb.width); x++ {
+			fb.move(x, y, x+int(n), y)
+		}
+	}
+}
+
+func (fb *Framebuffer) ScrollRight(n byte) {
+	for y := 0; y < int(fb.height); y++ {
+		for x := int(fb.width) - 1; x >= 0; x-- {
+			fb.move(x, y, x-int(n), y)
+		}
+	}
+}
+
+func (fb *Framebuffer) Cls() {
+	for y := 0; y < DISPLAY_HIRES_HEIGHT; y++ {
+		for x := 0; x < DISPLAY_HIRES_WIDTH; x++ {
+			fb.Pixels[y][x] &^= fb.planes
+		}
+	}
+}
+
+func (fb *Framebuffer) Dump() {
+	fmt.Print("  |")
+	for x := 0; x < int(fb.width); x++ {
+		fmt.Printf("%02d|", x)
+	}
+
+	for y := 0; y < int(fb.height); y++ {
+		fmt.Printf("\n%02d|", y)
+		for x := 0; x < int(fb.width); x++ {
+			fmt.Printf("%2d|", fb.Pixels[y][x])
+		}
+	}
+	fmt.Println()
+}
+
+func (fb *Framebuffer) Buffer() *Framebuffer {
+	return fb
+}
+
+func (fb *Framebuffer) MarshalBinary() ([]byte, error) {
+	data := make([]byte, 0, FRAMEBUFFER_STATE_SIZE)
+	data = append(data, fb.width, fb.height, fb.planes)
+	for y := 0; y < DISPLAY_HIRES_HEIGHT; y++ {
+		data = append(data, fb.Pixels[y][:]...)
+	}
+
+	return data, nil
+}
+
+func (fb *Framebuffer) UnmarshalBinary(data []byte) error {
+	if len(data) != FRAMEBUFFER_STATE_SIZE {
+		return fmt.Errorf("bad framebuffer size: %d", len(data))
+	}
+
+	width, height := data[0], data[1]
+	if !(width == DISPLAY_WIDTH && height == DISPLAY_HEIGHT) && !(width == DISPLAY_HIRES_WIDTH && height == DISPLAY_HIRES_HEIGHT) {
+		return fmt.Errorf("bad framebuffer resolution: %dx%d", width, height)
+	}
+
+	fb.width, fb.height, fb.planes = width, height, data[2]
+	for y := 0; y < DISPLAY_HIRES_HEIGHT; y++ {
+		copy(fb.Pixels[y][:], data[3+y*DISPLAY_HIRES_WIDTH:])
+	}
+
+	return nil
+}
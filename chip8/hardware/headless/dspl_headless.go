@@ -0,0 +1,127 @@
+// Package headless runs the emulator without a window, e.g. in tests and CI.
+package headless
+
+import (
+	"image"
+	"image/color"
+
+	"github.com/ministergoose/chip8-emu-go/chip8/hardware"
+)
+
+// PALETTE are the colors of Image: background, plane 1, plane 2 and both planes.
+var PALETTE color.Palette = color.Palette{
+	color.RGBA{0x00, 0x00, 0x00, 0xff},
+	color.RGBA{0x00, 0xe4, 0x30, 0xff},
+	color.RGBA{0xff, 0xa1, 0x00, 0xff},
+	color.RGBA{0x00, 0x75, 0x2c, 0xff},
+}
+
+// DisplayHeadless keeps the framebuffer in memory and counts the frames.
+type DisplayHeadless struct {
+	hardware.Framebuffer
+
+	frames    int
+	draws     int  // frames that changed the screen
+	maxFrames int  // ShouldClose after that many frames, 0 never
+	dirty     bool // pixels changed since the last frame
+	closed    bool
+}
+
+func NewDisplayHeadless() *DisplayHeadless {
+	return &DisplayHeadless{Framebuffer: *hardware.NewFramebuffer()}
+}
+
+func (dspl *DisplayHeadless) Init(title string, scale float32) {
+}
+
+// SetMaxFrames makes ShouldClose return true after n frames.
+func (dspl *DisplayHeadless) SetMaxFrames(n int) {
+	dspl.maxFrames = n
+}
+
+func (dspl *DisplayHeadless) SetHiRes(hires bool) {
+	dspl.Framebuffer.SetHiRes(hires)
+	dspl.dirty = true
+}
+
+func (dspl *DisplayHeadless) PutPixel(x, y, plane byte) bool {
+	dspl.dirty = true
+	return dspl.Framebuffer.PutPixel(x, y, plane)
+}
+
+func (dspl *DisplayHeadless) ScrollUp(n byte) {
+	dspl.Framebuffer.ScrollUp(n)
+	dspl.dirty = true
+}
+
+func (dspl *DisplayHeadless) ScrollDown(n byte) {
+	dspl.Framebuffer.ScrollDown(n)
+	dspl.dirty = true
+}
+
+func (dspl *DisplayHeadless) ScrollLeft(n byte) {
+	dspl.Framebuffer.ScrollLeft(n)
+	dspl.dirty = true
+}
+
+func (dspl *DisplayHeadless) ScrollRight(n byte) {
+	dspl.Framebuffer.ScrollRight(n)
+	dspl.dirty = true
+}
+
+func (dspl *DisplayHeadless) Cls() {
+	dspl.Framebuffer.Cls()
+	dspl.dirty = true
+}
+
+func (dspl *DisplayHeadless) Draw() {
+	dspl.frames++
+	if dspl.dirty {
+		dspl.draws++
+		dspl.dirty = false
+	}
+}
+
+// Frames returns the number of frames drawn.
+func (dspl *DisplayHeadless) Frames() int {
+	return dspl.frames
+}
+
+// Draws returns the number of frames in which the screen changed.
+func (dspl *DisplayHeadless) Draws() int {
+	return dspl.draws
+}
+
+func (dspl *DisplayHeadless) ShouldClose() bool {
+	return dspl.closed || (dspl.maxFrames > 0 && dspl.frames >= dspl.maxFrames)
+}
+
+func (dspl *DisplayHeadless) Close() {
+	dspl.closed = true
+}
+
+// Image returns a copy of the screen in the current resolution, the color
+// indices are the planes of the pixels.
+func (dspl *DisplayHeadless) Image() *image.Paletted {
+	w, h := int(dspl.Width()), int(dspl.Height())
+	img := image.NewPaletted(image.Rect(0, 0, w, h), PALETTE)
+	for y := 0; y < h; y++ {
+		copy(img.Pix[y*img.Stride:], dspl.Pixels[y][:w])
+	}
+	return img
+}
+
+// Bits returns the screen with one bit per pixel that is set on any plane,
+// row by row with the leftmost pixel in the highest bit.
+func (dspl *DisplayHeadless) Bits() []byte {
+	w, h := int(dspl.Width()), int(dspl.Height())
+	bits := make([]byte, w/8*h)
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			if dspl.Pixels[y][x] != 0 {
+				bits[(y*w+x)/8] |= 0x80 >> (x % 8)
+			}
+		}
+	}
+	return bits
+}
@@ -0,0 +1,41 @@
+package headless
+
+// KeyboardHeadless returns the keys set by the program driving the emulator.
+type KeyboardHeadless struct {
+	keys     uint16
+	prev     uint16 // keys of the last ReadKeys
+	released uint16
+}
+
+func NewKeyboardHeadless() *KeyboardHeadless {
+	return &KeyboardHeadless{}
+}
+
+// SetKeys sets the pressed keys, bit n is key n.
+func (kbrd *KeyboardHeadless) SetKeys(keys uint16) {
+	kbrd.keys = keys
+}
+
+func (kbrd *KeyboardHeadless) Press(key byte) {
+	kbrd.keys |= 1 << (key & 0xf)
+}
+
+func (kbrd *KeyboardHeadless) Release(key byte) {
+	kbrd.keys &^= 1 << (key & 0xf)
+}
+
+func (kbrd *KeyboardHeadless) ReadKeys() uint16 {
+	kbrd.released = kbrd.prev &^ kbrd.keys
+	kbrd.prev = kbrd.keys
+	return kbrd.keys
+}
+
+// WaitKey returns the lowest key released since the frame before, or 0x80.
+func (kbrd *KeyboardHeadless) WaitKey() byte {
+	for i := byte(0); i < 16; i++ {
+		if kbrd.released&(1<<i) != 0 {
+			return i
+		}
+	}
+	return 0x80
+}
@@ -0,0 +1,27 @@
+package headless
+
+import "github.com/ministergoose/chip8-emu-go/chip8/hardware"
+
+// SoundHeadless is silent, it only counts the beeps.
+type SoundHeadless struct {
+	beeps int
+}
+
+func NewSoundHeadless() *SoundHeadless {
+	return &SoundHeadless{}
+}
+
+func (s *SoundHeadless) Beep() {
+	s.beeps++
+}
+
+func (s *SoundHeadless) SetPattern(pattern [hardware.PATTERN_SIZE]byte) {
+}
+
+func (s *SoundHeadless) SetPitch(pitch byte) {
+}
+
+// Beeps returns the number of frames the buzzer was on.
+func (s *SoundHeadless) Beeps() int {
+	return s.beeps
+}
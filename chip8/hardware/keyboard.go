@@ -1,6 +1,6 @@
-package hardware
-
-type Keyboard interface {
-	WaitKey() byte
-	ReadKeys() uint16
-}
+package hardware
+
+type Keyboard interface {
+	WaitKey() byte
+	ReadKeys() uint16
+}
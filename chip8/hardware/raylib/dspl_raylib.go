@@ -1,91 +1,92 @@
-package raylib
-
-import (
-	"fmt"
-	"image/color"
-
-	rl "github.com/gen2brain/raylib-go/raylib"
-	"github.com/ministergoose/chip8-emu-go/chip8/hardware"
-)
-
-type DisplayRaylib struct {
-	buffer [hardware.DISPLAY_HEIGHT][hardware.DISPLAY_WIDTH]byte
-	camera rl.Camera2D
-	title  string
-
-	bgrColor color.RGBA
-	frgColor color.RGBA
-}
-
-func NewDisplayRaylib() *DisplayRaylib {
-	return &DisplayRaylib{}
-}
-
-func (dspl *DisplayRaylib) Init(title string, scale float32) {
-	dspl.title = title
-	rl.SetTraceLog(rl.LogError)
-	rl.InitWindow(int32(hardware.DISPLAY_WIDTH*scale), int32(hardware.DISPLAY_HEIGHT*scale), title)
-	rl.SetTargetFPS(60)
-	dspl.camera = rl.NewCamera2D(rl.NewVector2(0.0, 0.0), rl.NewVector2(0.0, 0.0), 0.0, scale)
-
-	dspl.bgrColor = rl.Black
-	dspl.frgColor = rl.Green
-}
-
-func (dspl *DisplayRaylib) PutPixel(x, y byte) bool {
-	if x < hardware.DISPLAY_WIDTH && y < hardware.DISPLAY_HEIGHT {
-		dspl.buffer[y][x] ^= 1
-		return dspl.buffer[y][x] == 0
-	}
-
-	return false
-}
-
-func (dspl *DisplayRaylib) Draw() {
-	rl.BeginDrawing()
-	rl.ClearBackground(dspl.bgrColor)
-	rl.BeginMode2D(dspl.camera)
-
-	for y := 0; y < hardware.DISPLAY_HEIGHT; y++ {
-		for x := 0; x < hardware.DISPLAY_WIDTH; x++ {
-			if dspl.buffer[y][x] > 0 {
-				rl.DrawPixel(int32(x), int32(y), dspl.frgColor)
-			}
-		}
-	}
-
-	rl.EndMode2D()
-	rl.EndDrawing()
-	rl.SetWindowTitle(fmt.Sprintf("%s [FPS: %.2f]", dspl.title, rl.GetFPS()))
-}
-
-func (dspl *DisplayRaylib) Cls() {
-	for y := 0; y < hardware.DISPLAY_HEIGHT; y++ {
-		for x := 0; x < hardware.DISPLAY_WIDTH; x++ {
-			dspl.buffer[y][x] = 0
-		}
-	}
-}
-
-func (dspl *DisplayRaylib) Dump() {
-	fmt.Print("  |")
-	for x := 0; x < hardware.DISPLAY_WIDTH; x++ {
-		fmt.Printf("%02d|", x)
-	}
-
-	for y := 0; y < hardware.DISPLAY_HEIGHT; y++ {
-		fmt.Printf("\n%02d|", y)
-		for x := 0; x < hardware.DISPLAY_WIDTH; x++ {
-			fmt.Printf("%2d|", dspl.buffer[y][x])
-		}
-	}
-	fmt.Println()
-}
-
-func (dspl *DisplayRaylib) ShouldClose() bool {
-	return rl.WindowShouldClose()
-}
-
-func (dspl *DisplayRaylib) Close() {
-	rl.CloseWindow()
-}
+package raylib
+
+import (
+	"fmt"
+	"image/color"
+
+	rl "github.com/gen2brain/raylib-go/raylib"
+	"github.com/ministergoose/chip8-emu-go/chip8/hardware"
+)
+
+// DEFAULT_PALETTE are the colors of the background, plane 1, plane 2 and both planes.
+var DEFAULT_PALETTE [4]color.RGBA = [4]color.RGBA{rl.Black, rl.Green, rl.Orange, rl.DarkGreen}
+
+type DisplayRaylib struct {
+	hardware.Framebuffer
+	camera rl.Camera2D
+	title  string
+	scale  float32
+
+	palette [4]color.RGBA // background, plane 1, plane 2, both planes
+	overlay []string      // lines of text over the screen
+}
+
+func NewDisplayRaylib() *DisplayRaylib {
+	return &DisplayRaylib{Framebuffer: *hardware.NewFramebuffer()}
+}
+
+func (dspl *DisplayRaylib) Init(title string, scale float32) {
+	dspl.title = title
+	dspl.scale = scale
+	rl.SetTraceLog(rl.LogError)
+	rl.InitWindow(int32(hardware.DISPLAY_WIDTH*scale), int32(hardware.DISPLAY_HEIGHT*scale), title)
+	rl.SetTargetFPS(60)
+	dspl.camera = rl.NewCamera2D(rl.NewVector2(0.0, 0.0), rl.NewVector2(0.0, 0.0), 0.0, scale)
+
+	dspl.palette = DEFAULT_PALETTE
+}
+
+func (dspl *DisplayRaylib) SetPalette(palette [4]color.RGBA) {
+	dspl.palette = palette
+}
+
+func (dspl *DisplayRaylib) Draw() {
+	// the window keeps its size, hi-res pixels are drawn at half the scale
+	dspl.camera.Zoom = dspl.scale * hardware.DISPLAY_WIDTH / float32(dspl.Width())
+
+	rl.BeginDrawing()
+	rl.ClearBackground(dspl.palette[0])
+	rl.BeginMode2D(dspl.camera)
+
+	for y := 0; y < int(dspl.Height()); y++ {
+		for x := 0; x < int(dspl.Width()); x++ {
+			if dspl.Pixels[y][x] > 0 {
+				rl.DrawPixel(int32(x), int32(y), dspl.palette[dspl.Pixels[y][x]&3])
+			}
+		}
+	}
+
+	rl.EndMode2D()
+	dspl.drawOverlay()
+	rl.EndDrawing()
+	rl.SetWindowTitle(fmt.Sprintf("%s [FPS: %.2f]", dspl.title, rl.GetFPS()))
+}
+
+// SetOverlay shows lines of text over the screen, nil hides them.
+func (dspl *DisplayRaylib) SetOverlay(lines []string) {
+	dspl.overlay = lines
+}
+
+func (dspl *DisplayRaylib) drawOverlay() {
+	if len(dspl.overlay) == 0 {
+		return
+	}
+	size := int32(2 * dspl.scale)
+	width := int32(hardware.DISPLAY_WIDTH * dspl.scale)
+	height := int32(hardware.DISPLAY_HEIGHT * dspl.scale)
+	rl.DrawRectangle(0, 0, width, height, rl.Fade(rl.Black, 0.8))
+
+	y := (height - int32(len(dspl.overlay))*size*3/2) / 2
+	for _, line := range dspl.overlay {
+		rl.DrawText(line, (width-rl.MeasureText(line, size))/2, y, size, rl.RayWhite)
+		y += size * 3 / 2
+	}
+}
+
+func (dspl *DisplayRaylib) ShouldClose() bool {
+	return rl.WindowShouldClose()
+}
+
+func (dspl *DisplayRaylib) Close() {
+	rl.CloseWindow()
+}
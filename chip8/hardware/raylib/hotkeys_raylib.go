@@ -0,0 +1,47 @@
+package raylib
+
+import (
+	rl "github.com/gen2brain/raylib-go/raylib"
+)
+
+const (
+	REWIND_KEY        = rl.KeyBackspace
+	FAST_FORWARD_KEY  = rl.KeyTab
+	PAUSE_KEY         = rl.KeyP
+	FRAME_ADVANCE_KEY = rl.KeyN
+)
+
+var SLOT_KEYS []int32 = []int32{
+	rl.KeyF1, rl.KeyF2, rl.KeyF3, rl.KeyF4, rl.KeyF5, rl.KeyF6, rl.KeyF7, rl.KeyF8, rl.KeyF9,
+}
+
+// StateSlotPressed reports a save state hotkey: Shift+F1..F9 saves to the slot, F1..F9 loads it.
+func StateSlotPressed() (slot int, save bool, ok bool) {
+	for i, k := range SLOT_KEYS {
+		if rl.IsKeyPressed(k) {
+			save = rl.IsKeyDown(rl.KeyLeftShift) || rl.IsKeyDown(rl.KeyRightShift)
+			return i + 1, save, true
+		}
+	}
+	return 0, false, false
+}
+
+// RewindKeyDown reports whether the rewind key is held.
+func RewindKeyDown() bool {
+	return rl.IsKeyDown(REWIND_KEY)
+}
+
+// FastForwardKeyDown reports whether the fast forward key is held.
+func FastForwardKeyDown() bool {
+	return rl.IsKeyDown(FAST_FORWARD_KEY)
+}
+
+// PausePressed reports a press of the pause key.
+func PausePressed() bool {
+	return rl.IsKeyPressed(PAUSE_KEY)
+}
+
+// FrameAdvancePressed reports a press of the frame advance key.
+func FrameAdvancePressed() bool {
+	return rl.IsKeyPressed(FRAME_ADVANCE_KEY)
+}
@@ -1,58 +1,114 @@
-package raylib
-
-import (
-	rl "github.com/gen2brain/raylib-go/raylib"
-)
-
-/*
-| 1 | 2 | 3 | C |
-| 4 | 5 | 6 | D |
-| 7 | 8 | 9 | E |
-| A | 0 | B | F |
-*/
-
-var KEYS []int32 = []int32{
-	rl.KeyKp0,        // 0 - "num 0"
-	rl.KeyKp7,        // 1 - "num 7"
-	rl.KeyKp8,        // 2 - "num 8"
-	rl.KeyKp9,        // 3 - "num 9"
-	rl.KeyKp4,        // 4 - "num 4"
-	rl.KeyKp5,        // 5 - "num 5"
-	rl.KeyKp6,        // 6 - "num 6"
-	rl.KeyKp1,        // 7 - "num 1"
-	rl.KeyKp2,        // 8 - "num 2"
-	rl.KeyKp3,        // 9 - "num 3"
-	rl.KeyKpDecimal,  // A - "num ."
-	rl.KeyKpEnter,    // B - "num Enter"
-	rl.KeyKpDivide,   // C - "num /"
-	rl.KeyKpMultiply, // D - "num *"
-	rl.KeyKpSubtract, // E - "num -"
-	rl.KeyKpAdd,      // F - "num +"
-}
-
-type KeyboardRaylib struct {
-	status uint16
-}
-
-func NewKeyboardRaylib() *KeyboardRaylib {
-	return &KeyboardRaylib{status: 0}
-}
-
-func (kbrd *KeyboardRaylib) ReadKeys() uint16 {
-	kbrd.status = 0
-	for i, k := range KEYS {
-		if rl.IsKeyDown(k) {
-			kbrd.status |= (1 << i)
-		}
-	}
-	return kbrd.status
-}
-
-func (kbrd *KeyboardRaylib) WaitKey() byte {
-	for i, k := range KEYS {
-		if rl.IsKeyReleased(k) {
-			return byte(i)
-		}
-	}
-	return 0x80
-}
+package raylib
+
+import (
+	rl "github.com/gen2brain/raylib-go/raylib"
+)
+
+/*
+| 1 | 2 | 3 | C |
+| 4 | 5 | 6 | D |
+| 7 | 8 | 9 | E |
+| A | 0 | B | F |
+*/
+
+var KEYS []int32 = []int32{
+	rl.KeyKp0,        // 0 - "num 0"
+	rl.KeyKp7,        // 1 - "num 7"
+	rl.KeyKp8,        // 2 - "num 8"
+	rl.KeyKp9,        // 3 - "num 9"
+	rl.KeyKp4,        // 4 - "num 4"
+	rl.KeyKp5,        // 5 - "num 5"
+	rl.KeyKp6,        // 6 - "num 6"
+	rl.KeyKp1,        // 7 - "num 1"
+	rl.KeyKp2,        // 8 - "num 2"
+	rl.KeyKp3,        // 9 - "num 3"
+	rl.KeyKpDecimal,  // A - "num ."
+	rl.KeyKpEnter,    // B - "num Enter"
+	rl.KeyKpDivide,   // C - "num /"
+	rl.KeyKpMultiply, // D - "num *"
+	rl.KeyKpSubtract, // E - "num -"
+	rl.KeyKpAdd,      // F - "num +"
+}
+
+// GAME_KEYS are the host keys of the game keys of the ROM database.
+var GAME_KEYS map[string]int32 = map[string]int32{
+	"up":           rl.KeyUp,
+	"down":         rl.KeyDown,
+	"left":         rl.KeyLeft,
+	"right":        rl.KeyRight,
+	"a":            rl.KeyZ,
+	"b":            rl.KeyX,
+	"player2Up":    rl.KeyW,
+	"player2Down":  rl.KeyS,
+	"player2Left":  rl.KeyA,
+	"player2Right": rl.KeyD,
+	"player2A":     rl.KeyQ,
+	"player2B":     rl.KeyE,
+}
+
+type KeyboardRaylib struct {
+	keys   [16][]int32 // host keys of every CHIP-8 key
+	status uint16
+	game   map[int32]byte // host key => CHIP-8 key, besides the keymap
+	rom    map[string]byte
+}
+
+func NewKeyboardRaylib() *KeyboardRaylib {
+	return &KeyboardRaylib{status: 0, keys: LAYOUTS[DEFAULT_LAYOUT]}
+}
+
+func (kbrd *KeyboardRaylib) ReadKeys() uint16 {
+	kbrd.status = 0
+	for i, keys := range kbrd.keys {
+		for _, k := range keys {
+			if rl.IsKeyDown(k) {
+				kbrd.status |= (1 << i)
+			}
+		}
+	}
+	for k, key := range kbrd.game {
+		if rl.IsKeyDown(k) {
+			kbrd.status |= 1 << key
+		}
+	}
+	return kbrd.status
+}
+
+func (kbrd *KeyboardRaylib) WaitKey() byte {
+	for i, keys := range kbrd.keys {
+		for _, k := range keys {
+			if rl.IsKeyReleased(k) {
+				return byte(i)
+			}
+		}
+	}
+	for k, key := range kbrd.game {
+		if rl.IsKeyReleased(k) {
+			return key
+		}
+	}
+	return 0x80
+}
+
+// SetGameKeys maps the arrows and other GAME_KEYS to the CHIP-8 keys a ROM
+// uses, the host keys of the keymap keep their CHIP-8 key.
+func (kbrd *KeyboardRaylib) SetGameKeys(keys map[string]byte) {
+	kbrd.rom = keys
+	kbrd.game = make(map[int32]byte)
+	for name, key := range keys {
+		if k, ok := GAME_KEYS[name]; ok && key < 16 && !kbrd.mapped(k) {
+			kbrd.game[k] = key
+		}
+	}
+}
+
+func (kbrd *KeyboardRaylib) mapped(k int32) bool {
+	for _, keys := range kbrd.keys {
+		for _, key := range keys {
+			if key == k {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,133 @@
+package raylib
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	rl "github.com/gen2brain/raylib-go/raylib"
+)
+
+/*
+   Keymaps: CHIP-8 key => host key names, over a layout, e.g.
+   {"1": "1", "2": "2", "3": "3", "C": "4", "4": ["Q", "UP"], ...}
+   The keys that are left out keep the layout's.
+*/
+
+const DEFAULT_LAYOUT = "numpad"
+
+// LAYOUTS are the host keys of every CHIP-8 key by layout name.
+var LAYOUTS map[string][16][]int32 = map[string][16][]int32{
+	"numpad": layout(KEYS...),
+	// 1 2 3 4 / Q W E R / A S D F / Z X C V
+	"qwerty": layout(
+		rl.KeyX, rl.KeyOne, rl.KeyTwo, rl.KeyThree, rl.KeyQ, rl.KeyW, rl.KeyE, rl.KeyA,
+		rl.KeyS, rl.KeyD, rl.KeyZ, rl.KeyC, rl.KeyFour, rl.KeyR, rl.KeyF, rl.KeyV,
+	),
+	// 1 2 3 4 / A Z E R / Q S D F / W X C V
+	"azerty": layout(
+		rl.KeyX, rl.KeyOne, rl.KeyTwo, rl.KeyThree, rl.KeyA, rl.KeyZ, rl.KeyE, rl.KeyQ,
+		rl.KeyS, rl.KeyD, rl.KeyW, rl.KeyC, rl.KeyFour, rl.KeyR, rl.KeyF, rl.KeyV,
+	),
+}
+
+func layout(keys ...int32) [16][]int32 {
+	var l [16][]int32
+	for i, k := range keys {
+		l[i] = []int32{k}
+	}
+	return l
+}
+
+// KEY_NAMES are the host keys of the keymap files.
+var KEY_NAMES map[string]int32 = map[string]int32{
+	"0": rl.KeyZero, "1": rl.KeyOne, "2": rl.KeyTwo, "3": rl.KeyThree, "4": rl.KeyFour,
+	"5": rl.KeyFive, "6": rl.KeySix, "7": rl.KeySeven, "8": rl.KeyEight, "9": rl.KeyNine,
+
+	"A": rl.KeyA, "B": rl.KeyB, "C": rl.KeyC, "D": rl.KeyD, "E": rl.KeyE, "F": rl.KeyF, "G": rl.KeyG,
+	"H": rl.KeyH, "I": rl.KeyI, "J": rl.KeyJ, "K": rl.KeyK, "L": rl.KeyL, "M": rl.KeyM, "N": rl.KeyN,
+	"O": rl.KeyO, "P": rl.KeyP, "Q": rl.KeyQ, "R": rl.KeyR, "S": rl.KeyS, "T": rl.KeyT, "U": rl.KeyU,
+	"V": rl.KeyV, "W": rl.KeyW, "X": rl.KeyX, "Y": rl.KeyY, "Z": rl.KeyZ,
+
+	"KP0": rl.KeyKp0, "KP1": rl.KeyKp1, "KP2": rl.KeyKp2, "KP3": rl.KeyKp3, "KP4": rl.KeyKp4,
+	"KP5": rl.KeyKp5, "KP6": rl.KeyKp6, "KP7": rl.KeyKp7, "KP8": rl.KeyKp8, "KP9": rl.KeyKp9,
+	"KP_DECIMAL": rl.KeyKpDecimal, "KP_DIVIDE": rl.KeyKpDivide, "KP_MULTIPLY": rl.KeyKpMultiply,
+	"KP_SUBTRACT": rl.KeyKpSubtract, "KP_ADD": rl.KeyKpAdd, "KP_ENTER": rl.KeyKpEnter,
+
+	"UP": rl.KeyUp, "DOWN": rl.KeyDown, "LEFT": rl.KeyLeft, "RIGHT": rl.KeyRight,
+	"SPACE": rl.KeySpace, "ENTER": rl.KeyEnter,
+	"COMMA": rl.KeyComma, "PERIOD": rl.KeyPeriod, "SLASH": rl.KeySlash, "SEMICOLON": rl.KeySemicolon,
+	"APOSTROPHE": rl.KeyApostrophe, "MINUS": rl.KeyMinus, "EQUAL": rl.KeyEqual,
+	"LEFT_BRACKET": rl.KeyLeftBracket, "RIGHT_BRACKET": rl.KeyRightBracket,
+	"BACKSLASH": rl.KeyBackSlash, "GRAVE": rl.KeyGrave,
+}
+
+// Keymap returns the host keys of every CHIP-8 key, those of the layout
+// changed by keymap.
+func Keymap(layout string, keymap map[string][]string) ([16][]int32, error) {
+	if layout == "" {
+		layout = DEFAULT_LAYOUT
+	}
+	keys, ok := LAYOUTS[layout]
+	if !ok {
+		return keys, fmt.Errorf("unknown keyboard layout: %s", layout)
+	}
+
+	for key, names := range keymap {
+		i, err := strconv.ParseUint(key, 16, 4)
+		if err != nil {
+			return keys, fmt.Errorf("bad CHIP-8 key %q", key)
+		}
+		keys[i] = nil
+		for _, name := range names {
+			k, ok := KEY_NAMES[strings.ToUpper(name)]
+			if !ok {
+				return keys, fmt.Errorf("unknown key %q", name)
+			}
+			keys[i] = append(keys[i], k)
+		}
+	}
+	return keys, nil
+}
+
+// KeymapNames returns the host key names of every CHIP-8 key, by hex digit.
+func KeymapNames(keys [16][]int32) map[string][]string {
+	names := make(map[string][]string)
+	for i, ks := range keys {
+		key := fmt.Sprintf("%X", i)
+		names[key] = []string{}
+		for _, k := range ks {
+			names[key] = append(names[key], KeyName(k))
+		}
+	}
+	return names
+}
+
+// KeyName returns the name of a host key in the keymaps.
+func KeyName(key int32) string {
+	if name, ok := keyName(key); ok {
+		return name
+	}
+	return strconv.Itoa(int(key))
+}
+
+func keyName(key int32) (string, bool) {
+	for name, k := range KEY_NAMES {
+		if k == key {
+			return name, true
+		}
+	}
+	return "", false
+}
+
+// SetKeymap sets the host keys of every CHIP-8 key.
+func (kbrd *KeyboardRaylib) SetKeymap(keys [16][]int32) {
+	kbrd.keys = keys
+	if kbrd.rom != nil {
+		kbrd.SetGameKeys(kbrd.rom)
+	}
+}
+
+func (kbrd *KeyboardRaylib) Keymap() [16][]int32 {
+	return kbrd.keys
+}
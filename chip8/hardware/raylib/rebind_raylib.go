@@ -0,0 +1,115 @@
+package raylib
+
+import (
+	"fmt"
+	"strings"
+
+	rl "github.com/gen2brain/raylib-go/raylib"
+)
+
+// REBIND_KEY opens the rebinding screen.
+const REBIND_KEY = rl.KeyF10
+
+// KEYPAD_ORDER is the order the rebinding screen asks for the CHIP-8 keys in, row by row.
+var KEYPAD_ORDER []byte = []byte{
+	0x1, 0x2, 0x3, 0xC,
+	0x4, 0x5, 0x6, 0xD,
+	0x7, 0x8, 0x9, 0xE,
+	0xA, 0x0, 0xB, 0xF,
+}
+
+// Rebind is the screen that binds every CHIP-8 key to the next host key pressed.
+type Rebind struct {
+	kbrd *KeyboardRaylib
+	dspl *DisplayRaylib
+	step int         // of KEYPAD_ORDER, -1 while closed
+	keys [16][]int32 // the new keymap
+
+	OnDone func(keys [16][]int32) // called with the new keymap, e.g. to save it
+}
+
+func NewRebind(kbrd *KeyboardRaylib, dspl *DisplayRaylib) *Rebind {
+	return &Rebind{kbrd: kbrd, dspl: dspl, step: -1}
+}
+
+// Update opens the screen on REBIND_KEY and binds the pressed keys, once a
+// frame. It reports whether the screen is open, the emulation waits meanwhile.
+func (r *Rebind) Update() bool {
+	if r.step < 0 {
+		if !rl.IsKeyPressed(REBIND_KEY) {
+			return false
+		}
+		r.step = 0
+		r.keys = r.kbrd.Keymap()
+		// Escape cancels instead of closing the window
+		rl.SetExitKey(0)
+		r.show()
+		return true
+	}
+
+	for k := rl.GetKeyPressed(); k != 0; k = rl.GetKeyPressed() {
+		switch k {
+		case rl.KeyEscape:
+			r.close()
+			return true
+		case rl.KeyBackspace:
+			// keeps the keys
+		default:
+			if _, ok := keyName(k); !ok {
+				// only the keys of KEY_NAMES can be saved
+				continue
+			}
+			r.bind(KEYPAD_ORDER[r.step], k)
+		}
+
+		r.step++
+		if r.step == len(KEYPAD_ORDER) {
+			r.kbrd.SetKeymap(r.keys)
+			r.close()
+			if r.OnDone != nil {
+				r.OnDone(r.keys)
+			}
+			return true
+		}
+	}
+	r.show()
+	return true
+}
+
+// bind makes k the only host key of a CHIP-8 key.
+func (r *Rebind) bind(key byte, k int32) {
+	for i, keys := range r.keys {
+		var kept []int32
+		for _, old := range keys {
+			if old != k {
+				kept = append(kept, old)
+			}
+		}
+		r.keys[i] = kept
+	}
+	r.keys[key] = []int32{k}
+}
+
+func (r *Rebind) show() {
+	key := KEYPAD_ORDER[r.step]
+	var names []string
+	for _, k := range r.keys[key] {
+		names = append(names, KeyName(k))
+	}
+	if len(names) == 0 {
+		names = append(names, "none")
+	}
+	r.dspl.SetOverlay([]string{
+		fmt.Sprintf("Press a key for %X", key),
+		fmt.Sprintf("now %s", strings.Join(names, ", ")),
+		"",
+		"Backspace keeps it, Esc cancels",
+		fmt.Sprintf("%d/%d", r.step+1, len(KEYPAD_ORDER)),
+	})
+}
+
+func (r *Rebind) close() {
+	r.step = -1
+	r.dspl.SetOverlay(nil)
+	rl.SetExitKey(rl.KeyEscape)
+}
@@ -1,23 +1,80 @@
-package hardware
-
-import "github.com/gen2brain/beeep"
-
-type Sound interface {
-	Beep()
-}
-
-type SoundStd struct {
-}
-
-func NewSoundStd() *SoundStd {
-	return &SoundStd{}
-}
-
-func (s *SoundStd) Beep() {
-	go func() {
-		err := beeep.Beep(beeep.DefaultFreq, 16)
-		if err != nil {
-			panic(err)
-		}
-	}()
-}
+package hardware
+
+import (
+	"math"
+
+	"github.com/gen2brain/beeep"
+)
+
+const (
+	PATTERN_SIZE  = 16 // XO-CHIP audio pattern buffer, 128 1-bit samples
+	DEFAULT_PITCH = 64 // 4000 Hz playback rate
+)
+
+type Sound interface {
+	Beep()
+	SetPattern(pattern [PATTERN_SIZE]byte)
+	SetPitch(pitch byte)
+}
+
+type SoundStd struct {
+	pattern    [PATTERN_SIZE]byte
+	hasPattern bool
+	pitch      byte
+	freq       float64 // of the beep without a pattern
+}
+
+func NewSoundStd() *SoundStd {
+	return &SoundStd{pitch: DEFAULT_PITCH, freq: beeep.DefaultFreq}
+}
+
+// SetFreq sets the frequency of the beep of the programs without an audio pattern.
+func (s *SoundStd) SetFreq(freq float64) {
+	s.freq = freq
+}
+
+func (s *SoundStd) SetPattern(pattern [PATTERN_SIZE]byte) {
+	s.pattern = pattern
+	s.hasPattern = true
+}
+
+func (s *SoundStd) SetPitch(pitch byte) {
+	s.pitch = pitch
+}
+
+// Freq approximates the XO-CHIP pattern buffer with a square wave:
+// the number of pulses in the 128-bit pattern times the playback rate.
+func (s *SoundStd) Freq() float64 {
+	if !s.hasPattern {
+		return s.freq
+	}
+
+	bit := func(i int) byte {
+		i %= PATTERN_SIZE * 8
+		return (s.pattern[i/8] >> (7 - i%8)) & 1
+	}
+
+	pulses := 0
+	for i := 0; i < PATTERN_SIZE*8; i++ {
+		if bit(i) == 0 && bit(i+1) == 1 {
+			pulses++
+		}
+	}
+
+	rate := 4000 * math.Pow(2, (float64(s.pitch)-64)/48)
+	return rate * float64(pulses) / (PATTERN_SIZE * 8)
+}
+
+func (s *SoundStd) Beep() {
+	freq := s.Freq()
+	if freq == 0 {
+		return
+	}
+
+	go func() {
+		err := beeep.Beep(freq, 16)
+		if err != nil {
+			panic(err)
+		}
+	}()
+}
@@ -2,56 +2,74 @@ package chip8
 
 import (
 	"fmt"
-	"math/rand"
 
 	"github.com/ministergoose/chip8-emu-go/chip8/hardware"
 )
 
-func getParameters(i uint16) (nnn uint16, kk byte, n byte, x byte, y byte) {
-	nnn = i & 0x0fff
-	kk = (byte)(i & 0x00ff)
-	n = (byte)(i & 0x000f)
-	x = (byte)((i & 0x0f00) >> 8)
-	y = (byte)((i & 0x00f0) >> 4)
-	return nnn, kk, n, x, y
-}
-
-func (cpu *Cpu) InstructionsInit() {
-	cpu.Opcodes = append(cpu.Opcodes, Opcode{Result: 0x00e0, Mask: 0xffff, f: cpu.ins00e0})
-	cpu.Opcodes = append(cpu.Opcodes, Opcode{Result: 0x00ee, Mask: 0xffff, f: cpu.ins00ee})
-	cpu.Opcodes = append(cpu.Opcodes, Opcode{Result: 0x0000, Mask: 0xf000, f: cpu.ins0nnn})
-	cpu.Opcodes = append(cpu.Opcodes, Opcode{Result: 0x1000, Mask: 0xf000, f: cpu.ins1nnn})
-	cpu.Opcodes = append(cpu.Opcodes, Opcode{Result: 0x2000, Mask: 0xf000, f: cpu.ins2nnn})
-	cpu.Opcodes = append(cpu.Opcodes, Opcode{Result: 0x3000, Mask: 0xf000, f: cpu.ins3xkk})
-	cpu.Opcodes = append(cpu.Opcodes, Opcode{Result: 0x4000, Mask: 0xf000, f: cpu.ins4xkk})
-	cpu.Opcodes = append(cpu.Opcodes, Opcode{Result: 0x5000, Mask: 0xf00f, f: cpu.ins5xy0})
-	cpu.Opcodes = append(cpu.Opcodes, Opcode{Result: 0x6000, Mask: 0xf000, f: cpu.ins6xkk})
-	cpu.Opcodes = append(cpu.Opcodes, Opcode{Result: 0x7000, Mask: 0xf000, f: cpu.ins7xkk})
-	cpu.Opcodes = append(cpu.Opcodes, Opcode{Result: 0x8000, Mask: 0xf00f, f: cpu.ins8xy0})
-	cpu.Opcodes = append(cpu.Opcodes, Opcode{Result: 0x8001, Mask: 0xf00f, f: cpu.ins8xy1})
-	cpu.Opcodes = append(cpu.Opcodes, Opcode{Result: 0x8002, Mask: 0xf00f, f: cpu.ins8xy2})
-	cpu.Opcodes = append(cpu.Opcodes, Opcode{Result: 0x8003, Mask: 0xf00f, f: cpu.ins8xy3})
-	cpu.Opcodes = append(cpu.Opcodes, Opcode{Result: 0x8004, Mask: 0xf00f, f: cpu.ins8xy4})
-	cpu.Opcodes = append(cpu.Opcodes, Opcode{Result: 0x8005, Mask: 0xf00f, f: cpu.ins8xy5})
-	cpu.Opcodes = append(cpu.Opcodes, Opcode{Result: 0x8006, Mask: 0xf00f, f: cpu.ins8xy6})
-	cpu.Opcodes = append(cpu.Opcodes, Opcode{Result: 0x8007, Mask: 0xf00f, f: cpu.ins8xy7})
-	cpu.Opcodes = append(cpu.Opcodes, Opcode{Result: 0x800e, Mask: 0xf00f, f: cpu.ins8xyE})
-	cpu.Opcodes = append(cpu.Opcodes, Opcode{Result: 0x9000, Mask: 0xf00f, f: cpu.ins9xy0})
-	cpu.Opcodes = append(cpu.Opcodes, Opcode{Result: 0xa000, Mask: 0xf000, f: cpu.insAnnn})
-	cpu.Opcodes = append(cpu.Opcodes, Opcode{Result: 0xb000, Mask: 0xf000, f: cpu.insBnnn})
-	cpu.Opcodes = append(cpu.Opcodes, Opcode{Result: 0xc000, Mask: 0xf000, f: cpu.insCxkk})
-	cpu.Opcodes = append(cpu.Opcodes, Opcode{Result: 0xd000, Mask: 0xf000, f: cpu.insDxyn})
-	cpu.Opcodes = append(cpu.Opcodes, Opcode{Result: 0xe09e, Mask: 0xf0ff, f: cpu.insEx9E})
-	cpu.Opcodes = append(cpu.Opcodes, Opcode{Result: 0xe0a1, Mask: 0xf0ff, f: cpu.insExA1})
-	cpu.Opcodes = append(cpu.Opcodes, Opcode{Result: 0xf007, Mask: 0xf0ff, f: cpu.insFx07})
-	cpu.Opcodes = append(cpu.Opcodes, Opcode{Result: 0xf00a, Mask: 0xf0ff, f: cpu.insFx0A})
-	cpu.Opcodes = append(cpu.Opcodes, Opcode{Result: 0xf015, Mask: 0xf0ff, f: cpu.insFx15})
-	cpu.Opcodes = append(cpu.Opcodes, Opcode{Result: 0xf018, Mask: 0xf0ff, f: cpu.insFx18})
-	cpu.Opcodes = append(cpu.Opcodes, Opcode{Result: 0xf01e, Mask: 0xf0ff, f: cpu.insFx1E})
-	cpu.Opcodes = append(cpu.Opcodes, Opcode{Result: 0xf029, Mask: 0xf0ff, f: cpu.insFx29})
-	cpu.Opcodes = append(cpu.Opcodes, Opcode{Result: 0xf033, Mask: 0xf0ff, f: cpu.insFx33})
-	cpu.Opcodes = append(cpu.Opcodes, Opcode{Result: 0xf055, Mask: 0xf0ff, f: cpu.insFx55})
-	cpu.Opcodes = append(cpu.Opcodes, Opcode{Result: 0xf065, Mask: 0xf0ff, f: cpu.insFx65})
+// EXEC has the handler of every operation, the instructions that are not
+// valid for the platform are decoded as OP_UNKNOWN.
+var EXEC [OP_COUNT]func(cpu *Cpu, in Instruction) error = [OP_COUNT]func(cpu *Cpu, in Instruction) error{
+	OP_UNKNOWN:    (*Cpu).insUnknown,
+	OP_CLS:        (*Cpu).ins00e0,
+	OP_RET:        (*Cpu).ins00ee,
+	OP_SCD:        (*Cpu).ins00Cn,
+	OP_SCU:        (*Cpu).ins00Dn,
+	OP_SCR:        (*Cpu).ins00FB,
+	OP_SCL:        (*Cpu).ins00FC,
+	OP_EXIT:       (*Cpu).ins00FD,
+	OP_LOW:        (*Cpu).ins00FE,
+	OP_HIGH:       (*Cpu).ins00FF,
+	OP_SYS:        (*Cpu).ins0nnn,
+	OP_JP:         (*Cpu).ins1nnn,
+	OP_CALL:       (*Cpu).ins2nnn,
+	OP_SE_BYTE:    (*Cpu).ins3xkk,
+	OP_SNE_BYTE:   (*Cpu).ins4xkk,
+	OP_SE_REG:     (*Cpu).ins5xy0,
+	OP_SAVE_RANGE: (*Cpu).ins5xy2,
+	OP_LOAD_RANGE: (*Cpu).ins5xy3,
+	OP_LD_BYTE:    (*Cpu).ins6xkk,
+	OP_ADD_BYTE:   (*Cpu).ins7xkk,
+	OP_LD_REG:     (*Cpu).ins8xy0,
+	OP_OR:         (*Cpu).ins8xy1,
+	OP_AND:        (*Cpu).ins8xy2,
+	OP_XOR:        (*Cpu).ins8xy3,
+	OP_ADD_REG:    (*Cpu).ins8xy4,
+	OP_SUB:        (*Cpu).ins8xy5,
+	OP_SHR:        (*Cpu).ins8xy6,
+	OP_SUBN:       (*Cpu).ins8xy7,
+	OP_SHL:        (*Cpu).ins8xyE,
+	OP_SNE_REG:    (*Cpu).ins9xy0,
+	OP_LD_I:       (*Cpu).insAnnn,
+	OP_JP_V0:      (*Cpu).insBnnn,
+	OP_RND:        (*Cpu).insCxkk,
+	OP_DRW:        (*Cpu).insDxyn,
+	OP_SKP:        (*Cpu).insEx9E,
+	OP_SKNP:       (*Cpu).insExA1,
+	OP_LD_I_LONG:  (*Cpu).insF000,
+	OP_PLANE:      (*Cpu).insFn01,
+	OP_AUDIO:      (*Cpu).insF002,
+	OP_LD_VX_DT:   (*Cpu).insFx07,
+	OP_LD_VX_K:    (*Cpu).insFx0A,
+	OP_LD_DT_VX:   (*Cpu).insFx15,
+	OP_LD_ST_VX:   (*Cpu).insFx18,
+	OP_ADD_I_VX:   (*Cpu).insFx1E,
+	OP_LD_F_VX:    (*Cpu).insFx29,
+	OP_LD_HF_VX:   (*Cpu).insFx30,
+	OP_LD_B_VX:    (*Cpu).insFx33,
+	OP_PITCH:      (*Cpu).insFx3A,
+	OP_SAVE:       (*Cpu).insFx55,
+	OP_LOAD:       (*Cpu).insFx65,
+	OP_SAVE_FLAGS: (*Cpu).insFx75,
+	OP_LOAD_FLAGS: (*Cpu).insFx85,
+}
+
+// Exec executes a decoded instruction, the PC already points to the next one.
+func (cpu *Cpu) Exec(in Instruction) error {
+	return EXEC[in.Op](cpu, in)
+}
+
+func (cpu *Cpu) insUnknown(in Instruction) error {
+	return fmt.Errorf("unknown opcode: 0x%04X", in.Opcode)
 }
 
 /*
@@ -59,10 +77,10 @@ func (cpu *Cpu) InstructionsInit() {
    Clear the display.
 */
 
-func (cpu *Cpu) ins00e0(op uint16) (string, error) {
+func (cpu *Cpu) ins00e0(in Instruction) error {
 	cpu.display.Cls()
 
-	return "CLS\t\t; Clear the display", nil
+	return nil
 }
 
 /*
@@ -71,14 +89,95 @@ func (cpu *Cpu) ins00e0(op uint16) (string, error) {
    The interpreter sets the program counter to the address at the top of the stack, then subtracts 1 from the stack pointer.
 */
 
-func (cpu *Cpu) ins00ee(op uint16) (string, error) {
+func (cpu *Cpu) ins00ee(in Instruction) error {
 	addr, err := cpu.stack.Pop()
 	if err != nil {
-		return "", err
+		return err
 	}
 	cpu.cnt = addr
 
-	return "RET\t\t; Return from a subroutine", nil
+	return nil
+}
+
+/*
+   00Cn - SCD nibble
+   Scroll the display down by n lines (SUPER-CHIP).
+*/
+
+func (cpu *Cpu) ins00Cn(in Instruction) error {
+	n := in.N
+
+	cpu.display.ScrollDown(n)
+
+	return nil
+}
+
+/*
+   00Dn - SCU nibble
+   Scroll the selected planes up by n lines (XO-CHIP).
+*/
+
+func (cpu *Cpu) ins00Dn(in Instruction) error {
+	n := in.N
+
+	cpu.display.ScrollUp(n)
+
+	return nil
+}
+
+/*
+   00FB - SCR
+   Scroll the display right by 4 pixels (SUPER-CHIP).
+*/
+
+func (cpu *Cpu) ins00FB(in Instruction) error {
+	cpu.display.ScrollRight(4)
+
+	return nil
+}
+
+/*
+   00FC - SCL
+   Scroll the display left by 4 pixels (SUPER-CHIP).
+*/
+
+func (cpu *Cpu) ins00FC(in Instruction) error {
+	cpu.display.ScrollLeft(4)
+
+	return nil
+}
+
+/*
+   00FD - EXIT
+   Exit the interpreter (SUPER-CHIP).
+*/
+
+func (cpu *Cpu) ins00FD(in Instruction) error {
+	cpu.halted = true
+
+	return nil
+}
+
+/*
+   00FE - LOW
+   Disable the 128x64 high resolution mode and clear the display (SUPER-CHIP).
+*/
+
+func (cpu *Cpu) ins00FE(in Instruction) error {
+	cpu.display.SetHiRes(false)
+
+	return nil
+}
+
+/*
+   00FF - HIGH
+   Enable the 128x64 high resolution mode and clear the display (SUPER-CHIP).
+*/
+
+func (cpu *Cpu) ins00FF(in Instruction) error {
+	cpu.display.SetHiRes(true)
+
+	return nil
 }
 
 /*
@@ -87,10 +186,9 @@ func (cpu *Cpu) ins00ee(op uint16) (string, error) {
    This instruction is only used on the old computers on which Chip-8 was originally implemented. It is ignored by modern interpreters.
 */
 
-func (cpu *Cpu) ins0nnn(op uint16) (string, error) {
-	nnn, _, _, _, _ := getParameters(op)
+func (cpu *Cpu) ins0nnn(in Instruction) error {
 	// TODO
-	return fmt.Sprintf("SYS 0x%03x", nnn), nil
+	return nil
 }
 
 /*
@@ -99,16 +197,16 @@ func (cpu *Cpu) ins0nnn(op uint16) (string, error) {
    The interpreter sets the program counter to nnn.
 */
 
-func (cpu *Cpu) ins1nnn(op uint16) (string, error) {
-	nnn, _, _, _, _ := getParameters(op)
+func (cpu *Cpu) ins1nnn(in Instruction) error {
+	nnn := in.NNN
 
 	err := cpu.checkAddr(nnn)
 	if err != nil {
-		return "", err
+		return err
 	}
 	cpu.cnt = nnn
 
-	return fmt.Sprintf("JP 0x%03x\t\t; Jump to location nnn", nnn), nil
+	return nil
 }
 
 /*
@@ -117,16 +215,16 @@ func (cpu *Cpu) ins1nnn(op uint16) (string, error) {
    The interpreter increments the stack pointer, then puts the current PC on the top of the stack. The PC is then set to nnn.
 */
 
-func (cpu *Cpu) ins2nnn(op uint16) (string, error) {
-	nnn, _, _, _, _ := getParameters(op)
+func (cpu *Cpu) ins2nnn(in Instruction) error {
+	nnn := in.NNN
 
 	err := cpu.stack.Push(cpu.cnt)
 	if err != nil {
-		return "", err
+		return err
 	}
 	cpu.cnt = nnn
 
-	return fmt.Sprintf("CALL 0x%03x\t; Call subroutine at nnn", nnn), nil
+	return nil
 }
 
 /*
@@ -135,14 +233,14 @@ func (cpu *Cpu) ins2nnn(op uint16) (string, error) {
    The interpreter compares register Vx to kk, and if they are equal, increments the program counter by 2.
 */
 
-func (cpu *Cpu) ins3xkk(op uint16) (string, error) {
-	_, kk, _, x, _ := getParameters(op)
+func (cpu *Cpu) ins3xkk(in Instruction) error {
+	kk, x := in.KK, in.X
 
 	if cpu.v[x] == kk {
-		cpu.cnt += 2
+		cpu.skip()
 	}
 
-	return fmt.Sprintf("SE V%x, %02d\t\t; Skip next instruction if Vx = kk", x, kk), nil
+	return nil
 }
 
 /*
@@ -151,14 +249,14 @@ func (cpu *Cpu) ins3xkk(op uint16) (string, error) {
    The interpreter compares register Vx to kk, and if they are not equal, increments the program counter by 2.
 */
 
-func (cpu *Cpu) ins4xkk(op uint16) (string, error) {
-	_, kk, _, x, _ := getParameters(op)
+func (cpu *Cpu) ins4xkk(in Instruction) error {
+	kk, x := in.KK, in.X
 
 	if cpu.v[x] != kk {
-		cpu.cnt += 2
+		cpu.skip()
 	}
 
-	return fmt.Sprintf("SNE V%x, %02d\t; Skip next instruction if Vx != kk", x, kk), nil
+	return nil
 }
 
 /*
@@ -167,14 +265,46 @@ func (cpu *Cpu) ins4xkk(op uint16) (string, error) {
    The interpreter compares register Vx to register Vy, and if they are equal, increments the program counter by 2.
 */
 
-func (cpu *Cpu) ins5xy0(op uint16) (string, error) {
-	_, _, _, x, y := getParameters(op)
+func (cpu *Cpu) ins5xy0(in Instruction) error {
+	x, y := in.X, in.Y
 
 	if cpu.v[x] == cpu.v[y] {
-		cpu.cnt += 2
+		cpu.skip()
 	}
 
-	return fmt.Sprintf("SE V%x, V%x\t; Skip next instruction if Vx = Vy", x, y), nil
+	return nil
+}
+
+/*
+   5xy2 - LD [I], Vx-Vy
+   Store registers Vx through Vy in memory starting at location I (XO-CHIP).
+   Registers are stored in reverse order if x > y. I is not changed.
+*/
+
+func (cpu *Cpu) ins5xy2(in Instruction) error {
+	x, y := in.X, in.Y
+
+	for i, r := range regRange(x, y) {
+		cpu.write(cpu.i+uint16(i), cpu.v[r])
+	}
+
+	return nil
+}
+
+/*
+   5xy3 - LD Vx-Vy, [I]
+   Read registers Vx through Vy from memory starting at location I (XO-CHIP).
+   Registers are loaded in reverse order if x > y. I is not changed.
+*/
+
+func (cpu *Cpu) ins5xy3(in Instruction) error {
+	x, y := in.X, in.Y
+
+	for i, r := range regRange(x, y) {
+		cpu.v[r] = cpu.read(cpu.i + uint16(i))
+	}
+
+	return nil
 }
 
 /*
@@ -183,12 +313,12 @@ func (cpu *Cpu) ins5xy0(op uint16) (string, error) {
    The interpreter puts the value kk into register Vx.
 */
 
-func (cpu *Cpu) ins6xkk(op uint16) (string, error) {
-	_, kk, _, x, _ := getParameters(op)
+func (cpu *Cpu) ins6xkk(in Instruction) error {
+	kk, x := in.KK, in.X
 
 	cpu.v[x] = kk
 
-	return fmt.Sprintf("LD V%x, %02d\t\t; Set Vx = kk", x, kk), nil
+	return nil
 }
 
 /*
@@ -197,12 +327,12 @@ func (cpu *Cpu) ins6xkk(op uint16) (string, error) {
    Adds the value kk to the value of register Vx, then stores the result in Vx.
 */
 
-func (cpu *Cpu) ins7xkk(op uint16) (string, error) {
-	_, kk, _, x, _ := getParameters(op)
+func (cpu *Cpu) ins7xkk(in Instruction) error {
+	kk, x := in.KK, in.X
 
 	cpu.v[x] += kk
 
-	return fmt.Sprintf("ADD V%x, %02d\t; Set Vx = Vx + kk", x, kk), nil
+	return nil
 }
 
 /*
@@ -211,12 +341,12 @@ func (cpu *Cpu) ins7xkk(op uint16) (string, error) {
    Stores the value of register Vy in register Vx.
 */
 
-func (cpu *Cpu) ins8xy0(op uint16) (string, error) {
-	_, _, _, x, y := getParameters(op)
+func (cpu *Cpu) ins8xy0(in Instruction) error {
+	x, y := in.X, in.Y
 
 	cpu.v[x] = cpu.v[y]
 
-	return fmt.Sprintf("LD V%x, V%x\t\t; Set Vx = Vy", x, y), nil
+	return nil
 }
 
 /*
@@ -225,17 +355,19 @@ func (cpu *Cpu) ins8xy0(op uint16) (string, error) {
    Performs a bitwise OR on the values of Vx and Vy, then stores the result in Vx. A bitwise OR compares the corrseponding bits from two values, and if either bit is 1, then the same bit in the result is also 1. Otherwise, it is 0.
 */
 
-func (cpu *Cpu) ins8xy1(op uint16) (string, error) {
-	_, _, _, x, y := getParameters(op)
+func (cpu *Cpu) ins8xy1(in Instruction) error {
+	x, y := in.X, in.Y
 
 	cpu.v[x] |= cpu.v[y]
-	if x == 0x0f {
-		cpu.v[15] >>= 7
-	} else {
-		cpu.v[15] = 0
+	if cpu.quirks.VFReset {
+		if x == 0x0f {
+			cpu.v[15] >>= 7
+		} else {
+			cpu.v[15] = 0
+		}
 	}
 
-	return fmt.Sprintf("OR V%x, V%x\t; Set Vx = Vx OR Vy", x, y), nil
+	return nil
 }
 
 /*
@@ -244,17 +376,19 @@ func (cpu *Cpu) ins8xy1(op uint16) (string, error) {
    Performs a bitwise AND on the values of Vx and Vy, then stores the result in Vx. A bitwise AND compares the corrseponding bits from two values, and if both bits are 1, then the same bit in the result is also 1. Otherwise, it is 0.
 */
 
-func (cpu *Cpu) ins8xy2(op uint16) (string, error) {
-	_, _, _, x, y := getParameters(op)
+func (cpu *Cpu) ins8xy2(in Instruction) error {
+	x, y := in.X, in.Y
 
 	cpu.v[x] &= cpu.v[y]
-	if x == 0x0f {
-		cpu.v[15] >>= 7
-	} else {
-		cpu.v[15] = 0
+	if cpu.quirks.VFReset {
+		if x == 0x0f {
+			cpu.v[15] >>= 7
+		} else {
+			cpu.v[15] = 0
+		}
 	}
 
-	return fmt.Sprintf("AND V%x, V%x\t; Set Vx = Vx AND Vy", x, y), nil
+	return nil
 }
 
 /*
@@ -263,17 +397,19 @@ func (cpu *Cpu) ins8xy2(op uint16) (string, error) {
    Performs a bitwise exclusive OR on the values of Vx and Vy, then stores the result in Vx. An exclusive OR compares the corrseponding bits from two values, and if the bits are not both the same, then the corresponding bit in the result is set to 1. Otherwise, it is 0.
 */
 
-func (cpu *Cpu) ins8xy3(op uint16) (string, error) {
-	_, _, _, x, y := getParameters(op)
+func (cpu *Cpu) ins8xy3(in Instruction) error {
+	x, y := in.X, in.Y
 
 	cpu.v[x] ^= cpu.v[y]
-	if x == 0x0f {
-		cpu.v[15] >>= 7
-	} else {
-		cpu.v[15] = 0
+	if cpu.quirks.VFReset {
+		if x == 0x0f {
+			cpu.v[15] >>= 7
+		} else {
+			cpu.v[15] = 0
+		}
 	}
 
-	return fmt.Sprintf("XOR V%x, V%x\t; Set Vx = Vx XOR Vy", x, y), nil
+	return nil
 }
 
 /*
@@ -282,8 +418,8 @@ func (cpu *Cpu) ins8xy3(op uint16) (string, error) {
    The values of Vx and Vy are added together. If the result is greater than 8 bits (i.e., > 255,) VF is set to 1, otherwise 0. Only the lowest 8 bits of the result are kept, and stored in Vx.
 */
 
-func (cpu *Cpu) ins8xy4(op uint16) (string, error) {
-	_, _, _, x, y := getParameters(op)
+func (cpu *Cpu) ins8xy4(in Instruction) error {
+	x, y := in.X, in.Y
 
 	res := uint16(cpu.v[x])
 	res += uint16(cpu.v[y])
@@ -295,7 +431,7 @@ func (cpu *Cpu) ins8xy4(op uint16) (string, error) {
 		cpu.v[15] = 1
 	}
 
-	return fmt.Sprintf("ADD V%x, V%x\t; Set Vx = Vx + Vy, set VF = carry", x, y), nil
+	return nil
 }
 
 /*
@@ -304,8 +440,8 @@ func (cpu *Cpu) ins8xy4(op uint16) (string, error) {
    If Vx > Vy, then VF is set to 1, otherwise 0. Then Vy is subtracted from Vx, and the results stored in Vx.
 */
 
-func (cpu *Cpu) ins8xy5(op uint16) (string, error) {
-	_, _, _, x, y := getParameters(op)
+func (cpu *Cpu) ins8xy5(in Instruction) error {
+	x, y := in.X, in.Y
 
 	res := int16(cpu.v[x])
 	res -= int16(cpu.v[y])
@@ -316,7 +452,7 @@ func (cpu *Cpu) ins8xy5(op uint16) (string, error) {
 		cpu.v[15] = 1
 	}
 
-	return fmt.Sprintf("SUB V%x, V%x\t; Set Vx = Vx - Vy, set VF = NOT borrow", x, y), nil
+	return nil
 }
 
 /*
@@ -325,10 +461,12 @@ func (cpu *Cpu) ins8xy5(op uint16) (string, error) {
    If the least-significant bit of Vx is 1, then VF is set to 1, otherwise 0. Then Vx is divided by 2.
 */
 
-func (cpu *Cpu) ins8xy6(op uint16) (string, error) {
-	_, _, _, x, y := getParameters(op)
+func (cpu *Cpu) ins8xy6(in Instruction) error {
+	x, y := in.X, in.Y
 
-	cpu.v[x] = cpu.v[y] // only original COSMAC VIP
+	if !cpu.quirks.Shift {
+		cpu.v[x] = cpu.v[y] // only original COSMAC VIP
+	}
 
 	carry := byte(0)
 	if (cpu.v[x] & 1) == 1 {
@@ -338,7 +476,7 @@ func (cpu *Cpu) ins8xy6(op uint16) (string, error) {
 	cpu.v[x] >>= 1
 	cpu.v[15] = carry
 
-	return fmt.Sprintf("SHR V%x, V%x\t; Vx = Vx SHR 1", x, y), nil
+	return nil
 }
 
 /*
@@ -347,8 +485,8 @@ func (cpu *Cpu) ins8xy6(op uint16) (string, error) {
    If Vy > Vx, then VF is set to 1, otherwise 0. Then Vx is subtracted from Vy, and the results stored in Vx.
 */
 
-func (cpu *Cpu) ins8xy7(op uint16) (string, error) {
-	_, _, _, x, y := getParameters(op)
+func (cpu *Cpu) ins8xy7(in Instruction) error {
+	x, y := in.X, in.Y
 
 	res := int16(cpu.v[y])
 	res -= int16(cpu.v[x])
@@ -359,7 +497,7 @@ func (cpu *Cpu) ins8xy7(op uint16) (string, error) {
 		cpu.v[15] = 1
 	}
 
-	return fmt.Sprintf("SUBN V%x, V%x\t; Set Vx = Vy - Vx, set VF = NOT borrow", x, y), nil
+	return nil
 }
 
 /*
@@ -368,10 +506,12 @@ func (cpu *Cpu) ins8xy7(op uint16) (string, error) {
    If the most-significant bit of Vx is 1, then VF is set to 1, otherwise to 0. Then Vx is multiplied by 2.
 */
 
-func (cpu *Cpu) ins8xyE(op uint16) (string, error) {
-	_, _, _, x, y := getParameters(op)
+func (cpu *Cpu) ins8xyE(in Instruction) error {
+	x, y := in.X, in.Y
 
-	cpu.v[x] = cpu.v[y] // only original COSMAC VIP
+	if !cpu.quirks.Shift {
+		cpu.v[x] = cpu.v[y] // only original COSMAC VIP
+	}
 
 	carry := byte(0)
 	if (cpu.v[x] & 0x80) == 0x80 {
@@ -381,7 +521,7 @@ func (cpu *Cpu) ins8xyE(op uint16) (string, error) {
 	cpu.v[x] <<= 1
 	cpu.v[15] = carry
 
-	return fmt.Sprintf("SHL V%x, V%x\t; Set Vx = Vx SHL 1", x, y), nil
+	return nil
 }
 
 /*
@@ -390,14 +530,14 @@ func (cpu *Cpu) ins8xyE(op uint16) (string, error) {
    The values of Vx and Vy are compared, and if they are not equal, the program counter is increased by 2.
 */
 
-func (cpu *Cpu) ins9xy0(op uint16) (string, error) {
-	_, _, _, x, y := getParameters(op)
+func (cpu *Cpu) ins9xy0(in Instruction) error {
+	x, y := in.X, in.Y
 
 	if cpu.v[x] != cpu.v[y] {
-		cpu.cnt += 2
+		cpu.skip()
 	}
 
-	return fmt.Sprintf("SNE V%x, V%x\t; Skip next instruction if Vx != Vy", x, y), nil
+	return nil
 }
 
 /*
@@ -406,12 +546,12 @@ func (cpu *Cpu) ins9xy0(op uint16) (string, error) {
    The value of register I is set to nnn.
 */
 
-func (cpu *Cpu) insAnnn(op uint16) (string, error) {
-	nnn, _, _, _, _ := getParameters(op)
+func (cpu *Cpu) insAnnn(in Instruction) error {
+	nnn := in.NNN
 
 	cpu.i = nnn
 
-	return fmt.Sprintf("LD I, 0x%03x\t; Set I = nnn", nnn), nil
+	return nil
 }
 
 /*
@@ -420,17 +560,20 @@ func (cpu *Cpu) insAnnn(op uint16) (string, error) {
    The program counter is set to nnn plus the value of V0.
 */
 
-func (cpu *Cpu) insBnnn(op uint16) (string, error) {
-	nnn, _, _, _, _ := getParameters(op)
+func (cpu *Cpu) insBnnn(in Instruction) error {
+	nnn, x := in.NNN, in.X
 
 	res := nnn + uint16(cpu.v[0])
+	if cpu.quirks.Jump {
+		res = nnn + uint16(cpu.v[x]) // Bxnn on CHIP-48 and SUPER-CHIP
+	}
 	err := cpu.checkAddr(res)
 	if err != nil {
-		return "", err
+		return err
 	}
 	cpu.cnt = res
 
-	return fmt.Sprintf("JP V0, 0x%03x\t; Jump to location nnn + V0", nnn), nil
+	return nil
 }
 
 /*
@@ -439,12 +582,12 @@ func (cpu *Cpu) insBnnn(op uint16) (string, error) {
    The interpreter generates a random number from 0 to 255, which is then ANDed with the value kk. The results are stored in Vx. See instruction 8xy2 for more information on AND.
 */
 
-func (cpu *Cpu) insCxkk(op uint16) (string, error) {
-	_, kk, _, x, _ := getParameters(op)
+func (cpu *Cpu) insCxkk(in Instruction) error {
+	kk, x := in.KK, in.X
 
-	cpu.v[x] = byte(rand.Intn(255)) & kk
+	cpu.v[x] = cpu.randomByte() & kk
 
-	return fmt.Sprintf("RND V%x, %02d\t; Set Vx = random byte AND kk", x, kk), nil
+	return nil
 }
 
 /*
@@ -453,30 +596,18 @@ func (cpu *Cpu) insCxkk(op uint16) (string, error) {
    The interpreter reads n bytes from memory, starting at the address stored in I. These bytes are then displayed as sprites on screen at coordinates (Vx, Vy). Sprites are XORed onto the existing screen. If this causes any pixels to be erased, VF is set to 1, otherwise it is set to 0. If the sprite is positioned so part of it is outside the coordinates of the display, it wraps around to the opposite side of the screen. See instruction 8xy3 for more information on XOR, and section 2.4, Display, for more information on the Chip-8 screen and sprites.
 */
 
-func (cpu *Cpu) insDxyn(op uint16) (string, error) {
-	_, _, n, vx, vy := getParameters(op)
-
-	// TODO so ugly
-
-	x := cpu.v[vx] % hardware.DISPLAY_WIDTH
-	y := cpu.v[vy] % hardware.DISPLAY_HEIGHT
+/*
+   Dxy0 - DRW Vx, Vy, 0
+   Display 16x16 sprite starting at memory location I at (Vx, Vy), set VF = collision (SUPER-CHIP).
+   The sprite is 32 bytes long, two bytes per line. It draws nothing on CHIP-8.
+*/
 
-	var dy byte = 0
+func (cpu *Cpu) insDxyn(in Instruction) error {
+	n, vx, vy := in.N, in.X, in.Y
 
-	cpu.v[15] = 0
-	for i := byte(0); i < n; i++ {
-		line := cpu.memory[cpu.i+uint16(i)]
-		for dx := byte(0); dx < 8; dx++ {
-			if (line & (1 << (7 - dx))) != 0 {
-				if cpu.display.PutPixel(x+dx, y+dy) {
-					cpu.v[15] = 1
-				}
-			}
-		}
-		dy++
-	}
+	cpu.drawSprite(vx, vy, n)
 
-	return fmt.Sprintf("DRW V%x, V%x, %02d\t; Display n-byte sprite starting at memory location I at (Vx, Vy), set VF = collision", vx, vy, n), nil
+	return nil
 }
 
 /*
@@ -485,14 +616,14 @@ func (cpu *Cpu) insDxyn(op uint16) (string, error) {
    Checks the keyboard, and if the key corresponding to the value of Vx is currently in the down position, PC is increased by 2.
 */
 
-func (cpu *Cpu) insEx9E(op uint16) (string, error) {
-	_, _, _, x, _ := getParameters(op)
+func (cpu *Cpu) insEx9E(in Instruction) error {
+	x := in.X
 
 	if (cpu.kbrd & uint16(1<<cpu.v[x])) != 0 {
-		cpu.cnt += 2
+		cpu.skip()
 	}
 
-	return fmt.Sprintf("SKP V%x\t; Skip next instruction if key with the value of Vx is pressed", x), nil
+	return nil
 }
 
 /*
@@ -501,14 +632,60 @@ func (cpu *Cpu) insEx9E(op uint16) (string, error) {
    Checks the keyboard, and if the key corresponding to the value of Vx is currently in the up position, PC is increased by 2.
 */
 
-func (cpu *Cpu) insExA1(op uint16) (string, error) {
-	_, _, _, x, _ := getParameters(op)
+func (cpu *Cpu) insExA1(in Instruction) error {
+	x := in.X
 
 	if (cpu.kbrd & uint16(1<<cpu.v[x])) == 0 {
-		cpu.cnt += 2
+		cpu.skip()
 	}
 
-	return fmt.Sprintf("SKPN V%x\t\t; Skip next instruction if key with the value of Vx is not pressed", x), nil
+	return nil
+}
+
+/*
+   F000 nnnn - LD I, long addr
+   Set I = nnnn, the 16-bit address in the next word (XO-CHIP).
+*/
+
+func (cpu *Cpu) insF000(in Instruction) error {
+	nnnn := uint16(cpu.memory[cpu.wrap(cpu.cnt)])<<8 | uint16(cpu.memory[cpu.wrap(cpu.cnt+1)])
+	cpu.i = nnnn
+	cpu.cnt += 2
+
+	return nil
+}
+
+/*
+   Fn01 - PLANE n
+   Select the drawing planes by bitmask n, 0 <= n <= 3 (XO-CHIP).
+*/
+
+func (cpu *Cpu) insFn01(in Instruction) error {
+	x := in.X
+
+	if x > 3 {
+		return fmt.Errorf("bad plane mask: %d", x)
+	}
+	cpu.planes = x
+	cpu.display.SetPlanes(x)
+
+	return nil
+}
+
+/*
+   F002 - AUDIO
+   Load the 16-byte audio pattern buffer from memory starting at location I (XO-CHIP).
+*/
+
+func (cpu *Cpu) insF002(in Instruction) error {
+	var pattern [hardware.PATTERN_SIZE]byte
+	for i := range pattern {
+		pattern[i] = cpu.read(cpu.i + uint16(i))
+	}
+	cpu.audioPattern = &pattern
+	cpu.sound.SetPattern(pattern)
+
+	return nil
 }
 
 /*
@@ -517,12 +694,12 @@ func (cpu *Cpu) insExA1(op uint16) (string, error) {
    The value of DT is placed into Vx.
 */
 
-func (cpu *Cpu) insFx07(op uint16) (string, error) {
-	_, _, _, x, _ := getParameters(op)
+func (cpu *Cpu) insFx07(in Instruction) error {
+	x := in.X
 
 	cpu.v[x] = cpu.timerDelay
 
-	return fmt.Sprintf("LD V%x, DT\t\t; Set Vx = delay timer value", x), nil
+	return nil
 }
 
 /*
@@ -531,8 +708,8 @@ func (cpu *Cpu) insFx07(op uint16) (string, error) {
    All execution stops until a key is pressed, then the value of that key is stored in Vx.
 */
 
-func (cpu *Cpu) insFx0A(op uint16) (string, error) {
-	_, _, _, x, _ := getParameters(op)
+func (cpu *Cpu) insFx0A(in Instruction) error {
+	x := in.X
 
 	res := cpu.keyboard.WaitKey()
 
@@ -542,7 +719,7 @@ func (cpu *Cpu) insFx0A(op uint16) (string, error) {
 		cpu.cnt -= 2
 	}
 
-	return fmt.Sprintf("LD V%x, K\t\t; Wait for a key press, store the value of the key in Vx", x), nil
+	return nil
 }
 
 /*
@@ -551,12 +728,12 @@ func (cpu *Cpu) insFx0A(op uint16) (string, error) {
    DT is set equal to the value of Vx.
 */
 
-func (cpu *Cpu) insFx15(op uint16) (string, error) {
-	_, _, _, x, _ := getParameters(op)
+func (cpu *Cpu) insFx15(in Instruction) error {
+	x := in.X
 
 	cpu.timerDelay = cpu.v[x]
 
-	return fmt.Sprintf("LD DT, V%x\t\t; Set delay timer = Vx", x), nil
+	return nil
 }
 
 /*
@@ -565,12 +742,12 @@ func (cpu *Cpu) insFx15(op uint16) (string, error) {
    ST is set equal to the value of Vx.
 */
 
-func (cpu *Cpu) insFx18(op uint16) (string, error) {
-	_, _, _, x, _ := getParameters(op)
+func (cpu *Cpu) insFx18(in Instruction) error {
+	x := in.X
 
 	cpu.timerSound = cpu.v[x]
 
-	return fmt.Sprintf("LD ST, V%x\t\t; Set sound timer = Vx", x), nil
+	return nil
 }
 
 /*
@@ -579,12 +756,12 @@ func (cpu *Cpu) insFx18(op uint16) (string, error) {
    The values of I and Vx are added, and the results are stored in I.
 */
 
-func (cpu *Cpu) insFx1E(op uint16) (string, error) {
-	_, _, _, x, _ := getParameters(op)
+func (cpu *Cpu) insFx1E(in Instruction) error {
+	x := in.X
 
 	cpu.i += uint16(cpu.v[x])
 
-	return fmt.Sprintf("ADD I, V%x\t\t; Set I = I + Vx", x), nil
+	return nil
 }
 
 /*
@@ -593,12 +770,25 @@ func (cpu *Cpu) insFx1E(op uint16) (string, error) {
    The value of I is set to the location for the hexadecimal sprite corresponding to the value of Vx. See section 2.4, Display, for more information on the Chip-8 hexadecimal font.
 */
 
-func (cpu *Cpu) insFx29(op uint16) (string, error) {
-	_, _, _, x, _ := getParameters(op)
+func (cpu *Cpu) insFx29(in Instruction) error {
+	x := in.X
 
 	cpu.i = SPRITE_ADDR + uint16(((cpu.v[x] & 0x0f) * 5))
 
-	return fmt.Sprintf("LD F, V%x\t\t; Set I = location of sprite for digit Vx", x), nil
+	return nil
+}
+
+/*
+   Fx30 - LD HF, Vx
+   Set I = location of 10-byte sprite for digit Vx (SUPER-CHIP).
+*/
+
+func (cpu *Cpu) insFx30(in Instruction) error {
+	x := in.X
+
+	cpu.i = BIG_SPRITE_ADDR + uint16(cpu.v[x]&0x0f)*10
+
+	return nil
 }
 
 /*
@@ -607,15 +797,28 @@ func (cpu *Cpu) insFx29(op uint16) (string, error) {
    The interpreter takes the decimal value of Vx, and places the hundreds digit in memory at location in I, the tens digit at location I+1, and the ones digit at location I+2.
 */
 
-func (cpu *Cpu) insFx33(op uint16) (string, error) {
-	_, _, _, x, _ := getParameters(op)
+func (cpu *Cpu) insFx33(in Instruction) error {
+	x := in.X
+
+	cpu.write(cpu.i, cpu.v[x]/100)
+	cpu.write(cpu.i+1, cpu.v[x]/10%10)
+	cpu.write(cpu.i+2, cpu.v[x]%10)
+
+	return nil
+}
+
+/*
+   Fx3A - PITCH Vx
+   Set the audio pattern playback rate to 4000*2^((Vx-64)/48) Hz (XO-CHIP).
+*/
+
+func (cpu *Cpu) insFx3A(in Instruction) error {
+	x := in.X
 
-	b := []byte(fmt.Sprintf("%03d", cpu.v[x]))
-	cpu.memory[cpu.i] = b[0] - 48
-	cpu.memory[cpu.i+1] = b[1] - 48
-	cpu.memory[cpu.i+2] = b[2] - 48
+	cpu.audioPitch = cpu.v[x]
+	cpu.sound.SetPitch(cpu.audioPitch)
 
-	return fmt.Sprintf("LD B, V%x\t\t; Store BCD representation of Vx in memory locations I, I+1, and I+2", x), nil
+	return nil
 }
 
 /*
@@ -624,15 +827,15 @@ func (cpu *Cpu) insFx33(op uint16) (string, error) {
    The interpreter copies the values of registers V0 through Vx into memory, starting at the address in I.
 */
 
-func (cpu *Cpu) insFx55(op uint16) (string, error) {
-	_, _, _, x, _ := getParameters(op)
+func (cpu *Cpu) insFx55(in Instruction) error {
+	x := in.X
 
 	for i := uint16(0); i <= uint16(x); i++ {
-		cpu.memory[cpu.i] = cpu.v[i]
-		cpu.i += 1
+		cpu.write(cpu.i+i, cpu.v[i])
 	}
+	cpu.incLoadStore(x)
 
-	return fmt.Sprintf("LD [I], V%x\t; Store registers V0 through Vx in memory starting at location I", x), nil
+	return nil
 }
 
 /*
@@ -641,13 +844,123 @@ func (cpu *Cpu) insFx55(op uint16) (string, error) {
    The interpreter reads values from memory starting at location I into registers V0 through Vx.
 */
 
-func (cpu *Cpu) insFx65(op uint16) (string, error) {
-	_, _, _, x, _ := getParameters(op)
+func (cpu *Cpu) insFx65(in Instruction) error {
+	x := in.X
 
 	for i := uint16(0); i <= uint16(x); i++ {
-		cpu.v[i] = cpu.memory[cpu.i]
-		cpu.i += 1
+		cpu.v[i] = cpu.read(cpu.i + i)
 	}
+	cpu.incLoadStore(x)
+
+	return nil
+}
 
-	return fmt.Sprintf("LD V%x, [I]\t; Read registers V0 through Vx from memory starting at location I", x), nil
+/*
+   Fx75 - LD R, Vx
+   Store V0 through Vx in the user flags, x < 8 (SUPER-CHIP) or x < 16 (XO-CHIP).
+*/
+
+func (cpu *Cpu) insFx75(in Instruction) error {
+	x := in.X
+
+	if x >= cpu.rplSize() {
+		return fmt.Errorf("bad user flags count: %d", x+1)
+	}
+	for i := byte(0); i <= x; i++ {
+		cpu.rpl[i] = cpu.v[i]
+	}
+
+	return nil
+}
+
+/*
+   Fx85 - LD Vx, R
+   Read V0 through Vx from the user flags, x < 8 (SUPER-CHIP) or x < 16 (XO-CHIP).
+*/
+
+func (cpu *Cpu) insFx85(in Instruction) error {
+	x := in.X
+
+	if x >= cpu.rplSize() {
+		return fmt.Errorf("bad user flags count: %d", x+1)
+	}
+	for i := byte(0); i <= x; i++ {
+		cpu.v[i] = cpu.rpl[i]
+	}
+
+	return nil
+}
+
+// skip skips the next instruction, which is 4 bytes long for the XO-CHIP F000 nnnn.
+func (cpu *Cpu) skip() {
+	if cpu.xochip() && cpu.memory[cpu.wrap(cpu.cnt)] == 0xf0 && cpu.memory[cpu.wrap(cpu.cnt+1)] == 0x00 {
+		cpu.cnt += 4
+	} else {
+		cpu.cnt += 2
+	}
+}
+
+// regRange returns the register numbers from x to y inclusive, in reverse order if x > y.
+func regRange(x, y byte) []byte {
+	var res []byte
+	if x <= y {
+		for r := x; r <= y; r++ {
+			res = append(res, r)
+		}
+	} else {
+		for r := int(x); r >= int(y); r-- {
+			res = append(res, byte(r))
+		}
+	}
+	return res
+}
+
+// drawSprite XORs an n-byte sprite from memory at I onto every selected plane at (Vx, Vy)
+// and sets VF on collision. A 16x16 sprite is drawn for n = 0 on SUPER-CHIP and XO-CHIP.
+func (cpu *Cpu) drawSprite(vx, vy, n byte) {
+	x := cpu.v[vx] % cpu.display.Width()
+	y := cpu.v[vy] % cpu.display.Height()
+
+	width, rows := byte(8), n
+	if n == 0 && cpu.schip() {
+		width, rows = 16, 16
+	}
+
+	addr := cpu.i
+	cpu.v[15] = 0
+	for plane := byte(1); plane <= 2; plane <<= 1 {
+		if (cpu.planes & plane) == 0 {
+			continue
+		}
+		for dy := byte(0); dy < rows; dy++ {
+			line := uint16(cpu.read(addr))
+			addr++
+			if width == 16 {
+				line = line<<8 | uint16(cpu.read(addr))
+				addr++
+			}
+			for dx := byte(0); dx < width; dx++ {
+				if (line & (1 << (width - 1 - dx))) != 0 {
+					px, py := x+dx, y+dy
+					if !cpu.quirks.Clip {
+						px %= cpu.display.Width()
+						py %= cpu.display.Height()
+					}
+					if cpu.display.PutPixel(px, py, plane) {
+						cpu.v[15] = 1
+					}
+				}
+			}
+		}
+	}
+	cpu.waitVBlank = cpu.quirks.DisplayWait
+}
+
+func (cpu *Cpu) incLoadStore(x byte) {
+	switch cpu.quirks.LoadStore {
+	case LOAD_STORE_INC_X1:
+		cpu.i += uint16(x) + 1
+	case LOAD_STORE_INC_X:
+		cpu.i += uint16(x)
+	}
 }
@@ -0,0 +1,374 @@
+package chip8
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha1"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/ministergoose/chip8-emu-go/chip8/hardware"
+)
+
+const (
+	MOVIE_MAGIC   = "C8MV"
+	MOVIE_VERSION = 1
+	// MAX_MOVIE_FRAMES are ten hours at 60 frames per second, a run of
+	// frames is a few bytes so the file length does not bound them
+	MAX_MOVIE_FRAMES = 10 * 60 * 60 * 60
+)
+
+/*
+   Movie layout, big endian:
+   movieHeader | (repeat uvarint, keys uint16, waits uvarint, (call uvarint, key byte)*)*
+
+   Frames with the same keys and no WaitKey results are stored as one run.
+*/
+
+type movieHeader struct {
+	Magic    [4]byte
+	Version  uint16
+	Platform Platform
+	Quirks   Quirks
+	RomHash  [sha1.Size]byte
+	RNG      RNG
+	Seed     uint64
+	TickRate uint32
+	Frames   uint32
+	Hash     [sha1.Size]byte
+}
+
+// Movie is the input of a play session from the start of the ROM, it plays
+// back to the same machine state.
+type Movie struct {
+	Platform Platform
+	Quirks   Quirks
+	RomHash  [sha1.Size]byte
+	RNG      RNG
+	Seed     uint64
+	TickRate int
+	Frames   []MovieFrame
+	Hash     [sha1.Size]byte // StateHash after the last frame, zero until Finish
+}
+
+// MovieFrame is the input of one frame.
+type MovieFrame struct {
+	Keys  uint16    // ReadKeys
+	Waits []KeyWait // WaitKey results other than 0x80
+}
+
+type KeyWait struct {
+	Call int // WaitKey call of the frame, from 0
+	Key  byte
+}
+
+// NewMovie starts a movie of c, which has just loaded its ROM, and seeds its
+// random number generator.
+func NewMovie(c *Cpu, seed uint64) *Movie {
+	c.Seed(seed)
+	return &Movie{
+		Platform: c.platform,
+		Quirks:   c.quirks,
+		RomHash:  c.romHash,
+		RNG:      c.random.Kind,
+		Seed:     seed,
+		TickRate: c.tickRate,
+	}
+}
+
+// Start sets c up like the recorded machine, c has just loaded the ROM of the movie.
+func (m *Movie) Start(c *Cpu) error {
+	if m.RomHash != c.romHash {
+		return fmt.Errorf("movie belongs to another ROM: %x", m.RomHash)
+	}
+	if m.Platform != c.platform {
+		return fmt.Errorf("movie was recorded on %s, not %s", m.Platform, c.platform)
+	}
+
+	c.SetQuirks(m.Quirks)
+	c.SetTickRate(m.TickRate)
+	c.SetRNG(m.RNG)
+	c.Seed(m.Seed)
+
+	return nil
+}
+
+func (m *Movie) Len() int {
+	return len(m.Frames)
+}
+
+// Truncate drops the frames from frame on.
+func (m *Movie) Truncate(frame int) {
+	if frame < len(m.Frames) {
+		m.Frames = m.Frames[:frame]
+	}
+	m.Hash = [sha1.Size]byte{}
+}
+
+// Finish stores the state hash of c, which has run all frames of the movie.
+func (m *Movie) Finish(c *Cpu) error {
+	hash, err := c.StateHash()
+	if err != nil {
+		return err
+	}
+	m.Hash = hash
+	return nil
+}
+
+// Verify compares the state of c after the last frame with the recorded one.
+func (m *Movie) Verify(c *Cpu) error {
+	if m.Hash == ([sha1.Size]byte{}) {
+		return fmt.Errorf("movie has no final state")
+	}
+	hash, err := c.StateHash()
+	if err != nil {
+		return err
+	}
+	if hash != m.Hash {
+		return fmt.Errorf("replay diverged: state %x after %d frames, recorded %x", hash, len(m.Frames), m.Hash)
+	}
+	return nil
+}
+
+// StateHash returns the SHA-1 of the save state.
+func (c *Cpu) StateHash() ([sha1.Size]byte, error) {
+	var buf bytes.Buffer
+	err := c.SaveState(&buf)
+	if err != nil {
+		return [sha1.Size]byte{}, err
+	}
+	return sha1.Sum(buf.Bytes()), nil
+}
+
+func (m *Movie) Save(w io.Writer) error {
+	if len(m.Frames) > MAX_MOVIE_FRAMES {
+		return fmt.Errorf("movie too long: %d frames", len(m.Frames))
+	}
+	hdr := movieHeader{
+		Version:  MOVIE_VERSION,
+		Platform: m.Platform,
+		Quirks:   m.Quirks,
+		RomHash:  m.RomHash,
+		RNG:      m.RNG,
+		Seed:     m.Seed,
+		TickRate: uint32(m.TickRate),
+		Frames:   uint32(len(m.Frames)),
+		Hash:     m.Hash,
+	}
+	copy(hdr.Magic[:], MOVIE_MAGIC)
+
+	bw := bufio.NewWriter(w)
+	err := binary.Write(bw, binary.BigEndian, hdr)
+	if err != nil {
+		return err
+	}
+
+	tmp := make([]byte, binary.MaxVarintLen64)
+	putUvarint := func(x int) {
+		bw.Write(tmp[:binary.PutUvarint(tmp, uint64(x))])
+	}
+	for i := 0; i < len(m.Frames); {
+		f := m.Frames[i]
+		n := 1
+		for len(f.Waits) == 0 && i+n < len(m.Frames) && len(m.Frames[i+n].Waits) == 0 && m.Frames[i+n].Keys == f.Keys {
+			n++
+		}
+		i += n
+
+		putUvarint(n)
+		bw.Write([]byte{byte(f.Keys >> 8), byte(f.Keys)})
+		putUvarint(len(f.Waits))
+		for _, wait := range f.Waits {
+			putUvarint(wait.Call)
+			bw.WriteByte(wait.Key)
+		}
+	}
+
+	return bw.Flush()
+}
+
+func LoadMovie(r io.Reader) (*Movie, error) {
+	br := bufio.NewReader(r)
+	var hdr movieHeader
+	err := binary.Read(br, binary.BigEndian, &hdr)
+	if err != nil {
+		return nil, err
+	}
+	if string(hdr.Magic[:]) != MOVIE_MAGIC {
+		return nil, fmt.Errorf("not a movie")
+	}
+	if hdr.Version != MOVIE_VERSION {
+		return nil, fmt.Errorf("unsupported movie version: %d", hdr.Version)
+	}
+	if hdr.Frames > MAX_MOVIE_FRAMES {
+		return nil, fmt.Errorf("movie too long: %d frames", hdr.Frames)
+	}
+
+	m := &Movie{
+		Platform: hdr.Platform,
+		Quirks:   hdr.Quirks,
+		RomHash:  hdr.RomHash,
+		RNG:      hdr.RNG,
+		Seed:     hdr.Seed,
+		TickRate: int(hdr.TickRate),
+		Hash:     hdr.Hash,
+	}
+
+	var keys [2]byte
+	for len(m.Frames) < int(hdr.Frames) {
+		n, err := binary.ReadUvarint(br)
+		if err != nil {
+			return nil, err
+		}
+		_, err = io.ReadFull(br, keys[:])
+		if err != nil {
+			return nil, err
+		}
+		waits, err := binary.ReadUvarint(br)
+		if err != nil {
+			return nil, err
+		}
+		if n == 0 || n > uint64(int(hdr.Frames)-len(m.Frames)) || waits > 0 && n != 1 {
+			return nil, fmt.Errorf("bad movie frame %d", len(m.Frames))
+		}
+
+		f := MovieFrame{Keys: uint16(keys[0])<<8 | uint16(keys[1])}
+		for j := uint64(0); j < waits; j++ {
+			call, err := binary.ReadUvarint(br)
+			if err != nil {
+				return nil, err
+			}
+			key, err := br.ReadByte()
+			if err != nil {
+				return nil, err
+			}
+			f.Waits = append(f.Waits, KeyWait{Call: int(call), Key: key})
+		}
+		for j := uint64(0); j < n; j++ {
+			m.Frames = append(m.Frames, f)
+		}
+	}
+
+	return m, nil
+}
+
+func (m *Movie) SaveFile(filePath string) error {
+	var buf bytes.Buffer
+	err := m.Save(&buf)
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(filePath, buf.Bytes(), 0644)
+}
+
+func LoadMovieFile(filePath string) (*Movie, error) {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return LoadMovie(f)
+}
+
+// MovieKeyboard plays back the frames of a movie and then records the frames
+// of the keyboard it wraps. Without a movie it only passes the keys on.
+type MovieKeyboard struct {
+	live   hardware.Keyboard // nil returns no keys after the replay
+	movie  *Movie
+	replay int // frames played back
+	frame  int // current frame, -1 before the first ReadKeys
+	call   int // WaitKey calls in the frame
+}
+
+func NewMovieKeyboard(live hardware.Keyboard) *MovieKeyboard {
+	return &MovieKeyboard{live: live, frame: -1}
+}
+
+// Record appends the following frames to m.
+func (kbrd *MovieKeyboard) Record(m *Movie) {
+	kbrd.Replay(m, 0)
+}
+
+// Replay plays back the first frames of m and records the following ones in
+// their place, from the start of the ROM.
+func (kbrd *MovieKeyboard) Replay(m *Movie, frames int) {
+	if frames > m.Len() {
+		frames = m.Len()
+	}
+	kbrd.movie, kbrd.replay, kbrd.frame, kbrd.call = m, frames, -1, 0
+}
+
+func (kbrd *MovieKeyboard) Movie() *Movie {
+	return kbrd.movie
+}
+
+// Replaying tells if the frames come from the movie.
+func (kbrd *MovieKeyboard) Replaying() bool {
+	return kbrd.movie != nil && kbrd.frame < kbrd.replay
+}
+
+func (kbrd *MovieKeyboard) ReadKeys() uint16 {
+	if kbrd.movie == nil {
+		return kbrd.readLive()
+	}
+
+	kbrd.frame++
+	kbrd.call = 0
+	if kbrd.frame < kbrd.replay {
+		return kbrd.movie.Frames[kbrd.frame].Keys
+	}
+
+	kbrd.movie.Truncate(kbrd.frame)
+	keys := kbrd.readLive()
+	kbrd.movie.Frames = append(kbrd.movie.Frames, MovieFrame{Keys: keys})
+	return keys
+}
+
+func (kbrd *MovieKeyboard) WaitKey() byte {
+	if kbrd.movie == nil || kbrd.frame < 0 {
+		return kbrd.waitLive()
+	}
+
+	call := kbrd.call
+	kbrd.call++
+	if kbrd.frame < kbrd.replay {
+		for _, wait := range kbrd.movie.Frames[kbrd.frame].Waits {
+			if wait.Call == call {
+				return wait.Key
+			}
+		}
+		return 0x80
+	}
+
+	key := kbrd.waitLive()
+	if key != 0x80 {
+		f := &kbrd.movie.Frames[len(kbrd.movie.Frames)-1]
+		f.Waits = append(f.Waits, KeyWait{Call: call, Key: key})
+	}
+	return key
+}
+
+// SetGameKeys passes the game keys of the ROM on to the wrapped keyboard.
+func (kbrd *MovieKeyboard) SetGameKeys(keys map[string]byte) {
+	if k, ok := kbrd.live.(keyLayoutKeyboard); ok {
+		k.SetGameKeys(keys)
+	}
+}
+
+func (kbrd *MovieKeyboard) readLive() uint16 {
+	if kbrd.live == nil {
+		return 0
+	}
+	return kbrd.live.ReadKeys()
+}
+
+func (kbrd *MovieKeyboard) waitLive() byte {
+	if kbrd.live == nil {
+		return 0x80
+	}
+	return kbrd.live.WaitKey()
+}
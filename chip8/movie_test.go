@@ -0,0 +1,179 @@
+package chip8
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/binary"
+	"testing"
+
+	"github.com/ministergoose/chip8-emu-go/chip8/hardware"
+	"github.com/ministergoose/chip8-emu-go/chip8/hardware/headless"
+)
+
+const MOVIE_FRAMES = 300
+
+// waits for keys, sums random numbers and counts while the key is held
+var MOVIE_ROM []byte = []byte{
+	0xF0, 0x0A, // 200 LD V0, K
+	0xC1, 0xFF, // 202 RND V1, 0xFF
+	0x83, 0x14, // 204 ADD V3, V1
+	0xE0, 0x9E, // 206 SKP V0
+	0x12, 0x00, // 208 JP 0x200
+	0x72, 0x01, // 20A ADD V2, 0x01
+	0x12, 0x06, // 20C JP 0x206
+}
+
+func newMovieCPU(t *testing.T, live hardware.Keyboard) (*Cpu, *MovieKeyboard) {
+	kbrd := NewMovieKeyboard(live)
+	c := NewCPU(headless.NewDisplayHeadless(), kbrd, headless.NewSoundHeadless(), QUIRKS_COSMAC_VIP)
+	err := c.LoadROM(MOVIE_ROM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c, kbrd
+}
+
+// play runs frames from..to, pressing a key every few frames.
+func play(c *Cpu, kbrd *headless.KeyboardHeadless, from, to int) {
+	for frame := from; frame < to; frame++ {
+		if kbrd != nil {
+			kbrd.SetKeys(0)
+			if frame%7 < 3 {
+				kbrd.Press(byte(frame / 7 % 16))
+			}
+		}
+		c.RunFrame()
+	}
+}
+
+func record(t *testing.T, seed uint64) []byte {
+	live := headless.NewKeyboardHeadless()
+	c, kbrd := newMovieCPU(t, live)
+	m := NewMovie(c, seed)
+	kbrd.Record(m)
+	play(c, live, 0, MOVIE_FRAMES)
+	err := m.Finish(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	err = m.Save(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func replay(t *testing.T, data []byte, live *headless.KeyboardHeadless, frames int) (*Cpu, *Movie) {
+	m, err := LoadMovie(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var keys hardware.Keyboard
+	if live != nil {
+		keys = live
+	}
+	c, kbrd := newMovieCPU(t, keys)
+	err = m.Start(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	kbrd.Replay(m, frames)
+	play(c, nil, 0, frames)
+	return c, m
+}
+
+func TestMovieReplay(t *testing.T) {
+	data := record(t, 1)
+
+	c, m := replay(t, data, nil, MOVIE_FRAMES)
+	if m.Len() != MOVIE_FRAMES {
+		t.Fatalf("%d frames, recorded %d", m.Len(), MOVIE_FRAMES)
+	}
+	err := m.Verify(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	waits := 0
+	for _, f := range m.Frames {
+		waits += len(f.Waits)
+	}
+	if waits == 0 {
+		t.Error("no WaitKey result was recorded")
+	}
+
+	// another seed draws other numbers, which the hash has to catch
+	other, _ := LoadMovie(bytes.NewReader(record(t, 2)))
+	m.Hash = other.Hash
+	if m.Verify(c) == nil {
+		t.Error("a different state verified")
+	}
+}
+
+func TestMovieContinue(t *testing.T) {
+	data := record(t, 1)
+
+	live := headless.NewKeyboardHeadless()
+	c, m := replay(t, data, live, 100)
+	play(c, live, 100, MOVIE_FRAMES)
+	err := m.Finish(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	err = m.Save(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the same input after the switch records the same movie
+	if !bytes.Equal(buf.Bytes(), data) {
+		t.Error("the continued movie differs from the recorded one")
+	}
+}
+
+func TestLoadMovieErrors(t *testing.T) {
+	data := record(t, 1)
+	frames := binary.Size(movieHeader{}) - sha1.Size - 4
+
+	long := append([]byte(nil), data...)
+	binary.BigEndian.PutUint32(long[frames:], 0xFFFFFFFF)
+	// a run of all the frames
+	long = append(long[:frames+4+sha1.Size], 0xFF, 0xFF, 0xFF, 0xFF, 0x0F, 0x00, 0x00, 0x00)
+
+	more := append([]byte(nil), data...)
+	binary.BigEndian.PutUint32(more[frames:], MOVIE_FRAMES+1)
+
+	for name, data := range map[string][]byte{
+		"magic":     append([]byte("C8MW"), data[4:]...),
+		"truncated": data[:len(data)-1],
+		"too long":  long,
+		"too short": more,
+	} {
+		_, err := LoadMovie(bytes.NewReader(data))
+		if err == nil {
+			t.Errorf("%s: no error", name)
+		}
+	}
+}
+
+func TestRewindWhileRecording(t *testing.T) {
+	live := headless.NewKeyboardHeadless()
+	c, kbrd := newMovieCPU(t, live)
+	kbrd.Record(NewMovie(c, 1))
+	play(c, live, 0, 10)
+
+	// main leaves Cpu.Rewind nil during a movie, rewinding does nothing
+	hash, err := c.StateHash()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ok, err := c.Rewind.Back(c)
+	if ok || err != nil {
+		t.Fatalf("Back of no rewind: %v %v", ok, err)
+	}
+	if after, _ := c.StateHash(); after != hash || c.Rewind.Len() != 0 {
+		t.Error("Back of no rewind changed the machine")
+	}
+}
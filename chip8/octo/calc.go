@@ -0,0 +1,160 @@
+package octo
+
+import (
+	"fmt"
+	"math"
+)
+
+var UNARY map[string]func(x float64) float64 = map[string]func(x float64) float64{
+	"-":     func(x float64) float64 { return -x },
+	"~":     func(x float64) float64 { return float64(^int64(x)) },
+	"!":     func(x float64) float64 { return bool2num(x == 0) },
+	"sin":   math.Sin,
+	"cos":   math.Cos,
+	"tan":   math.Tan,
+	"exp":   math.Exp,
+	"log":   math.Log,
+	"abs":   math.Abs,
+	"sqrt":  math.Sqrt,
+	"sign":  func(x float64) float64 { return bool2num(x > 0) - bool2num(x < 0) },
+	"ceil":  math.Ceil,
+	"floor": math.Floor,
+}
+
+var BINARY map[string]func(x, y float64) float64 = map[string]func(x, y float64) float64{
+	"+":   func(x, y float64) float64 { return x + y },
+	"-":   func(x, y float64) float64 { return x - y },
+	"*":   func(x, y float64) float64 { return x * y },
+	"/":   func(x, y float64) float64 { return x / y },
+	"%":   func(x, y float64) float64 { return math.Mod(x, y) },
+	"pow": math.Pow,
+	"min": math.Min,
+	"max": math.Max,
+	"&":   func(x, y float64) float64 { return float64(int64(x) & int64(y)) },
+	"|":   func(x, y float64) float64 { return float64(int64(x) | int64(y)) },
+	"^":   func(x, y float64) float64 { return float64(int64(x) ^ int64(y)) },
+	"<<":  func(x, y float64) float64 { return float64(int64(x) << uint(y)) },
+	">>":  func(x, y float64) float64 { return float64(int64(x) >> uint(y)) },
+	"<":   func(x, y float64) float64 { return bool2num(x < y) },
+	">":   func(x, y float64) float64 { return bool2num(x > y) },
+	"<=":  func(x, y float64) float64 { return bool2num(x <= y) },
+	">=":  func(x, y float64) float64 { return bool2num(x >= y) },
+	"==":  func(x, y float64) float64 { return bool2num(x == y) },
+	"!=":  func(x, y float64) float64 { return bool2num(x != y) },
+}
+
+func bool2num(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+type calcParser struct {
+	c    *compiler
+	toks []token
+	pos  int
+}
+
+// calc evaluates the tokens of a { } expression. Like in Octo all binary
+// operators have the same precedence and are evaluated right to left.
+func (c *compiler) calc(toks []token) (float64, error) {
+	p := &calcParser{c: c, toks: toks}
+	v, err := p.expr()
+	if err != nil {
+		return 0, err
+	}
+	if p.pos != len(toks) {
+		return 0, c.errorf("unexpected %q in expression", toks[p.pos].text)
+	}
+	return v, nil
+}
+
+func (p *calcParser) next() (token, error) {
+	if p.pos >= len(p.toks) {
+		return token{}, p.c.errorf("incomplete expression")
+	}
+	t := p.toks[p.pos]
+	p.pos++
+	return t, nil
+}
+
+func (p *calcParser) expr() (float64, error) {
+	x, err := p.term()
+	if err != nil {
+		return 0, err
+	}
+	if p.pos >= len(p.toks) {
+		return x, nil
+	}
+
+	f, ok := BINARY[p.toks[p.pos].text]
+	if !ok {
+		return x, nil
+	}
+	p.pos++
+	y, err := p.expr()
+	if err != nil {
+		return 0, err
+	}
+	return f(x, y), nil
+}
+
+func (p *calcParser) term() (float64, error) {
+	t, err := p.next()
+	if err != nil {
+		return 0, err
+	}
+
+	switch {
+	case t.text == "(":
+		v, err := p.expr()
+		if err != nil {
+			return 0, err
+		}
+		t, err := p.next()
+		if err != nil {
+			return 0, err
+		}
+		if t.text != ")" {
+			return 0, p.c.errorf("expected ) instead of %q", t.text)
+		}
+		return v, nil
+	case t.text == "@":
+		addr, err := p.term()
+		if err != nil {
+			return 0, err
+		}
+		return float64(p.c.romByte(int(addr))), nil
+	case t.text == "strlen":
+		s, err := p.next()
+		if err != nil {
+			return 0, err
+		}
+		if !s.str {
+			return 0, p.c.errorf("strlen needs a string")
+		}
+		return float64(len(s.text)), nil
+	}
+
+	if v, ok := parseNumber(t.text); ok {
+		return v, nil
+	}
+	if f, ok := UNARY[t.text]; ok {
+		x, err := p.term()
+		if err != nil {
+			return 0, err
+		}
+		return f(x), nil
+	}
+
+	v, ok := p.c.lookup(t.text)
+	if !ok {
+		return 0, p.c.errorf("undefined name in expression: %s", t.text)
+	}
+	return v, nil
+}
+
+func (c *compiler) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("%s:%d: %s", c.name, c.line, fmt.Sprintf(format, args...))
+}
@@ -0,0 +1,204 @@
+package octo
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/color"
+	"image/gif"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Octo shares programs as GIF "cartridges": the source and its options are
+// stored as JSON, prefixed with the 32-bit big endian length, in the low two
+// bits of the color indices of the first frame, four pixels per byte.
+
+const (
+	CART_WIDTH      = 128
+	CART_MIN_HEIGHT = 80
+	CART_TICKRATE   = 20 // instructions per frame when the options don't say
+)
+
+// Options are the settings of Octo that travel with a cartridge.
+type Options struct {
+	TickRate        int    `json:"tickrate"`
+	FillColor       string `json:"fillColor"`
+	FillColor2      string `json:"fillColor2"`
+	BlendColor      string `json:"blendColor"`
+	BackgroundColor string `json:"backgroundColor"`
+	BuzzColor       string `json:"buzzColor"`
+	QuietColor      string `json:"quietColor"`
+	ShiftQuirks     bool   `json:"shiftQuirks"`
+	LoadStoreQuirks bool   `json:"loadStoreQuirks"`
+	VFOrderQuirks   bool   `json:"vfOrderQuirks"`
+	ClipQuirks      bool   `json:"clipQuirks"`
+	VBlankQuirks    bool   `json:"vBlankQuirks"`
+	JumpQuirks      bool   `json:"jumpQuirks"`
+	LogicQuirks     bool   `json:"logicQuirks"`
+	ScreenRotation  int    `json:"screenRotation"`
+	MaxSize         int    `json:"maxSize"`
+	TouchInputMode  string `json:"touchInputMode"`
+	FontStyle       string `json:"fontStyle"`
+}
+
+type Cartridge struct {
+	Program string  `json:"program"` // Octo source
+	Options Options `json:"options"`
+}
+
+var DEFAULT_OPTIONS Options = Options{
+	TickRate:        CART_TICKRATE,
+	FillColor:       "#FFCC00",
+	FillColor2:      "#FF6600",
+	BlendColor:      "#662200",
+	BackgroundColor: "#996600",
+	BuzzColor:       "#FFAA00",
+	QuietColor:      "#000000",
+	MaxSize:         3216,
+	TouchInputMode:  "none",
+	FontStyle:       "octo",
+}
+
+// the visible colors of a cartridge, every one comes in four shades for the data bits
+var CART_COLORS [4]color.RGBA = [4]color.RGBA{
+	{0x20, 0x20, 0x20, 0xff}, // background
+	{0x60, 0x60, 0x68, 0xff}, // shell
+	{0xe8, 0xe0, 0xc8, 0xff}, // label
+	{0xff, 0xcc, 0x00, 0xff}, // label stripe
+}
+
+// IsCartridge tells if data looks like a GIF image.
+func IsCartridge(data []byte) bool {
+	return bytes.HasPrefix(data, []byte("GIF87a")) || bytes.HasPrefix(data, []byte("GIF89a"))
+}
+
+func DecodeCartridge(r io.Reader) (*Cartridge, error) {
+	g, err := gif.DecodeAll(r)
+	if err != nil {
+		return nil, err
+	}
+	if len(g.Image) == 0 {
+		return nil, fmt.Errorf("cartridge has no frames")
+	}
+
+	frame := g.Image[0]
+	b := frame.Bounds()
+	var data []byte
+	var acc byte
+	n := 0
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			acc = acc<<2 | frame.ColorIndexAt(x, y)&3
+			n++
+			if n == 4 {
+				data = append(data, acc)
+				acc, n = 0, 0
+			}
+		}
+	}
+
+	if len(data) < 4 {
+		return nil, fmt.Errorf("cartridge is too small")
+	}
+	size := int(data[0])<<24 | int(data[1])<<16 | int(data[2])<<8 | int(data[3])
+	if size < 0 || size > len(data)-4 {
+		return nil, fmt.Errorf("not an Octo cartridge")
+	}
+
+	cart := &Cartridge{Options: DEFAULT_OPTIONS}
+	err = json.Unmarshal(data[4:4+size], cart)
+	if err != nil {
+		return nil, fmt.Errorf("not an Octo cartridge: %v", err)
+	}
+	return cart, nil
+}
+
+// EncodeCartridge draws a cartridge with the program in its pixels.
+func EncodeCartridge(w io.Writer, cart *Cartridge) error {
+	payload, err := json.Marshal(cart)
+	if err != nil {
+		return err
+	}
+	size := len(payload)
+	data := append([]byte{byte(size >> 24), byte(size >> 16), byte(size >> 8), byte(size)}, payload...)
+
+	height := (len(data)*4 + CART_WIDTH - 1) / CART_WIDTH
+	if height < CART_MIN_HEIGHT {
+		height = CART_MIN_HEIGHT
+	}
+
+	palette := make(color.Palette, 0, 16)
+	for _, c := range CART_COLORS {
+		for shade := uint8(0); shade < 4; shade++ {
+			palette = append(palette, color.RGBA{c.R ^ shade, c.G ^ shade, c.B ^ shade, 0xff})
+		}
+	}
+
+	img := image.NewPaletted(image.Rect(0, 0, CART_WIDTH, height), palette)
+	for i := range img.Pix {
+		x, y := i%CART_WIDTH, i/CART_WIDTH
+		var bits byte
+		if i/4 < len(data) {
+			bits = data[i/4] >> (6 - 2*uint(i%4)) & 3
+		}
+		img.Pix[i] = cartColor(x, y, height)<<2 | bits
+	}
+
+	return gif.EncodeAll(w, &gif.GIF{Image: []*image.Paletted{img}, Delay: []int{0}})
+}
+
+// cartColor is the index of the visible color of a pixel of the cartridge picture.
+func cartColor(x, y, height int) byte {
+	const margin = 8
+	switch {
+	case x < margin || x >= CART_WIDTH-margin || y < margin || y >= height-margin:
+		return 0
+	case x >= 2*margin && x < CART_WIDTH-2*margin && y >= 2*margin && y < height/2:
+		if y < 2*margin+4 {
+			return 3
+		}
+		return 2
+	}
+	return 1
+}
+
+// ROMSource returns an Octo program that compiles to rom.
+func ROMSource(rom []byte) string {
+	var sb strings.Builder
+	sb.WriteString(": main")
+	for i, b := range rom {
+		if i%16 == 0 {
+			sb.WriteString("\n")
+		} else {
+			sb.WriteString(" ")
+		}
+		fmt.Fprintf(&sb, "0x%02X", b)
+	}
+	sb.WriteString("\n")
+	return sb.String()
+}
+
+// ParseColor parses the #RRGGBB colors of the options.
+func ParseColor(s string) (color.RGBA, error) {
+	v, err := strconv.ParseUint(strings.TrimPrefix(s, "#"), 16, 32)
+	if err != nil || len(strings.TrimPrefix(s, "#")) != 6 {
+		return color.RGBA{}, fmt.Errorf("bad color: %q", s)
+	}
+	return color.RGBA{byte(v >> 16), byte(v >> 8), byte(v), 0xff}, nil
+}
+
+// Palette returns the background, plane 1, plane 2 and both planes colors.
+func (o Options) Palette() ([4]color.RGBA, error) {
+	var p [4]color.RGBA
+	for i, s := range []string{o.BackgroundColor, o.FillColor, o.FillColor2, o.BlendColor} {
+		c, err := ParseColor(s)
+		if err != nil {
+			return p, err
+		}
+		p[i] = c
+	}
+	return p, nil
+}
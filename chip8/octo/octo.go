@@ -0,0 +1,395 @@
+// Package octo compiles programs written in the Octo language
+// (https://johnearnest.github.io/Octo/docs/Manual.html) to CHIP-8,
+// SUPER-CHIP and XO-CHIP ROMs.
+//
+// Labels can be used before they are defined, the program is compiled twice
+// and the second pass uses the label addresses of the first one.
+package octo
+
+import (
+	"io"
+	"os"
+	"strings"
+
+	"github.com/ministergoose/chip8-emu-go/chip8/srcmap"
+)
+
+const (
+	START_ADDR      = 0x200
+	MAX_EXPANSIONS  = 100000 // macro invocations, guards against recursive macros
+	MAX_MEMORY_SIZE = 0x10000
+)
+
+// Platform is the least platform a program needs, in the order of chip8.Platform.
+type Platform byte
+
+const (
+	PLATFORM_CHIP8 Platform = iota
+	PLATFORM_SCHIP
+	PLATFORM_XOCHIP
+)
+
+type Result struct {
+	ROM      []byte
+	Labels   map[string]uint16
+	Platform Platform
+	smap     *srcmap.SourceMap
+}
+
+type macro struct {
+	args  []string
+	body  []token
+	calls int
+}
+
+type loop struct {
+	start  int
+	breaks []int // addresses of the jumps of while
+}
+
+type compiler struct {
+	name string
+	toks []token
+	pos  int
+	line int
+
+	pass int
+	prev map[string]int // labels of the first pass
+
+	rom      []byte // from START_ADDR
+	here     int
+	labels   map[string]int
+	consts   map[string]float64
+	aliases  map[string]byte
+	macros   map[string]*macro
+	next     string // label of the byte after the next instruction's first
+	loops    []*loop
+	ifs      []int // addresses of the jumps of the open begin blocks
+	platform Platform
+
+	expansions int
+	smap       *srcmap.SourceMap
+	lastLine   int
+	lastAddr   int
+}
+
+func Compile(name string, src []byte) (*Result, error) {
+	toks, err := tokenize(string(src))
+	if err != nil {
+		return nil, err
+	}
+
+	var prev map[string]int
+	var c *compiler
+	for pass := 1; pass <= 2; pass++ {
+		c = &compiler{
+			name:    name,
+			toks:    append([]token{}, toks...),
+			pass:    pass,
+			prev:    prev,
+			labels:  map[string]int{},
+			consts:  map[string]float64{},
+			aliases: map[string]byte{},
+			macros:  map[string]*macro{},
+			smap:    srcmap.New(),
+		}
+		err := c.run()
+		if err != nil {
+			return nil, err
+		}
+		prev = c.labels
+	}
+
+	res := &Result{ROM: c.rom, Labels: map[string]uint16{}, Platform: c.platform, smap: c.smap}
+	for name, addr := range c.labels {
+		res.Labels[name] = uint16(addr)
+		c.smap.AddLabel(name, uint16(addr))
+	}
+	return res, nil
+}
+
+func CompileFile(filePath string) (*Result, error) {
+	src, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, err
+	}
+	return Compile(filePath, src)
+}
+
+// SourceMap returns the source lines of the code and the labels.
+func (r *Result) SourceMap() *srcmap.SourceMap {
+	return r.smap
+}
+
+// WriteSymbols writes the symbol table in the source map format.
+func (r *Result) WriteSymbols(w io.Writer) error {
+	return r.smap.Write(w)
+}
+
+func (c *compiler) run() error {
+	// a jump to main at 0x200 unless the program starts with it
+	c.here = START_ADDR
+	jumpMain := !(len(c.toks) >= 2 && c.toks[0].text == ":" && c.toks[1].text == "main")
+	if jumpMain {
+		c.emit(0, 0)
+	}
+
+	for c.pos < len(c.toks) {
+		err := c.statement()
+		if err != nil {
+			return err
+		}
+		if c.here > MAX_MEMORY_SIZE {
+			return c.errorf("program doesn't fit in memory")
+		}
+	}
+
+	if len(c.loops) > 0 {
+		return c.errorf("loop without again")
+	}
+	if len(c.ifs) > 0 {
+		return c.errorf("begin without end")
+	}
+	if jumpMain {
+		main, ok := c.labels["main"]
+		if !ok {
+			return c.errorf("no main label")
+		}
+		err := c.patchJump(START_ADDR, main)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (c *compiler) need(p Platform) {
+	if p > c.platform {
+		c.platform = p
+	}
+}
+
+func (c *compiler) emit(bytes ...byte) {
+	off := c.here - START_ADDR
+	if off < 0 {
+		return
+	}
+	if need := off + len(bytes); need > len(c.rom) {
+		c.rom = append(c.rom, make([]byte, need-len(c.rom))...)
+	}
+	copy(c.rom[off:], bytes)
+
+	if c.line > 0 && (c.line != c.lastLine || c.here != c.lastAddr) {
+		c.smap.AddLine(uint16(c.here), c.name, c.line)
+	}
+	c.here += len(bytes)
+	c.lastLine, c.lastAddr = c.line, c.here
+}
+
+func (c *compiler) inst(op uint16) {
+	if c.next != "" {
+		c.labels[c.next] = c.here + 1
+		c.next = ""
+	}
+	c.emit(byte(op>>8), byte(op))
+}
+
+func (c *compiler) romByte(addr int) byte {
+	off := addr - START_ADDR
+	if off < 0 || off >= len(c.rom) {
+		return 0
+	}
+	return c.rom[off]
+}
+
+func (c *compiler) patchJump(at, target int) error {
+	if target > 0xfff {
+		return c.errorf("jump target 0x%X out of range", target)
+	}
+	c.rom[at-START_ADDR] = byte(0x10 | target>>8)
+	c.rom[at-START_ADDR+1] = byte(target)
+	return nil
+}
+
+func (c *compiler) nextToken() (token, error) {
+	if c.pos >= len(c.toks) {
+		return token{}, c.errorf("unexpected end of program")
+	}
+	t := c.toks[c.pos]
+	c.pos++
+	c.line = t.line
+	return t, nil
+}
+
+func (c *compiler) peek() string {
+	if c.pos >= len(c.toks) {
+		return ""
+	}
+	return c.toks[c.pos].text
+}
+
+func (c *compiler) expect(text string) error {
+	t, err := c.nextToken()
+	if err != nil {
+		return err
+	}
+	if t.text != text {
+		return c.errorf("expected %s instead of %q", text, t.text)
+	}
+	return nil
+}
+
+func (c *compiler) define(name string) error {
+	if _, ok := c.labels[name]; ok {
+		return c.errorf("%s redefined", name)
+	}
+	if _, ok := c.consts[name]; ok {
+		return c.errorf("%s redefined", name)
+	}
+	if c.pass == 2 {
+		if addr, ok := c.prev[name]; ok && addr != c.here {
+			return c.errorf("%s moved between passes, is it used before it is defined as a constant?", name)
+		}
+	}
+	c.labels[name] = c.here
+	return nil
+}
+
+// lookup returns the value of a constant or label.
+func (c *compiler) lookup(name string) (float64, bool) {
+	if v, ok := c.consts[name]; ok {
+		return v, true
+	}
+	if addr, ok := c.labels[name]; ok {
+		return float64(addr), true
+	}
+	if addr, ok := c.prev[name]; ok {
+		return float64(addr), true
+	}
+	switch name {
+	case "HERE":
+		return float64(c.here), true
+	}
+	// forward references are resolved by the second pass
+	if c.pass == 1 {
+		return 0, true
+	}
+	return 0, false
+}
+
+func (c *compiler) value(t token) (int, error) {
+	if v, ok := parseNumber(t.text); ok {
+		return int(v), nil
+	}
+	if v, ok := c.lookup(t.text); ok {
+		return int(v), nil
+	}
+	return 0, c.errorf("undefined name: %s", t.text)
+}
+
+func (c *compiler) valueRange(t token, min, max int) (int, error) {
+	v, err := c.value(t)
+	if err != nil {
+		return 0, err
+	}
+	if c.pass == 2 && (v < min || v > max) {
+		return 0, c.errorf("value out of range: %s = %d", t.text, v)
+	}
+	return v, nil
+}
+
+func (c *compiler) nextValue(min, max int) (int, error) {
+	t, err := c.nextToken()
+	if err != nil {
+		return 0, err
+	}
+	return c.valueRange(t, min, max)
+}
+
+func (c *compiler) nextByte() (uint16, error) {
+	v, err := c.nextValue(-128, 0xff)
+	return uint16(byte(v)), err
+}
+
+func (c *compiler) nextAddr() (uint16, error) {
+	v, err := c.nextValue(0, 0xfff)
+	return uint16(v) & 0xfff, err
+}
+
+func parseReg(s string) (byte, bool) {
+	if len(s) != 2 || (s[0] != 'v' && s[0] != 'V') {
+		return 0, false
+	}
+	i := strings.IndexByte("0123456789abcdef", s[1]|0x20)
+	if i < 0 {
+		return 0, false
+	}
+	return byte(i), true
+}
+
+func (c *compiler) isReg(s string) bool {
+	if _, ok := parseReg(s); ok {
+		return true
+	}
+	_, ok := c.aliases[s]
+	return ok
+}
+
+func (c *compiler) reg(t token) (byte, error) {
+	if r, ok := parseReg(t.text); ok {
+		return r, nil
+	}
+	if r, ok := c.aliases[t.text]; ok {
+		return r, nil
+	}
+	return 0, c.errorf("expected a register instead of %q", t.text)
+}
+
+func (c *compiler) nextReg() (uint16, error) {
+	t, err := c.nextToken()
+	if err != nil {
+		return 0, err
+	}
+	r, err := c.reg(t)
+	return uint16(r), err
+}
+
+// block returns the tokens between { and the matching }.
+func (c *compiler) block() ([]token, error) {
+	err := c.expect("{")
+	if err != nil {
+		return nil, err
+	}
+	start, depth := c.pos, 1
+	for ; c.pos < len(c.toks); c.pos++ {
+		switch c.toks[c.pos].text {
+		case "{":
+			depth++
+		case "}":
+			depth--
+		}
+		if depth == 0 {
+			c.pos++
+			return c.toks[start : c.pos-1], nil
+		}
+	}
+	return nil, c.errorf("missing }")
+}
+
+// calcValue reads a number, a name or a { } expression.
+func (c *compiler) calcValue() (float64, error) {
+	if c.peek() == "{" {
+		toks, err := c.block()
+		if err != nil {
+			return 0, err
+		}
+		return c.calc(toks)
+	}
+	t, err := c.nextToken()
+	if err != nil {
+		return 0, err
+	}
+	v, err := c.value(t)
+	return float64(v), err
+}
@@ -0,0 +1,596 @@
+package octo
+
+import (
+	"math"
+	"strconv"
+)
+
+func (c *compiler) statement() error {
+	t, err := c.nextToken()
+	if err != nil {
+		return err
+	}
+	if t.str {
+		return c.errorf("unexpected string %q", t.text)
+	}
+
+	switch t.text {
+	case ":":
+		name, err := c.nextToken()
+		if err != nil {
+			return err
+		}
+		return c.define(name.text)
+	case ":alias":
+		name, err := c.nextToken()
+		if err != nil {
+			return err
+		}
+		r, err := c.nextReg()
+		c.aliases[name.text] = byte(r)
+		return err
+	case ":const":
+		name, err := c.nextToken()
+		if err != nil {
+			return err
+		}
+		v, err := c.calcValue()
+		if err != nil {
+			return err
+		}
+		if _, ok := c.consts[name.text]; ok {
+			return c.errorf("%s redefined", name.text)
+		}
+		c.consts[name.text] = v
+		return nil
+	case ":calc":
+		name, err := c.nextToken()
+		if err != nil {
+			return err
+		}
+		toks, err := c.block()
+		if err != nil {
+			return err
+		}
+		v, err := c.calc(toks)
+		c.consts[name.text] = v
+		return err
+	case ":unpack":
+		return c.unpack()
+	case ":next":
+		name, err := c.nextToken()
+		c.next = name.text
+		return err
+	case ":org":
+		v, err := c.calcValue()
+		if err != nil {
+			return err
+		}
+		if v < START_ADDR || v >= MAX_MEMORY_SIZE {
+			return c.errorf(":org out of range: 0x%X", int(v))
+		}
+		c.here = int(v)
+		return nil
+	case ":macro":
+		return c.defineMacro()
+	case ":byte":
+		v, err := c.calcValue()
+		c.emit(byte(int(math.Floor(v))))
+		return err
+	case ":pointer":
+		v, err := c.calcValue()
+		p := int(math.Floor(v))
+		c.emit(byte(p>>8), byte(p))
+		return err
+	case ":assert":
+		msg := "assertion failed"
+		if c.pos < len(c.toks) && c.toks[c.pos].str {
+			msg = c.toks[c.pos].text
+			c.pos++
+		}
+		v, err := c.calcValue()
+		if err != nil {
+			return err
+		}
+		if c.pass == 2 && v == 0 {
+			return c.errorf("%s", msg)
+		}
+		return nil
+	case ":breakpoint", ":proto":
+		_, err := c.nextToken()
+		return err
+	case ":monitor":
+		c.pos += 2
+		return nil
+	case ":call":
+		addr, err := c.nextAddr()
+		c.inst(0x2000 | addr)
+		return err
+	case ":stringmode":
+		return c.errorf(":stringmode is not supported")
+	case ";", "return":
+		c.inst(0x00ee)
+	case "clear":
+		c.inst(0x00e0)
+	case "hires":
+		c.need(PLATFORM_SCHIP)
+		c.inst(0x00ff)
+	case "lores":
+		c.need(PLATFORM_SCHIP)
+		c.inst(0x00fe)
+	case "exit":
+		c.need(PLATFORM_SCHIP)
+		c.inst(0x00fd)
+	case "scroll-down":
+		c.need(PLATFORM_SCHIP)
+		n, err := c.nextValue(0, 15)
+		c.inst(0x00c0 | uint16(n))
+		return err
+	case "scroll-up":
+		c.need(PLATFORM_XOCHIP)
+		n, err := c.nextValue(0, 15)
+		c.inst(0x00d0 | uint16(n))
+		return err
+	case "scroll-left":
+		c.need(PLATFORM_SCHIP)
+		c.inst(0x00fc)
+	case "scroll-right":
+		c.need(PLATFORM_SCHIP)
+		c.inst(0x00fb)
+	case "bcd":
+		x, err := c.nextReg()
+		c.inst(0xf033 | x<<8)
+		return err
+	case "save", "load":
+		return c.saveLoad(t.text == "save")
+	case "saveflags", "loadflags":
+		x, err := c.nextReg()
+		c.need(PLATFORM_SCHIP)
+		if x > 7 {
+			c.need(PLATFORM_XOCHIP)
+		}
+		op := uint16(0xf075)
+		if t.text == "loadflags" {
+			op = 0xf085
+		}
+		c.inst(op | x<<8)
+		return err
+	case "sprite":
+		x, err := c.nextReg()
+		if err != nil {
+			return err
+		}
+		y, err := c.nextReg()
+		if err != nil {
+			return err
+		}
+		n, err := c.nextValue(0, 15)
+		if n == 0 {
+			c.need(PLATFORM_SCHIP)
+		}
+		c.inst(0xd000 | x<<8 | y<<4 | uint16(n))
+		return err
+	case "jump", "jump0", "native":
+		addr, err := c.nextAddr()
+		c.inst(map[string]uint16{"jump": 0x1000, "jump0": 0xb000, "native": 0x0000}[t.text] | addr)
+		return err
+	case "audio":
+		c.need(PLATFORM_XOCHIP)
+		c.inst(0xf002)
+	case "plane":
+		c.need(PLATFORM_XOCHIP)
+		n, err := c.nextValue(0, 3)
+		c.inst(0xf001 | uint16(n)<<8)
+		return err
+	case "delay", "buzzer", "pitch":
+		err := c.expect(":=")
+		if err != nil {
+			return err
+		}
+		x, err := c.nextReg()
+		op := map[string]uint16{"delay": 0xf015, "buzzer": 0xf018, "pitch": 0xf03a}[t.text]
+		if t.text == "pitch" {
+			c.need(PLATFORM_XOCHIP)
+		}
+		c.inst(op | x<<8)
+		return err
+	case "i":
+		return c.assignI()
+	case "if":
+		return c.conditional()
+	case "else":
+		if len(c.ifs) == 0 {
+			return c.errorf("else without begin")
+		}
+		at := c.here
+		c.inst(0x1000)
+		err := c.patchJump(c.ifs[len(c.ifs)-1], c.here)
+		c.ifs[len(c.ifs)-1] = at
+		return err
+	case "end":
+		if len(c.ifs) == 0 {
+			return c.errorf("end without begin")
+		}
+		at := c.ifs[len(c.ifs)-1]
+		c.ifs = c.ifs[:len(c.ifs)-1]
+		return c.patchJump(at, c.here)
+	case "loop":
+		c.loops = append(c.loops, &loop{start: c.here})
+	case "again":
+		if len(c.loops) == 0 {
+			return c.errorf("again without loop")
+		}
+		l := c.loops[len(c.loops)-1]
+		c.loops = c.loops[:len(c.loops)-1]
+		if l.start > 0xfff {
+			return c.errorf("loop at 0x%X out of jump range", l.start)
+		}
+		c.inst(0x1000 | uint16(l.start))
+		for _, at := range l.breaks {
+			err := c.patchJump(at, c.here)
+			if err != nil {
+				return err
+			}
+		}
+	case "while":
+		if len(c.loops) == 0 {
+			return c.errorf("while without loop")
+		}
+		err := c.condition(true)
+		if err != nil {
+			return err
+		}
+		l := c.loops[len(c.loops)-1]
+		l.breaks = append(l.breaks, c.here)
+		c.inst(0x1000)
+	default:
+		return c.other(t)
+	}
+
+	return nil
+}
+
+// other handles register operations, data bytes, macros and subroutine calls.
+func (c *compiler) other(t token) error {
+	if c.isReg(t.text) {
+		x, _ := c.reg(t)
+		return c.assignReg(uint16(x))
+	}
+	if v, ok := parseNumber(t.text); ok {
+		c.emit(byte(int(v)))
+		return nil
+	}
+	if m, ok := c.macros[t.text]; ok {
+		return c.expand(m)
+	}
+	if v, ok := c.consts[t.text]; ok {
+		c.emit(byte(int(v)))
+		return nil
+	}
+
+	addr, ok := c.labels[t.text]
+	if !ok {
+		addr, ok = c.prev[t.text]
+	}
+	if !ok && c.pass == 2 {
+		return c.errorf("undefined name: %s", t.text)
+	}
+	if addr > 0xfff {
+		return c.errorf("subroutine %s at 0x%X out of call range", t.text, addr)
+	}
+	c.inst(0x2000 | uint16(addr))
+	return nil
+}
+
+func (c *compiler) assignReg(x uint16) error {
+	op, err := c.nextToken()
+	if err != nil {
+		return err
+	}
+	rhs, err := c.nextToken()
+	if err != nil {
+		return err
+	}
+
+	if c.isReg(rhs.text) {
+		y, _ := c.reg(rhs)
+		codes := map[string]uint16{":=": 0x0, "|=": 0x1, "&=": 0x2, "^=": 0x3, "+=": 0x4, "-=": 0x5, ">>=": 0x6, "=-": 0x7, "<<=": 0xe}
+		code, ok := codes[op.text]
+		if !ok {
+			return c.errorf("unknown operator: %s", op.text)
+		}
+		c.inst(0x8000 | x<<8 | uint16(y)<<4 | code)
+		return nil
+	}
+
+	switch op.text {
+	case ":=":
+		switch rhs.text {
+		case "key":
+			c.inst(0xf00a | x<<8)
+			return nil
+		case "delay":
+			c.inst(0xf007 | x<<8)
+			return nil
+		case "random":
+			kk, err := c.nextByte()
+			c.inst(0xc000 | x<<8 | kk)
+			return err
+		}
+		kk, err := c.valueRange(rhs, -128, 0xff)
+		c.inst(0x6000 | x<<8 | uint16(byte(kk)))
+		return err
+	case "+=", "-=":
+		kk, err := c.valueRange(rhs, -128, 0xff)
+		if op.text == "-=" {
+			kk = -kk
+		}
+		c.inst(0x7000 | x<<8 | uint16(byte(kk)))
+		return err
+	}
+
+	return c.errorf("bad operands: %s %s", op.text, rhs.text)
+}
+
+func (c *compiler) assignI() error {
+	op, err := c.nextToken()
+	if err != nil {
+		return err
+	}
+
+	switch op.text {
+	case "+=":
+		x, err := c.nextReg()
+		c.inst(0xf01e | x<<8)
+		return err
+	case ":=":
+		switch c.peek() {
+		case "hex":
+			c.pos++
+			x, err := c.nextReg()
+			c.inst(0xf029 | x<<8)
+			return err
+		case "bighex":
+			c.pos++
+			c.need(PLATFORM_SCHIP)
+			x, err := c.nextReg()
+			c.inst(0xf030 | x<<8)
+			return err
+		case "long":
+			c.pos++
+			c.need(PLATFORM_XOCHIP)
+			v, err := c.nextValue(0, 0xffff)
+			c.inst(0xf000)
+			c.emit(byte(v>>8), byte(v))
+			return err
+		}
+		addr, err := c.nextAddr()
+		c.inst(0xa000 | addr)
+		return err
+	}
+
+	return c.errorf("unknown operator: i %s", op.text)
+}
+
+func (c *compiler) saveLoad(save bool) error {
+	x, err := c.nextReg()
+	if err != nil {
+		return err
+	}
+
+	if c.peek() == "-" {
+		c.pos++
+		y, err := c.nextReg()
+		c.need(PLATFORM_XOCHIP)
+		op := uint16(0x5003)
+		if save {
+			op = 0x5002
+		}
+		c.inst(op | x<<8 | y<<4)
+		return err
+	}
+
+	op := uint16(0xf065)
+	if save {
+		op = 0xf055
+	}
+	c.inst(op | x<<8)
+	return nil
+}
+
+// unpack loads v0 and v1 with a nibble and an address, or a 16-bit address with long.
+func (c *compiler) unpack() error {
+	var hi, lo int
+	if c.peek() == "long" {
+		c.pos++
+		v, err := c.nextValue(0, 0xffff)
+		if err != nil {
+			return err
+		}
+		hi, lo = v>>8, v
+	} else {
+		nibble, err := c.nextValue(0, 15)
+		if err != nil {
+			return err
+		}
+		addr, err := c.nextValue(0, 0xfff)
+		if err != nil {
+			return err
+		}
+		hi, lo = nibble<<4|addr>>8, addr
+	}
+
+	c.inst(0x6000 | uint16(byte(hi)))
+	c.inst(0x6100 | uint16(byte(lo)))
+	return nil
+}
+
+func (c *compiler) conditional() error {
+	// the kind of the block follows "vx key" or "vx op operand"
+	at := c.pos + 3
+	if at-2 < len(c.toks) && (c.toks[at-2].text == "key" || c.toks[at-2].text == "-key") {
+		at--
+	}
+	if at >= len(c.toks) {
+		return c.errorf("expected then or begin")
+	}
+
+	switch kind := c.toks[at].text; kind {
+	case "then":
+		err := c.condition(false)
+		c.pos++
+		return err
+	case "begin":
+		// skip the jump to else or end when the condition is true
+		err := c.condition(true)
+		c.pos++
+		c.ifs = append(c.ifs, c.here)
+		c.inst(0x1000)
+		return err
+	default:
+		c.line = c.toks[at].line
+		return c.errorf("expected then or begin instead of %q", kind)
+	}
+}
+
+// condition compiles "vx op operand" so that the next instruction is skipped
+// when the condition is false, or when it is true with skipWhenTrue.
+func (c *compiler) condition(skipWhenTrue bool) error {
+	x, err := c.nextReg()
+	if err != nil {
+		return err
+	}
+	op, err := c.nextToken()
+	if err != nil {
+		return err
+	}
+
+	var rhs token
+	if op.text != "key" && op.text != "-key" {
+		rhs, err = c.nextToken()
+		if err != nil {
+			return err
+		}
+	}
+
+	reg := c.isReg(rhs.text)
+	var y, kk uint16
+	if op.text != "key" && op.text != "-key" {
+		if reg {
+			r, _ := c.reg(rhs)
+			y = uint16(r)
+		} else {
+			v, err := c.valueRange(rhs, -128, 0xff)
+			if err != nil {
+				return err
+			}
+			kk = uint16(byte(v))
+		}
+	}
+
+	// eq emits skipEq, which skips when the condition holds, or its opposite
+	eq := func(skipEq, skipNe uint16) {
+		if skipWhenTrue {
+			c.inst(skipEq)
+		} else {
+			c.inst(skipNe)
+		}
+	}
+
+	switch op.text {
+	case "key":
+		eq(0xe09e|x<<8, 0xe0a1|x<<8)
+	case "-key":
+		eq(0xe0a1|x<<8, 0xe09e|x<<8)
+	case "==":
+		if reg {
+			eq(0x5000|x<<8|y<<4, 0x9000|x<<8|y<<4)
+		} else {
+			eq(0x3000|x<<8|kk, 0x4000|x<<8|kk)
+		}
+	case "!=":
+		if reg {
+			eq(0x9000|x<<8|y<<4, 0x5000|x<<8|y<<4)
+		} else {
+			eq(0x4000|x<<8|kk, 0x3000|x<<8|kk)
+		}
+	case "<", ">", "<=", ">=":
+		// vf := operand, then the borrow flag of a subtraction decides
+		if reg {
+			c.inst(0x8f00 | y<<4)
+		} else {
+			c.inst(0x6f00 | kk)
+		}
+		flag := uint16(0)
+		switch op.text {
+		case ">", "<=":
+			c.inst(0x8f05 | x<<4) // vf -= vx, vf = 1 if operand >= vx
+			if op.text == "<=" {
+				flag = 1
+			}
+		case "<", ">=":
+			c.inst(0x8f07 | x<<4) // vf =- vx, vf = 1 if vx >= operand
+			if op.text == ">=" {
+				flag = 1
+			}
+		}
+		eq(0x3f00|flag, 0x4f00|flag)
+	default:
+		return c.errorf("unknown comparison: %s", op.text)
+	}
+
+	return nil
+}
+
+func (c *compiler) defineMacro() error {
+	name, err := c.nextToken()
+	if err != nil {
+		return err
+	}
+	m := &macro{}
+	for c.peek() != "{" {
+		arg, err := c.nextToken()
+		if err != nil {
+			return err
+		}
+		m.args = append(m.args, arg.text)
+	}
+	m.body, err = c.block()
+	if err != nil {
+		return err
+	}
+	c.macros[name.text] = m
+	return nil
+}
+
+// expand replaces the invocation of a macro with its body.
+func (c *compiler) expand(m *macro) error {
+	c.expansions++
+	if c.expansions > MAX_EXPANSIONS {
+		return c.errorf("too many macro expansions, is a macro recursive?")
+	}
+
+	args := map[string]token{}
+	for _, name := range m.args {
+		t, err := c.nextToken()
+		if err != nil {
+			return err
+		}
+		args[name] = t
+	}
+
+	body := make([]token, 0, len(m.body))
+	for _, t := range m.body {
+		if a, ok := args[t.text]; ok && !t.str {
+			t = a
+		} else if t.text == "CALLS" {
+			t.text = strconv.Itoa(m.calls)
+		}
+		t.line = c.line
+		body = append(body, t)
+	}
+	m.calls++
+
+	c.toks = append(c.toks[:c.pos:c.pos], append(body, c.toks[c.pos:]...)...)
+	return nil
+}
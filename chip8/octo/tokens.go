@@ -0,0 +1,96 @@
+package octo
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+type token struct {
+	text string
+	line int
+	str  bool // a "string" literal, text is unquoted
+}
+
+// tokenize splits the source at white space, # starts a comment.
+func tokenize(src string) ([]token, error) {
+	var toks []token
+	line := 1
+	for i := 0; i < len(src); {
+		c := src[i]
+		switch {
+		case c == '\n':
+			line++
+			i++
+		case c == ' ' || c == '\t' || c == '\r':
+			i++
+		case c == '#':
+			for i < len(src) && src[i] != '\n' {
+				i++
+			}
+		case c == '"':
+			j := i + 1
+			for j < len(src) && src[j] != '"' {
+				if src[j] == '\\' {
+					j++
+				}
+				j++
+			}
+			if j >= len(src) {
+				return nil, fmt.Errorf("line %d: unterminated string", line)
+			}
+			text, err := strconv.Unquote(src[i : j+1])
+			if err != nil {
+				return nil, fmt.Errorf("line %d: bad string: %s", line, src[i:j+1])
+			}
+			toks = append(toks, token{text: text, line: line, str: true})
+			line += strings.Count(src[i:j+1], "\n")
+			i = j + 1
+		default:
+			j := i
+			for j < len(src) && !strings.ContainsRune(" \t\r\n", rune(src[j])) {
+				j++
+			}
+			toks = append(toks, token{text: src[i:j], line: line})
+			i = j
+		}
+	}
+	return toks, nil
+}
+
+// parseNumber parses decimal, 0x hex and 0b binary numbers with an optional sign.
+func parseNumber(s string) (float64, bool) {
+	neg := false
+	if strings.HasPrefix(s, "-") && len(s) > 1 {
+		neg, s = true, s[1:]
+	}
+
+	var v uint64
+	var err error
+	switch {
+	case strings.HasPrefix(s, "0x") || strings.HasPrefix(s, "0X"):
+		v, err = strconv.ParseUint(s[2:], 16, 32)
+	case strings.HasPrefix(s, "0b") || strings.HasPrefix(s, "0B"):
+		v, err = strconv.ParseUint(s[2:], 2, 32)
+	default:
+		if s == "" || s[0] < '0' || s[0] > '9' {
+			return 0, false
+		}
+		f, ferr := strconv.ParseFloat(s, 64)
+		if ferr != nil {
+			return 0, false
+		}
+		if neg {
+			f = -f
+		}
+		return f, true
+	}
+	if err != nil {
+		return 0, false
+	}
+
+	if neg {
+		return -float64(v), true
+	}
+	return float64(v), true
+}
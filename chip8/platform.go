@@ -0,0 +1,69 @@
+package chip8
+
+type Platform byte
+
+const (
+	PLATFORM_CHIP8 Platform = iota
+	PLATFORM_SCHIP          // SUPER-CHIP 1.1
+	PLATFORM_XOCHIP
+)
+
+var PLATFORMS map[string]Platform = map[string]Platform{
+	"chip8":  PLATFORM_CHIP8,
+	"schip":  PLATFORM_SCHIP,
+	"xochip": PLATFORM_XOCHIP,
+}
+
+func (p Platform) String() string {
+	for name, x := range PLATFORMS {
+		if x == p {
+			return name
+		}
+	}
+	return "unknown"
+}
+
+func (c *Cpu) SetPlatform(p Platform) {
+	c.platform = p
+	c.memory = make([]byte, p.MemorySize())
+	c.DMA(SPRITE_ADDR, SPRITES, uint16(len(SPRITES)))
+	c.DMA(BIG_SPRITE_ADDR, BIG_SPRITES, uint16(len(BIG_SPRITES)))
+	c.Reset()
+}
+
+func (p Platform) MemorySize() int {
+	if p == PLATFORM_XOCHIP {
+		return MEMORY_SIZE_XO
+	}
+	return MEMORY_SIZE
+}
+
+// DefaultQuirks returns the quirks the programs of the platform expect.
+func (p Platform) DefaultQuirks() Quirks {
+	switch p {
+	case PLATFORM_SCHIP:
+		return QUIRKS_SCHIP
+	case PLATFORM_XOCHIP:
+		return QUIRKS_XOCHIP
+	}
+	return QUIRKS_COSMAC_VIP
+}
+
+func (c *Cpu) Platform() Platform {
+	return c.platform
+}
+
+func (c *Cpu) schip() bool {
+	return c.platform >= PLATFORM_SCHIP
+}
+
+func (c *Cpu) xochip() bool {
+	return c.platform == PLATFORM_XOCHIP
+}
+
+func (c *Cpu) rplSize() byte {
+	if c.xochip() {
+		return RPL_SIZE
+	}
+	return RPL_SIZE_SCHIP
+}
@@ -0,0 +1,69 @@
+package chip8
+
+type LoadStore byte
+
+const (
+	LOAD_STORE_INC_X1 LoadStore = iota // I += x + 1 (COSMAC VIP)
+	LOAD_STORE_INC_X                   // I += x (CHIP-48)
+	LOAD_STORE_KEEP                    // I is left unchanged (SUPER-CHIP)
+)
+
+type Quirks struct {
+	VFReset     bool      // 8xy1/8xy2/8xy3 reset VF
+	Shift       bool      // 8xy6/8xyE shift Vx in place and ignore Vy
+	LoadStore   LoadStore // how Fx55/Fx65 change I
+	Jump        bool      // Bxnn jumps to xnn + Vx instead of nnn + V0
+	Clip        bool      // sprites are clipped at the screen edges instead of wrapping
+	DisplayWait bool      // Dxyn waits for the vertical blank
+}
+
+var QUIRKS_COSMAC_VIP Quirks = Quirks{
+	VFReset:     true,
+	Shift:       false,
+	LoadStore:   LOAD_STORE_INC_X1,
+	Jump:        false,
+	Clip:        true,
+	DisplayWait: true,
+}
+
+var QUIRKS_CHIP48 Quirks = Quirks{
+	VFReset:     false,
+	Shift:       true,
+	LoadStore:   LOAD_STORE_INC_X,
+	Jump:        true,
+	Clip:        true,
+	DisplayWait: false,
+}
+
+var QUIRKS_SCHIP Quirks = Quirks{
+	VFReset:     false,
+	Shift:       true,
+	LoadStore:   LOAD_STORE_KEEP,
+	Jump:        true,
+	Clip:        true,
+	DisplayWait: false,
+}
+
+var QUIRKS_XOCHIP Quirks = Quirks{
+	VFReset:     false,
+	Shift:       false,
+	LoadStore:   LOAD_STORE_INC_X1,
+	Jump:        false,
+	Clip:        false,
+	DisplayWait: false,
+}
+
+var QUIRK_PRESETS map[string]Quirks = map[string]Quirks{
+	"vip":    QUIRKS_COSMAC_VIP,
+	"chip48": QUIRKS_CHIP48,
+	"schip":  QUIRKS_SCHIP,
+	"xochip": QUIRKS_XOCHIP,
+}
+
+func (c *Cpu) SetQuirks(q Quirks) {
+	c.quirks = q
+}
+
+func (c *Cpu) Quirks() Quirks {
+	return c.quirks
+}
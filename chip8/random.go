@@ -0,0 +1,80 @@
+package chip8
+
+// RNG selects the random number generator of Cxkk.
+type RNG byte
+
+const (
+	RNG_XORSHIFT RNG = iota // xorshift64*, all 256 values
+	RNG_PAGE                // a 16-bit seed mixed with the bytes of a memory page
+)
+
+var RNGS map[string]RNG = map[string]RNG{
+	"xorshift": RNG_XORSHIFT,
+	"page":     RNG_PAGE,
+}
+
+// RANDOM_PAGE is the memory the page generator mixes into its seed, the fonts.
+const RANDOM_PAGE uint16 = 0x000
+
+// random is the state of the generator, it is part of the save states.
+type random struct {
+	Kind  RNG
+	State uint64
+}
+
+func (r RNG) String() string {
+	for name, x := range RNGS {
+		if x == r {
+			return name
+		}
+	}
+	return "unknown"
+}
+
+// SetRNG selects the generator, the seed is kept.
+func (c *Cpu) SetRNG(kind RNG) {
+	c.random.Kind = kind
+}
+
+func (c *Cpu) RNG() RNG {
+	return c.random.Kind
+}
+
+// Seed restarts the generator, the same seed gives the same numbers.
+func (c *Cpu) Seed(seed uint64) {
+	// splitmix64, so that small and zero seeds give a usable xorshift state
+	seed += 0x9e3779b97f4a7c15
+	seed = (seed ^ seed>>30) * 0xbf58476d1ce4e5b9
+	seed = (seed ^ seed>>27) * 0x94d049bb133111eb
+	seed ^= seed >> 31
+	if seed == 0 {
+		seed = 1
+	}
+	c.random.State = seed
+}
+
+// randomByte returns the next random number for Cxkk.
+func (c *Cpu) randomByte() byte {
+	if c.random.Kind == RNG_PAGE {
+		return c.pageRandom()
+	}
+
+	x := c.random.State
+	x ^= x >> 12
+	x ^= x << 25
+	x ^= x >> 27
+	c.random.State = x
+	return byte((x * 0x2545f4914f6cdd1d) >> 56)
+}
+
+// pageRandom keeps a 16-bit seed in the low bits of the state: the high byte
+// is incremented and picks a byte of RANDOM_PAGE, the sum of that byte and
+// both seed bytes rotated right is the new low byte and the result.
+func (c *Cpu) pageRandom() byte {
+	hi, lo := byte(c.random.State>>8), byte(c.random.State)
+	hi++
+	sum := lo + c.memory[RANDOM_PAGE|uint16(hi)] + hi
+	lo = sum>>1 | sum<<7
+	c.random.State = uint64(hi)<<8 | uint64(lo)
+	return lo
+}
@@ -0,0 +1,77 @@
+package chip8
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/ministergoose/chip8-emu-go/chip8/hardware/headless"
+)
+
+// a loop of RND V0, 0xFF
+var RANDOM_ROM []byte = []byte{0xC0, 0xFF, 0x12, 0x00}
+
+func newRandomCPU(t *testing.T, rng RNG, seed uint64) *Cpu {
+	c := NewCPU(headless.NewDisplayHeadless(), headless.NewKeyboardHeadless(), headless.NewSoundHeadless(), QUIRKS_COSMAC_VIP)
+	c.SetRNG(rng)
+	c.Seed(seed)
+	err := c.LoadROM(RANDOM_ROM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+// draw returns the next n numbers of RND.
+func draw(t *testing.T, c *Cpu, n int) []byte {
+	numbers := make([]byte, n)
+	for i := range numbers {
+		for j := 0; j < 2; j++ {
+			err := c.Step()
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		numbers[i] = c.Registers().V[0]
+	}
+	return numbers
+}
+
+func TestRandomSeed(t *testing.T) {
+	for name, rng := range RNGS {
+		a := draw(t, newRandomCPU(t, rng, 42), 1000)
+		b := draw(t, newRandomCPU(t, rng, 42), 1000)
+		if !bytes.Equal(a, b) {
+			t.Errorf("%s: the same seed gives different numbers", name)
+		}
+	}
+
+	seen := make(map[byte]bool)
+	for _, x := range draw(t, newRandomCPU(t, RNG_XORSHIFT, 0), 10000) {
+		seen[x] = true
+	}
+	if len(seen) != 256 {
+		t.Errorf("xorshift: %d of 256 values", len(seen))
+	}
+}
+
+func TestRandomState(t *testing.T) {
+	for name, rng := range RNGS {
+		c := newRandomCPU(t, rng, 7)
+		draw(t, c, 10)
+		var state bytes.Buffer
+		err := c.SaveState(&state)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := draw(t, c, 100)
+
+		c = newRandomCPU(t, RNG_XORSHIFT, 8)
+		err = c.LoadState(&state)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := draw(t, c, 100); !bytes.Equal(got, want) {
+			t.Errorf("%s: the save state does not restore the generator", name)
+		}
+	}
+}
@@ -0,0 +1,164 @@
+package chip8
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+type Reg byte
+
+const (
+	REG_V0 Reg = iota
+	REG_V1
+	REG_V2
+	REG_V3
+	REG_V4
+	REG_V5
+	REG_V6
+	REG_V7
+	REG_V8
+	REG_V9
+	REG_VA
+	REG_VB
+	REG_VC
+	REG_VD
+	REG_VE
+	REG_VF
+	REG_I
+	REG_PC
+	REG_SP
+	REG_DT
+	REG_ST
+	REG_COUNT
+)
+
+type Registers struct {
+	V  [16]byte
+	I  uint16
+	PC uint16
+	SP byte // stack index
+	DT byte
+	ST byte
+}
+
+func (r Reg) String() string {
+	switch {
+	case r <= REG_VF:
+		return fmt.Sprintf("V%X", byte(r))
+	case r == REG_I:
+		return "I"
+	case r == REG_PC:
+		return "PC"
+	case r == REG_SP:
+		return "SP"
+	case r == REG_DT:
+		return "DT"
+	case r == REG_ST:
+		return "ST"
+	}
+	return "?"
+}
+
+func ParseReg(s string) (Reg, error) {
+	for r := REG_V0; r < REG_COUNT; r++ {
+		if strings.EqualFold(s, r.String()) {
+			return r, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown register: %s", s)
+}
+
+func (r *Registers) Get(reg Reg) uint16 {
+	switch {
+	case reg <= REG_VF:
+		return uint16(r.V[reg])
+	case reg == REG_I:
+		return r.I
+	case reg == REG_PC:
+		return r.PC
+	case reg == REG_SP:
+		return uint16(r.SP)
+	case reg == REG_DT:
+		return uint16(r.DT)
+	case reg == REG_ST:
+		return uint16(r.ST)
+	}
+	return 0
+}
+
+func (r *Registers) Set(reg Reg, val uint16) {
+	switch {
+	case reg <= REG_VF:
+		r.V[reg] = byte(val)
+	case reg == REG_I:
+		r.I = val
+	case reg == REG_PC:
+		r.PC = val
+	case reg == REG_SP:
+		r.SP = byte(val)
+	case reg == REG_DT:
+		r.DT = byte(val)
+	case reg == REG_ST:
+		r.ST = byte(val)
+	}
+}
+
+func (c *Cpu) Registers() Registers {
+	_, index := c.stack.State()
+	return Registers{V: c.v, I: c.i, PC: c.cnt, SP: index, DT: c.timerDelay, ST: c.timerSound}
+}
+
+func (c *Cpu) SetRegisters(r Registers) error {
+	stack, index := c.stack.State()
+	if index != r.SP {
+		err := c.stack.Restore(stack, r.SP)
+		if err != nil {
+			return err
+		}
+	}
+
+	c.v = r.V
+	c.i = r.I
+	c.cnt = r.PC
+	c.timerDelay = r.DT
+	c.timerSound = r.ST
+
+	return nil
+}
+
+// CallStack returns the return addresses on the stack, the innermost last.
+func (c *Cpu) CallStack() []uint16 {
+	stack, index := c.stack.State()
+	if int(index) >= len(stack) {
+		return nil
+	}
+	return append([]uint16{}, stack[1:index+1]...)
+}
+
+func (c *Cpu) ReadMemory(addr uint16, length int) []byte {
+	res := make([]byte, 0, length)
+	for i := 0; i < length && int(addr)+i < len(c.memory); i++ {
+		res = append(res, c.memory[int(addr)+i])
+	}
+	return res
+}
+
+func (c *Cpu) WriteMemory(addr uint16, data []byte) error {
+	if int(addr)+len(data) > len(c.memory) {
+		return fmt.Errorf("bad address: %03x", int(addr)+len(data)-1)
+	}
+	copy(c.memory[addr:], data)
+	c.invalidate(addr, len(data))
+	return nil
+}
+
+func (c *Cpu) MemorySize() int {
+	return len(c.memory)
+}
+
+// ParseValue parses a decimal, 0x hex or 0b binary number.
+func ParseValue(s string) (uint16, error) {
+	v, err := strconv.ParseUint(s, 0, 16)
+	return uint16(v), err
+}
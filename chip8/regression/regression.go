@@ -0,0 +1,177 @@
+// Package regression runs ROMs headless for a number of frames with scripted
+// key input, the tests compare the last frame with golden images.
+package regression
+
+import (
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/png"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/ministergoose/chip8-emu-go/chip8"
+	"github.com/ministergoose/chip8-emu-go/chip8/hardware/headless"
+)
+
+// KeyEvent holds down Keys, e.g. "1" or "5a", from Frame on, "" releases all keys.
+type KeyEvent struct {
+	Frame int    `json:"frame"`
+	Keys  string `json:"keys"`
+}
+
+type Case struct {
+	Name     string     `json:"name"`
+	ROM      string     `json:"rom"`      // relative to the roms directory
+	Platform string     `json:"platform"` // chip8.PLATFORMS, chip8 when empty
+	Quirks   string     `json:"quirks"`   // chip8.QUIRK_PRESETS, the default quirks of the platform when empty
+	TickRate int        `json:"tickrate"` // instructions per frame, chip8.IPS / 60 when 0
+	Seed     uint64     `json:"seed"`     // of the random number generator
+	RNG      string     `json:"rng"`      // chip8.RNGS, xorshift when empty
+	Frames   int        `json:"frames"`
+	Keys     []KeyEvent `json:"keys"`
+}
+
+func LoadCases(filePath string) ([]Case, error) {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, err
+	}
+	var cases []Case
+	err = json.Unmarshal(data, &cases)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", filePath, err)
+	}
+	return cases, nil
+}
+
+func parseKeys(keys string) (uint16, error) {
+	var mask uint16
+	for _, k := range keys {
+		n, err := strconv.ParseUint(string(k), 16, 8)
+		if err != nil {
+			return 0, fmt.Errorf("bad key: %q", k)
+		}
+		mask |= 1 << n
+	}
+	return mask, nil
+}
+
+// Run runs the ROM of a case from romDir and returns the display after the last frame.
+func Run(c Case, romDir string) (*headless.DisplayHeadless, error) {
+	platform := chip8.PLATFORM_CHIP8
+	if c.Platform != "" {
+		p, ok := chip8.PLATFORMS[c.Platform]
+		if !ok {
+			return nil, fmt.Errorf("unknown platform: %s", c.Platform)
+		}
+		platform = p
+	}
+	quirks := platform.DefaultQuirks()
+	if c.Quirks != "" {
+		q, ok := chip8.QUIRK_PRESETS[c.Quirks]
+		if !ok {
+			return nil, fmt.Errorf("unknown quirks preset: %s", c.Quirks)
+		}
+		quirks = q
+	}
+	rng := chip8.RNG_XORSHIFT
+	if c.RNG != "" {
+		r, ok := chip8.RNGS[c.RNG]
+		if !ok {
+			return nil, fmt.Errorf("unknown random number generator: %s", c.RNG)
+		}
+		rng = r
+	}
+
+	dspl := headless.NewDisplayHeadless()
+	kbrd := headless.NewKeyboardHeadless()
+	cpu := chip8.NewCPU(dspl, kbrd, headless.NewSoundHeadless(), quirks)
+	cpu.SetPlatform(platform)
+	cpu.SetInterpreter(chip8.INTERPRETER_BLOCKS)
+	cpu.SetRNG(rng)
+	cpu.Seed(c.Seed)
+	if c.TickRate > 0 {
+		cpu.SetTickRate(c.TickRate)
+	}
+	err := cpu.Load(filepath.Join(romDir, c.ROM))
+	if err != nil {
+		return nil, err
+	}
+
+	for frame := 0; frame < c.Frames && !cpu.Halted(); frame++ {
+		for _, ev := range c.Keys {
+			if ev.Frame == frame {
+				keys, err := parseKeys(ev.Keys)
+				if err != nil {
+					return nil, err
+				}
+				kbrd.SetKeys(keys)
+			}
+		}
+		cpu.RunFrame()
+	}
+
+	return dspl, nil
+}
+
+func ReadImage(filePath string) (image.Image, error) {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return png.Decode(f)
+}
+
+func WriteImage(filePath string, img image.Image) error {
+	f, err := os.Create(filePath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	return png.Encode(f, img)
+}
+
+// Diff returns "" when the images are the same, otherwise a picture of both
+// in ASCII: '#' is set in both, '-' only in want, '+' only in got, '*' a different color.
+func Diff(want, got image.Image) string {
+	wb, gb := want.Bounds(), got.Bounds()
+	if wb.Size() != gb.Size() {
+		return fmt.Sprintf("size differs: want %dx%d, got %dx%d", wb.Dx(), wb.Dy(), gb.Dx(), gb.Dy())
+	}
+
+	var sb strings.Builder
+	diffs := 0
+	for y := 0; y < wb.Dy(); y++ {
+		for x := 0; x < wb.Dx(); x++ {
+			w := headless.PALETTE.Index(want.At(wb.Min.X+x, wb.Min.Y+y))
+			g := headless.PALETTE.Index(got.At(gb.Min.X+x, gb.Min.Y+y))
+			if w != g {
+				diffs++
+			}
+			switch {
+			case w == g && w == 0:
+				sb.WriteByte('.')
+			case w == g:
+				sb.WriteByte('#')
+			case g == 0:
+				sb.WriteByte('-')
+			case w == 0:
+				sb.WriteByte('+')
+			default:
+				sb.WriteByte('*')
+			}
+		}
+		sb.WriteByte('\n')
+	}
+
+	if diffs == 0 {
+		return ""
+	}
+	return fmt.Sprintf("%d pixels differ ('-' missing, '+' extra, '*' other color):\n%s", diffs, sb.String())
+}
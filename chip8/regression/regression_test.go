@@ -0,0 +1,57 @@
+package regression
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "write the golden images instead of comparing with them")
+
+const (
+	ROM_DIR    = "testdata/roms"
+	GOLDEN_DIR = "testdata/golden"
+)
+
+func TestGolden(t *testing.T) {
+	cases, err := LoadCases("testdata/cases.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, c := range cases {
+		c := c
+		t.Run(c.Name, func(t *testing.T) {
+			_, err := os.Stat(filepath.Join(ROM_DIR, c.ROM))
+			if os.IsNotExist(err) {
+				t.Skipf("%s is missing, see testdata/README.md", c.ROM)
+			}
+
+			dspl, err := Run(c, ROM_DIR)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			golden := filepath.Join(GOLDEN_DIR, c.Name+".png")
+			if *update {
+				err := WriteImage(golden, dspl.Image())
+				if err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+
+			want, err := ReadImage(golden)
+			if os.IsNotExist(err) {
+				t.Fatalf("%s is missing, run go test -update", golden)
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := Diff(want, dspl.Image()); diff != "" {
+				t.Errorf("%s after %d frames differs from %s\n%s", c.ROM, c.Frames, golden, diff)
+			}
+		})
+	}
+}
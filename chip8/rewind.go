@@ -0,0 +1,144 @@
+package chip8
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+)
+
+const REWIND_FRAMES = 30 * 60 // 30 seconds
+
+// Rewind is a ring buffer of the last frames of the machine. Every frame is stored
+// as the XOR of its save state with the next frame's one, run-length encoded,
+// so unchanged memory and pixels take a couple of bytes.
+type Rewind struct {
+	deltas [][]byte
+	head   int // index of the newest delta
+	count  int
+	last   []byte // save state of the newest frame
+}
+
+func NewRewind(frames int) *Rewind {
+	return &Rewind{deltas: make([][]byte, frames)}
+}
+
+func (r *Rewind) Len() int {
+	if r == nil {
+		return 0
+	}
+	return r.count
+}
+
+func (r *Rewind) Reset() {
+	for i := range r.deltas {
+		r.deltas[i] = nil
+	}
+	r.head, r.count, r.last = 0, 0, nil
+}
+
+func (r *Rewind) Capture(c *Cpu) error {
+	var buf bytes.Buffer
+	err := c.SaveState(&buf)
+	if err != nil {
+		return err
+	}
+	state := buf.Bytes()
+
+	if r.last != nil && len(r.last) == len(state) && len(r.deltas) > 0 {
+		r.head = (r.head + 1) % len(r.deltas)
+		r.deltas[r.head] = xorRLE(r.last, state)
+		if r.count < len(r.deltas) {
+			r.count++
+		}
+	} else {
+		// the machine layout changed, older frames can't be restored
+		r.Reset()
+	}
+	r.last = state
+
+	return nil
+}
+
+// Back restores the frame before the newest one and drops the newest one,
+// a nil Rewind has no frames.
+func (r *Rewind) Back(c *Cpu) (bool, error) {
+	if r == nil || r.count == 0 {
+		return false, nil
+	}
+
+	prev, err := unxorRLE(r.last, r.deltas[r.head])
+	if err != nil {
+		return false, err
+	}
+	err = c.LoadState(bytes.NewReader(prev))
+	if err != nil {
+		return false, err
+	}
+
+	r.deltas[r.head] = nil
+	r.head = (r.head + len(r.deltas) - 1) % len(r.deltas)
+	r.count--
+	r.last = prev
+
+	return true, nil
+}
+
+/*
+   Delta encoding: (zero run uvarint, literal length uvarint, literal bytes)*
+   of a XOR b, where a and b have the same length.
+*/
+
+func xorRLE(a, b []byte) []byte {
+	var res []byte
+	tmp := make([]byte, binary.MaxVarintLen64)
+
+	for i := 0; i < len(a); {
+		zeros := i
+		for i < len(a) && a[i] == b[i] {
+			i++
+		}
+		zeros = i - zeros
+
+		lit := i
+		for i < len(a) && a[i] != b[i] {
+			i++
+		}
+
+		res = append(res, tmp[:binary.PutUvarint(tmp, uint64(zeros))]...)
+		res = append(res, tmp[:binary.PutUvarint(tmp, uint64(i-lit))]...)
+		for j := lit; j < i; j++ {
+			res = append(res, a[j]^b[j])
+		}
+	}
+
+	return res
+}
+
+func unxorRLE(b, delta []byte) ([]byte, error) {
+	res := append([]byte{}, b...)
+	r := bytes.NewReader(delta)
+
+	pos := 0
+	for r.Len() > 0 {
+		zeros, err := binary.ReadUvarint(r)
+		if err != nil {
+			return nil, err
+		}
+		lit, err := binary.ReadUvarint(r)
+		if err != nil {
+			return nil, err
+		}
+
+		pos += int(zeros)
+		if pos+int(lit) > len(res) {
+			return nil, fmt.Errorf("bad rewind delta")
+		}
+		for j := 0; j < int(lit); j++ {
+			x, _ := r.ReadByte()
+			res[pos] ^= x
+			pos++
+		}
+	}
+
+	return res, nil
+}
@@ -0,0 +1,209 @@
+// Package romdb looks up the settings of known ROMs by their SHA-1, in the
+// format of the CHIP-8 community database (https://github.com/chip-8/chip-8-database)
+// and in a user file that overrides it.
+package romdb
+
+import (
+	"crypto/sha1"
+	_ "embed"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/ministergoose/chip8-emu-go/chip8/config"
+)
+
+// PROGRAMS is programs.json of the community database, go generate downloads
+// the latest one over the file. Until then it is empty and only the user file
+// knows ROMs.
+//
+//go:generate curl -fsSL -o programs.json https://raw.githubusercontent.com/chip-8/chip-8-database/master/database/programs.json
+//go:embed programs.json
+var PROGRAMS []byte
+
+const USER_FILE = "roms.json"
+
+// the platform IDs of the database
+const (
+	ORIGINAL_CHIP8 = "originalChip8"
+	HYBRID_VIP     = "hybridVIP"
+	MODERN_CHIP8   = "modernChip8"
+	CHIP48         = "chip48"
+	SUPERCHIP1     = "superchip1"
+	SUPERCHIP      = "superchip"
+	MEGACHIP8      = "megachip8"
+	XOCHIP         = "xochip"
+)
+
+// KEYS are the names of the game keys in Rom.Keys.
+var KEYS []string = []string{
+	"up", "down", "left", "right", "a", "b",
+	"player2Up", "player2Down", "player2Left", "player2Right", "player2A", "player2B",
+}
+
+type Program struct {
+	Title       string         `json:"title"`
+	Description string         `json:"description,omitempty"`
+	Release     string         `json:"release,omitempty"`
+	Authors     []string       `json:"authors,omitempty"`
+	Roms        map[string]Rom `json:"roms"`
+}
+
+// Rom is the settings of one ROM. Title is only stored in the user file, the
+// database has it in the Program.
+type Rom struct {
+	Title           string            `json:"title,omitempty"`
+	File            string            `json:"file,omitempty"`
+	Platforms       []string          `json:"platforms"`
+	TickRate        int               `json:"tickrate,omitempty"`
+	QuirkyPlatforms map[string]Quirks `json:"quirkyPlatforms,omitempty"`
+	Colors          *Colors           `json:"colors,omitempty"`
+	Keys            map[string]byte   `json:"keys,omitempty"`
+}
+
+// Quirks are the quirks of a platform that a ROM needs changed, nil keeps the platform's.
+type Quirks struct {
+	Shift                 *bool `json:"shift,omitempty"`
+	MemoryIncrementByX    *bool `json:"memoryIncrementByX,omitempty"`
+	MemoryLeaveIUnchanged *bool `json:"memoryLeaveIUnchanged,omitempty"`
+	Wrap                  *bool `json:"wrap,omitempty"`
+	Jump                  *bool `json:"jump,omitempty"`
+	VBlank                *bool `json:"vblank,omitempty"`
+	Logic                 *bool `json:"logic,omitempty"`
+}
+
+type Colors struct {
+	Pixels  []string `json:"pixels,omitempty"` // background, plane 1, plane 2, both planes
+	Buzzer  string   `json:"buzzer,omitempty"`
+	Silence string   `json:"silence,omitempty"`
+}
+
+// Entry is a ROM with its hash, User tells if it comes from the user file.
+type Entry struct {
+	Hash string
+	Rom
+	User bool
+}
+
+type Database struct {
+	roms     map[string]Rom // of the community database, by hex SHA-1
+	user     map[string]Rom
+	userPath string
+}
+
+// UserPath returns the default path of the user file, in the config directory.
+func UserPath() (string, error) {
+	dir, err := config.Dir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, USER_FILE), nil
+}
+
+// Open reads the embedded database and the user file, which may not exist yet.
+func Open(userPath string) (*Database, error) {
+	var programs []Program
+	err := json.Unmarshal(PROGRAMS, &programs)
+	if err != nil {
+		return nil, fmt.Errorf("bad ROM database: %v", err)
+	}
+
+	db := &Database{roms: make(map[string]Rom), user: make(map[string]Rom), userPath: userPath}
+	for _, p := range programs {
+		for hash, rom := range p.Roms {
+			rom.Title = p.Title
+			db.roms[strings.ToLower(hash)] = rom
+		}
+	}
+
+	if userPath == "" {
+		return db, nil
+	}
+	data, err := os.ReadFile(userPath)
+	if os.IsNotExist(err) {
+		return db, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var user map[string]Rom
+	err = json.Unmarshal(data, &user)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", userPath, err)
+	}
+	for hash, rom := range user {
+		db.user[strings.ToLower(hash)] = rom
+	}
+
+	return db, nil
+}
+
+// Hash returns the key of a ROM.
+func Hash(rom []byte) string {
+	sum := sha1.Sum(rom)
+	return hex.EncodeToString(sum[:])
+}
+
+// Lookup returns the settings of a ROM by its hex SHA-1, the user file first.
+func (db *Database) Lookup(hash string) (Entry, bool) {
+	hash = strings.ToLower(hash)
+	if rom, ok := db.user[hash]; ok {
+		return Entry{Hash: hash, Rom: rom, User: true}, true
+	}
+	if rom, ok := db.roms[hash]; ok {
+		return Entry{Hash: hash, Rom: rom}, true
+	}
+	return Entry{}, false
+}
+
+// Entries returns all ROMs ordered by title, the user file's replace the database's.
+func (db *Database) Entries() []Entry {
+	var entries []Entry
+	for hash := range db.roms {
+		if _, ok := db.user[hash]; !ok {
+			entries = append(entries, Entry{Hash: hash, Rom: db.roms[hash]})
+		}
+	}
+	for hash, rom := range db.user {
+		entries = append(entries, Entry{Hash: hash, Rom: rom, User: true})
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].Title != entries[j].Title {
+			return entries[i].Title < entries[j].Title
+		}
+		return entries[i].Hash < entries[j].Hash
+	})
+	return entries
+}
+
+// Set stores the settings of a ROM in the user file, Save writes it.
+func (db *Database) Set(hash string, rom Rom) {
+	db.user[strings.ToLower(hash)] = rom
+}
+
+// Delete removes a ROM from the user file, the database's settings apply again.
+func (db *Database) Delete(hash string) bool {
+	hash = strings.ToLower(hash)
+	_, ok := db.user[hash]
+	delete(db.user, hash)
+	return ok
+}
+
+func (db *Database) Save() error {
+	if db.userPath == "" {
+		return fmt.Errorf("no user file")
+	}
+	data, err := json.MarshalIndent(db.user, "", "    ")
+	if err != nil {
+		return err
+	}
+	err = os.MkdirAll(filepath.Dir(db.userPath), 0755)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(db.userPath, append(data, '\n'), 0644)
+}
@@ -0,0 +1,60 @@
+package romdb_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ministergoose/chip8-emu-go/chip8"
+	"github.com/ministergoose/chip8-emu-go/chip8/romdb"
+)
+
+// CLS; JP 0x202, a ROM of testdata/programs.json
+var ROM []byte = []byte{0x00, 0xE0, 0x12, 0x02}
+
+func TestLookup(t *testing.T) {
+	programs, err := os.ReadFile(filepath.Join("testdata", "programs.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	embedded := romdb.PROGRAMS
+	romdb.PROGRAMS = programs
+	defer func() { romdb.PROGRAMS = embedded }()
+
+	db, err := romdb.Open("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := len(db.Entries()); n != 2 {
+		t.Fatalf("%d entries, want 2", n)
+	}
+	entry, ok := db.Lookup(romdb.Hash(ROM))
+	if !ok {
+		t.Fatalf("%s is not in the database", romdb.Hash(ROM))
+	}
+	if entry.Title != "Clear" || entry.User || entry.Keys["a"] != 6 {
+		t.Errorf("got %+v", entry)
+	}
+
+	p, id, q, err := chip8.RomPlatform(entry.Rom)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := chip8.QUIRKS_SCHIP
+	want.Shift, want.LoadStore = false, chip8.LOAD_STORE_INC_X1
+	if p != chip8.PLATFORM_SCHIP || id != romdb.SUPERCHIP || q != want || entry.TickRate != 30 {
+		t.Errorf("got %s %s %+v at %d, want schip superchip %+v at 30", p, id, q, entry.TickRate, want)
+	}
+
+	palette, ok, err := chip8.RomPalette(entry.Rom)
+	if err != nil || !ok || palette[1].R != 0xFF || palette[1].G != 0 {
+		t.Errorf("palette %v %v %v", palette, ok, err)
+	}
+}
+
+func TestEmbedded(t *testing.T) {
+	_, err := romdb.Open("")
+	if err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,158 @@
+package chip8
+
+import (
+	"fmt"
+	"image/color"
+	"log"
+	"strings"
+
+	"github.com/ministergoose/chip8-emu-go/chip8/octo"
+	"github.com/ministergoose/chip8-emu-go/chip8/romdb"
+)
+
+// ROMDB_PLATFORMS are the platforms of the ROM database that run here.
+var ROMDB_PLATFORMS map[string]Platform = map[string]Platform{
+	romdb.ORIGINAL_CHIP8: PLATFORM_CHIP8,
+	romdb.HYBRID_VIP:     PLATFORM_CHIP8,
+	romdb.MODERN_CHIP8:   PLATFORM_CHIP8,
+	romdb.CHIP48:         PLATFORM_CHIP8,
+	romdb.SUPERCHIP1:     PLATFORM_SCHIP,
+	romdb.SUPERCHIP:      PLATFORM_SCHIP,
+	romdb.XOCHIP:         PLATFORM_XOCHIP,
+}
+
+// ROMDB_QUIRKS are the quirks of the database platforms before the ROM's changes.
+var ROMDB_QUIRKS map[string]Quirks = map[string]Quirks{
+	romdb.ORIGINAL_CHIP8: QUIRKS_COSMAC_VIP,
+	romdb.HYBRID_VIP:     QUIRKS_COSMAC_VIP,
+	romdb.MODERN_CHIP8:   {LoadStore: LOAD_STORE_INC_X1, Clip: true},
+	romdb.CHIP48:         QUIRKS_CHIP48,
+	romdb.SUPERCHIP1:     QUIRKS_SCHIP,
+	romdb.SUPERCHIP:      QUIRKS_SCHIP,
+	romdb.XOCHIP:         QUIRKS_XOCHIP,
+}
+
+// keyLayoutKeyboard is a keyboard that maps game keys, e.g. arrows, to CHIP-8 keys
+type keyLayoutKeyboard interface {
+	SetGameKeys(keys map[string]byte)
+}
+
+// RomPlatform returns the first platform of a database entry that runs here,
+// its database ID and the quirks the ROM needs on it.
+func RomPlatform(rom romdb.Rom) (Platform, string, Quirks, error) {
+	for _, id := range rom.Platforms {
+		p, ok := ROMDB_PLATFORMS[id]
+		if !ok {
+			continue
+		}
+
+		q := ROMDB_QUIRKS[id]
+		if changes, ok := rom.QuirkyPlatforms[id]; ok {
+			q = applyRomQuirks(q, changes)
+		}
+		return p, id, q, nil
+	}
+	return PLATFORM_CHIP8, "", QUIRKS_COSMAC_VIP, fmt.Errorf("no supported platform in %v", rom.Platforms)
+}
+
+func applyRomQuirks(q Quirks, changes romdb.Quirks) Quirks {
+	set := func(dst *bool, src *bool, invert bool) {
+		if src != nil {
+			*dst = *src != invert
+		}
+	}
+	set(&q.Shift, changes.Shift, false)
+	set(&q.Jump, changes.Jump, false)
+	set(&q.Clip, changes.Wrap, true)
+	set(&q.DisplayWait, changes.VBlank, false)
+	set(&q.VFReset, changes.Logic, false)
+	// a false flag turns its mode back to the COSMAC VIP's
+	setLoadStore := func(src *bool, mode LoadStore) {
+		if src != nil && *src {
+			q.LoadStore = mode
+		} else if src != nil && q.LoadStore == mode {
+			q.LoadStore = LOAD_STORE_INC_X1
+		}
+	}
+	setLoadStore(changes.MemoryIncrementByX, LOAD_STORE_INC_X)
+	setLoadStore(changes.MemoryLeaveIUnchanged, LOAD_STORE_KEEP)
+	return q
+}
+
+// RomQuirks returns q as the quirk changes of a database entry, all of them set.
+func RomQuirks(q Quirks) romdb.Quirks {
+	flag := func(b bool) *bool {
+		return &b
+	}
+	return romdb.Quirks{
+		Shift:                 flag(q.Shift),
+		MemoryIncrementByX:    flag(q.LoadStore == LOAD_STORE_INC_X),
+		MemoryLeaveIUnchanged: flag(q.LoadStore == LOAD_STORE_KEEP),
+		Wrap:                  flag(!q.Clip),
+		Jump:                  flag(q.Jump),
+		VBlank:                flag(q.DisplayWait),
+		Logic:                 flag(q.VFReset),
+	}
+}
+
+// RomPalette returns the colors of a database entry, the missing ones are Octo's.
+func RomPalette(rom romdb.Rom) ([4]color.RGBA, bool, error) {
+	palette, err := octo.DEFAULT_OPTIONS.Palette()
+	if err != nil || rom.Colors == nil || len(rom.Colors.Pixels) == 0 {
+		return palette, false, err
+	}
+	palette, err = ParsePalette(rom.Colors.Pixels, palette)
+	return palette, err == nil, err
+}
+
+// ParsePalette returns the background, plane 1, plane 2 and both planes colors
+// given as #RRGGBB, the missing ones are base's.
+func ParsePalette(colors []string, base [4]color.RGBA) ([4]color.RGBA, error) {
+	if len(colors) > len(base) {
+		return base, fmt.Errorf("%d colors, at most %d", len(colors), len(base))
+	}
+	for i, s := range colors {
+		c, err := octo.ParseColor(strings.TrimSpace(s))
+		if err != nil {
+			return base, err
+		}
+		base[i] = c
+	}
+	return base, nil
+}
+
+// applyRomDB sets the platform, quirks, tick rate, colors and keys of a ROM
+// known to the database.
+func (c *Cpu) applyRomDB(data []byte) {
+	entry, ok := c.RomDB.Lookup(romdb.Hash(data))
+	if !ok {
+		return
+	}
+
+	p, _, q, err := RomPlatform(entry.Rom)
+	if err != nil {
+		log.Printf("%s: %v", entry.Title, err)
+		return
+	}
+	c.SetPlatform(p)
+	c.SetQuirks(q)
+	if entry.TickRate > 0 {
+		c.SetTickRate(entry.TickRate)
+	}
+
+	if d, ok := c.display.(paletteDisplay); ok {
+		palette, ok, err := RomPalette(entry.Rom)
+		if err != nil {
+			log.Printf("%s: %v", entry.Title, err)
+		} else if ok {
+			d.SetPalette(palette)
+		}
+	}
+	if k, ok := c.keyboard.(keyLayoutKeyboard); ok && len(entry.Keys) > 0 {
+		k.SetGameKeys(entry.Keys)
+	}
+
+	if c.Debug {
+		fmt.Printf("ROM database: %s, %s\n", entry.Title, p)
+	}
+}
@@ -0,0 +1,87 @@
+package chip8
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ministergoose/chip8-emu-go/chip8/hardware/headless"
+	"github.com/ministergoose/chip8-emu-go/chip8/romdb"
+)
+
+func TestRomPlatform(t *testing.T) {
+	wrap, logic := true, true
+	rom := romdb.Rom{
+		Platforms:       []string{romdb.MEGACHIP8, romdb.SUPERCHIP, romdb.XOCHIP},
+		QuirkyPlatforms: map[string]romdb.Quirks{romdb.SUPERCHIP: {Wrap: &wrap, Logic: &logic}},
+	}
+	p, id, q, err := RomPlatform(rom)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := QUIRKS_SCHIP
+	want.Clip, want.VFReset = false, true
+	if p != PLATFORM_SCHIP || id != romdb.SUPERCHIP || q != want {
+		t.Errorf("got %s %s %+v, want schip superchip %+v", p, id, q, want)
+	}
+
+	_, _, _, err = RomPlatform(romdb.Rom{Platforms: []string{romdb.MEGACHIP8}})
+	if err == nil {
+		t.Error("megachip8 is not supported")
+	}
+
+	// VIP quirks on a platform that keeps I
+	vip := RomQuirks(QUIRKS_COSMAC_VIP)
+	_, _, q, err = RomPlatform(romdb.Rom{
+		Platforms:       []string{romdb.SUPERCHIP},
+		QuirkyPlatforms: map[string]romdb.Quirks{romdb.SUPERCHIP: vip},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if q != QUIRKS_COSMAC_VIP {
+		t.Errorf("got %+v, want the VIP quirks %+v", q, QUIRKS_COSMAC_VIP)
+	}
+
+	for base, from := range QUIRK_PRESETS {
+		for name, q := range QUIRK_PRESETS {
+			got := applyRomQuirks(from, RomQuirks(q))
+			if got != q {
+				t.Errorf("%s over %s: got %+v back", name, base, got)
+			}
+		}
+	}
+}
+
+func TestLoadRomDB(t *testing.T) {
+	dir := t.TempDir()
+	romPath := filepath.Join(dir, "game.ch8")
+	err := os.WriteFile(romPath, BENCH_ROM, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	db, err := romdb.Open(filepath.Join(dir, romdb.USER_FILE))
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.Set(romdb.Hash(BENCH_ROM), romdb.Rom{Title: "bench", Platforms: []string{romdb.XOCHIP}, TickRate: 1000})
+	err = db.Save()
+	if err != nil {
+		t.Fatal(err)
+	}
+	db, err = romdb.Open(filepath.Join(dir, romdb.USER_FILE))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := NewCPU(headless.NewDisplayHeadless(), headless.NewKeyboardHeadless(), headless.NewSoundHeadless(), QUIRKS_COSMAC_VIP)
+	c.RomDB = db
+	err = c.Load(romPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Platform() != PLATFORM_XOCHIP || c.Quirks() != QUIRKS_XOCHIP || c.TickRate() != 1000 {
+		t.Errorf("got %s %+v %d", c.Platform(), c.Quirks(), c.TickRate())
+	}
+}
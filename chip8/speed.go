@@ -0,0 +1,76 @@
+package chip8
+
+import "time"
+
+const (
+	FRAME_TIME          = time.Millisecond * 16
+	FAST_FORWARD_FRAMES = 8 // frames per frame while fast forwarding
+)
+
+// speed is how Run paces the frames. Every emulated frame runs the same
+// instructions and ticks the timers once, only the real time between them changes.
+type speed struct {
+	fastForward int  // frames emulated per drawn frame, 0 or 1 is real time
+	uncapped    bool // emulate frames until the next one is drawn
+	paused      bool
+	advance     bool // run one frame while paused
+	frames      int  // emulated frames
+}
+
+// SetFastForward makes Run emulate n frames for every drawn one, n <= 1 is real time.
+func (c *Cpu) SetFastForward(n int) {
+	c.speed.fastForward = n
+}
+
+func (c *Cpu) FastForward() int {
+	if c.speed.fastForward < 1 {
+		return 1
+	}
+	return c.speed.fastForward
+}
+
+// SetUncapped makes Run emulate as many frames as the host allows, it still draws in real time.
+func (c *Cpu) SetUncapped(uncapped bool) {
+	c.speed.uncapped = uncapped
+}
+
+func (c *Cpu) Uncapped() bool {
+	return c.speed.uncapped
+}
+
+// SetPaused stops or continues the emulation in Run, the window stays open.
+func (c *Cpu) SetPaused(paused bool) {
+	c.speed.paused = paused
+	c.speed.advance = false
+}
+
+func (c *Cpu) Paused() bool {
+	return c.speed.paused
+}
+
+// AdvanceFrame pauses Run after the next frame.
+func (c *Cpu) AdvanceFrame() {
+	c.speed.paused = true
+	c.speed.advance = true
+}
+
+// Frames returns the number of emulated frames.
+func (c *Cpu) Frames() int {
+	return c.speed.frames
+}
+
+// runFrames emulates the frames of one drawn frame, started at start.
+func (c *Cpu) runFrames(start time.Time) {
+	frames, uncapped := c.FastForward(), c.speed.uncapped
+	if c.speed.advance {
+		frames, uncapped = 1, false
+		c.speed.advance = false
+	}
+
+	for i := 0; !c.halted && (i < frames || uncapped && time.Since(start) < FRAME_TIME); i++ {
+		if d := c.attached(); d != nil && d.Paused() {
+			break
+		}
+		c.emulateFrame()
+	}
+}
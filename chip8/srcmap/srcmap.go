@@ -0,0 +1,158 @@
+// Package srcmap maps ROM addresses to source lines and labels.
+//
+// The format is line based, the first two fields of a line are used and the
+// rest is ignored, so assembler listings can be read as source maps:
+//
+//	; comment
+//	0200 game.8o:12 [anything]
+//	@main 0200
+package srcmap
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+type Line struct {
+	Addr uint16
+	File string
+	Line int
+}
+
+type SourceMap struct {
+	Lines  []Line // sorted by address
+	Labels map[string]uint16
+}
+
+func New() *SourceMap {
+	return &SourceMap{Labels: map[string]uint16{}}
+}
+
+func (m *SourceMap) AddLine(addr uint16, file string, line int) {
+	m.Lines = append(m.Lines, Line{Addr: addr, File: file, Line: line})
+}
+
+func (m *SourceMap) AddLabel(name string, addr uint16) {
+	m.Labels[name] = addr
+}
+
+func Parse(r io.Reader) (*SourceMap, error) {
+	m := New()
+	sc := bufio.NewScanner(r)
+	n := 0
+	for sc.Scan() {
+		n++
+		fields := strings.Fields(sc.Text())
+		if len(fields) < 2 || strings.HasPrefix(fields[0], ";") || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+
+		if strings.HasPrefix(fields[0], "@") {
+			addr, err := strconv.ParseUint(fields[1], 16, 16)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: bad address: %s", n, fields[1])
+			}
+			m.AddLabel(fields[0][1:], uint16(addr))
+			continue
+		}
+
+		addr, err := strconv.ParseUint(fields[0], 16, 16)
+		if err != nil {
+			// not a source map line, e.g. a listing header
+			continue
+		}
+		i := strings.LastIndex(fields[1], ":")
+		if i < 0 {
+			continue
+		}
+		line, err := strconv.Atoi(fields[1][i+1:])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: bad source line: %s", n, fields[1])
+		}
+		m.AddLine(uint16(addr), fields[1][:i], line)
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+
+	m.sort()
+	return m, nil
+}
+
+func Load(filePath string) (*SourceMap, error) {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return Parse(f)
+}
+
+func (m *SourceMap) sort() {
+	sort.SliceStable(m.Lines, func(i, j int) bool { return m.Lines[i].Addr < m.Lines[j].Addr })
+}
+
+func (m *SourceMap) Write(w io.Writer) error {
+	m.sort()
+	bw := bufio.NewWriter(w)
+	for _, l := range m.Lines {
+		fmt.Fprintf(bw, "%04X %s:%d\n", l.Addr, l.File, l.Line)
+	}
+
+	names := make([]string, 0, len(m.Labels))
+	for name := range m.Labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(bw, "@%s %04X\n", name, m.Labels[name])
+	}
+
+	return bw.Flush()
+}
+
+func sameFile(a, b string) bool {
+	if a == b {
+		return true
+	}
+	return filepath.Base(a) == filepath.Base(b)
+}
+
+// Addrs returns the addresses generated by a source line.
+func (m *SourceMap) Addrs(file string, line int) []uint16 {
+	var res []uint16
+	for _, l := range m.Lines {
+		if l.Line == line && sameFile(l.File, file) {
+			res = append(res, l.Addr)
+		}
+	}
+	return res
+}
+
+// Lookup returns the source line of the closest address at or below addr.
+func (m *SourceMap) Lookup(addr uint16) (Line, bool) {
+	i := sort.Search(len(m.Lines), func(i int) bool { return m.Lines[i].Addr > addr })
+	if i == 0 {
+		return Line{}, false
+	}
+	return m.Lines[i-1], true
+}
+
+// Symbol returns the closest label at or below addr.
+func (m *SourceMap) Symbol(addr uint16) (string, bool) {
+	best, found := "", false
+	var bestAddr uint16
+	for name, a := range m.Labels {
+		if a <= addr && (!found || a > bestAddr || (a == bestAddr && name < best)) {
+			best, bestAddr, found = name, a, true
+		}
+	}
+	return best, found
+}
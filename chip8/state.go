@@ -0,0 +1,201 @@
+package chip8
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/ministergoose/chip8-emu-go/chip8/hardware"
+)
+
+const (
+	STATE_MAGIC   = "C8ST"
+	STATE_VERSION = 2
+)
+
+/*
+   Save state layout, big endian:
+   stateHeader | stateRegs | memory | framebuffer (hardware.FRAMEBUFFER_STATE_SIZE) | random
+
+   Version 1 states have no random part, they keep the generator as it is.
+*/
+
+type stateHeader struct {
+	Magic    [4]byte
+	Version  uint16
+	Platform Platform
+	RomHash  [sha1.Size]byte
+	MemSize  uint32
+}
+
+type stateRegs struct {
+	V          [16]byte
+	I          uint16
+	Cnt        uint16
+	Stack      [STACK_SIZE]uint16
+	StackIndex byte
+	TimerDelay byte
+	TimerSound byte
+	Kbrd       uint16
+	Halted     bool
+	Rpl        [RPL_SIZE]byte
+	Planes     byte
+	HasPattern bool
+	Pattern    [hardware.PATTERN_SIZE]byte
+	Pitch      byte
+}
+
+func (c *Cpu) SaveState(w io.Writer) error {
+	hdr := stateHeader{Version: STATE_VERSION, Platform: c.platform, RomHash: c.romHash, MemSize: uint32(len(c.memory))}
+	copy(hdr.Magic[:], STATE_MAGIC)
+
+	regs := stateRegs{
+		V:          c.v,
+		I:          c.i,
+		Cnt:        c.cnt,
+		TimerDelay: c.timerDelay,
+		TimerSound: c.timerSound,
+		Kbrd:       c.kbrd,
+		Halted:     c.halted,
+		Rpl:        c.rpl,
+		Planes:     c.planes,
+		Pitch:      c.audioPitch,
+	}
+	stack, index := c.stack.State()
+	copy(regs.Stack[:], stack)
+	regs.StackIndex = index
+	if c.audioPattern != nil {
+		regs.HasPattern = true
+		regs.Pattern = *c.audioPattern
+	}
+
+	fb := hardware.NewFramebuffer()
+	if c.display.Buffer() != nil {
+		fb = c.display.Buffer()
+	}
+	pixels, err := fb.MarshalBinary()
+	if err != nil {
+		return err
+	}
+
+	for _, x := range []interface{}{hdr, regs, c.memory, pixels, c.random} {
+		err = binary.Write(w, binary.BigEndian, x)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (c *Cpu) LoadState(r io.Reader) error {
+	var hdr stateHeader
+	err := binary.Read(r, binary.BigEndian, &hdr)
+	if err != nil {
+		return err
+	}
+
+	if string(hdr.Magic[:]) != STATE_MAGIC {
+		return fmt.Errorf("not a save state")
+	}
+	if hdr.Version < 1 || hdr.Version > STATE_VERSION {
+		return fmt.Errorf("unsupported save state version: %d", hdr.Version)
+	}
+	if hdr.Platform.String() == "unknown" {
+		return fmt.Errorf("unknown platform: %d", hdr.Platform)
+	}
+	if hdr.RomHash != c.romHash {
+		return fmt.Errorf("save state belongs to another ROM: %x", hdr.RomHash)
+	}
+	if int(hdr.MemSize) != hdr.Platform.MemorySize() {
+		return fmt.Errorf("bad memory size: %d", hdr.MemSize)
+	}
+
+	var regs stateRegs
+	err = binary.Read(r, binary.BigEndian, &regs)
+	if err != nil {
+		return err
+	}
+
+	memory := make([]byte, hdr.MemSize)
+	_, err = io.ReadFull(r, memory)
+	if err != nil {
+		return err
+	}
+
+	pixels := make([]byte, hardware.FRAMEBUFFER_STATE_SIZE)
+	_, err = io.ReadFull(r, pixels)
+	if err != nil {
+		return err
+	}
+
+	rnd := c.random
+	if hdr.Version >= 2 {
+		err = binary.Read(r, binary.BigEndian, &rnd)
+		if err != nil {
+			return err
+		}
+	}
+
+	fb := hardware.NewFramebuffer()
+	err = fb.UnmarshalBinary(pixels)
+	if err != nil {
+		return err
+	}
+
+	err = c.stack.Restore(regs.Stack[:], regs.StackIndex)
+	if err != nil {
+		return err
+	}
+	if c.display.Buffer() != nil {
+		*c.display.Buffer() = *fb
+	}
+
+	c.platform = hdr.Platform
+	c.memory = memory
+	c.flushBlocks()
+	c.random = rnd
+	c.v = regs.V
+	c.i = regs.I
+	c.cnt = regs.Cnt
+	c.timerDelay = regs.TimerDelay
+	c.timerSound = regs.TimerSound
+	c.kbrd = regs.Kbrd
+	c.halted = regs.Halted
+	c.rpl = regs.Rpl
+	c.planes = regs.Planes
+	c.display.SetPlanes(c.planes)
+	c.audioPitch = regs.Pitch
+	c.sound.SetPitch(c.audioPitch)
+	c.audioPattern = nil
+	if regs.HasPattern {
+		pattern := regs.Pattern
+		c.audioPattern = &pattern
+		c.sound.SetPattern(pattern)
+	}
+
+	return nil
+}
+
+func (c *Cpu) SaveStateFile(filePath string) error {
+	var buf bytes.Buffer
+	err := c.SaveState(&buf)
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(filePath, buf.Bytes(), 0644)
+}
+
+func (c *Cpu) LoadStateFile(filePath string) error {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	return c.LoadState(f)
+}
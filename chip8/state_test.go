@@ -0,0 +1,53 @@
+package chip8
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/ministergoose/chip8-emu-go/chip8/hardware/headless"
+)
+
+func TestLoadStateErrors(t *testing.T) {
+	c := NewCPU(headless.NewDisplayHeadless(), headless.NewKeyboardHeadless(), headless.NewSoundHeadless(), QUIRKS_CHIP48)
+	err := c.LoadROM(BENCH_ROM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.RunFrame()
+	var buf bytes.Buffer
+	err = c.SaveState(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	state := buf.Bytes()
+	hash, err := c.StateHash()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the platform byte follows the magic and the version
+	platform := append([]byte(nil), state...)
+	platform[6] = 0x7F
+	rom := append([]byte(nil), state...)
+	rom[7] ^= 0xFF
+
+	for name, data := range map[string][]byte{
+		"magic":     append([]byte("C8SU"), state[4:]...),
+		"platform":  platform,
+		"rom":       rom,
+		"truncated": state[:len(state)-1],
+	} {
+		err := c.LoadState(bytes.NewReader(data))
+		if err == nil {
+			t.Errorf("%s: no error", name)
+		}
+		if got, _ := c.StateHash(); got != hash {
+			t.Errorf("%s: the state changed", name)
+		}
+	}
+
+	err = c.LoadState(bytes.NewReader(state))
+	if err != nil {
+		t.Fatal(err)
+	}
+}
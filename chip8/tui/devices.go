@@ -0,0 +1,108 @@
+package tui
+
+import (
+	"sync"
+	"time"
+
+	"github.com/ministergoose/chip8-emu-go/chip8/hardware"
+)
+
+// Display keeps the framebuffer in memory, the UI draws it in the terminal.
+type Display struct {
+	hardware.Framebuffer
+
+	mu     sync.Mutex
+	closed bool
+}
+
+func NewDisplay() *Display {
+	return &Display{Framebuffer: *hardware.NewFramebuffer()}
+}
+
+func (dspl *Display) Init(title string, scale float32) {
+}
+
+func (dspl *Display) Draw() {
+}
+
+func (dspl *Display) ShouldClose() bool {
+	dspl.mu.Lock()
+	defer dspl.mu.Unlock()
+
+	return dspl.closed
+}
+
+func (dspl *Display) Close() {
+	dspl.mu.Lock()
+	defer dspl.mu.Unlock()
+
+	dspl.closed = true
+}
+
+// KEY_HOLD is how long a key stays down after it was typed, terminals
+// don't report key releases but repeat held keys.
+const KEY_HOLD = time.Millisecond * 150
+
+/*
+The numeric keypad is used like in the raylib frontend:
+
+| 7 | 8 | 9 | / |      | 1 | 2 | 3 | C |
+| 4 | 5 | 6 | * |  ->  | 4 | 5 | 6 | D |
+| 1 | 2 | 3 | - |      | 7 | 8 | 9 | E |
+| . | 0 | Enter | + |  | A | 0 | B | F |
+*/
+
+var KEYS map[byte]byte = map[byte]byte{
+	'0': 0x0, '7': 0x1, '8': 0x2, '9': 0x3,
+	'4': 0x4, '5': 0x5, '6': 0x6, '1': 0x7,
+	'2': 0x8, '3': 0x9, '.': 0xA, '\r': 0xB,
+	'/': 0xC, '*': 0xD, '-': 0xE, '+': 0xF,
+}
+
+type Keyboard struct {
+	mu      sync.Mutex
+	until   [16]time.Time
+	pressed byte
+}
+
+func NewKeyboard() *Keyboard {
+	return &Keyboard{pressed: 0x80}
+}
+
+// Press feeds a typed character, it returns false if it is not a CHIP-8 key.
+func (kbrd *Keyboard) Press(ch byte) bool {
+	key, ok := KEYS[ch]
+	if !ok {
+		return false
+	}
+
+	kbrd.mu.Lock()
+	defer kbrd.mu.Unlock()
+
+	kbrd.until[key] = time.Now().Add(KEY_HOLD)
+	kbrd.pressed = key
+	return true
+}
+
+func (kbrd *Keyboard) ReadKeys() uint16 {
+	kbrd.mu.Lock()
+	defer kbrd.mu.Unlock()
+
+	var status uint16
+	now := time.Now()
+	for i, t := range kbrd.until {
+		if now.Before(t) {
+			status |= 1 << i
+		}
+	}
+	return status
+}
+
+func (kbrd *Keyboard) WaitKey() byte {
+	kbrd.mu.Lock()
+	defer kbrd.mu.Unlock()
+
+	key := kbrd.pressed
+	kbrd.pressed = 0x80
+	return key
+}
@@ -0,0 +1,46 @@
+package tui
+
+import (
+	"os"
+	"os/exec"
+	"strings"
+)
+
+const (
+	ESC          = "\x1b"
+	ALT_SCREEN   = ESC + "[?1049h"
+	MAIN_SCREEN  = ESC + "[?1049l"
+	HIDE_CURSOR  = ESC + "[?25l"
+	SHOW_CURSOR  = ESC + "[?25h"
+	HOME         = ESC + "[H"
+	CLEAR_LINE   = ESC + "[K"
+	CLEAR_SCREEN = ESC + "[J"
+	RESET        = ESC + "[0m"
+	REVERSE      = ESC + "[7m"
+	BOLD         = ESC + "[1m"
+	RED          = ESC + "[31m"
+	YELLOW       = ESC + "[33m"
+	CYAN         = ESC + "[36m"
+)
+
+// stty runs stty on the controlling terminal, no package outside the
+// standard library is needed to switch the terminal to raw mode.
+func stty(args ...string) (string, error) {
+	cmd := exec.Command("stty", args...)
+	cmd.Stdin = os.Stdin
+	out, err := cmd.Output()
+	return strings.TrimSpace(string(out)), err
+}
+
+// makeRaw switches the terminal to raw mode and returns a function restoring it.
+func makeRaw() (func(), error) {
+	state, err := stty("-g")
+	if err != nil {
+		return nil, err
+	}
+	_, err = stty("raw", "-echo")
+	if err != nil {
+		return nil, err
+	}
+	return func() { stty(state) }, nil
+}
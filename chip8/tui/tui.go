@@ -0,0 +1,437 @@
+// Package tui implements a full-screen terminal debugger, for machines
+// where raylib cannot open a window, e.g. over SSH.
+package tui
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ministergoose/chip8-emu-go/chip8"
+	"github.com/ministergoose/chip8-emu-go/chip8/disasm"
+	"github.com/ministergoose/chip8-emu-go/chip8/hardware"
+)
+
+const (
+	FPS          = 30
+	DISASM_LINES = 17
+	MEMORY_ROWS  = 8
+	CTRL_C       = 0x03
+	BACKSPACE    = 0x7f
+)
+
+// COLORS are the 256-color terminal indices of the XO-CHIP plane combinations,
+// the same palette as the raylib frontend.
+var COLORS [4]int = [4]int{16, 46, 214, 22}
+
+const HELP = "s step  n next  o out  c continue  p pause  b breakpoint  r register  m memory  g goto  q quit  | keypad: numpad"
+
+type snapshot struct {
+	regs        chip8.Registers
+	stack       []uint16
+	memory      []byte
+	fb          hardware.Framebuffer
+	platform    chip8.Platform
+	halted      bool
+	paused      bool
+	breakpoints map[uint16]bool
+}
+
+type UI struct {
+	cpu  *chip8.Cpu
+	dbg  *chip8.Debugger
+	dspl *Display
+	kbrd *Keyboard
+	out  *bufio.Writer
+
+	memAddr int // address the memory view is centered on, -1 follows I
+	status  string
+
+	prompt  string // label of the line being edited, "" when not editing
+	input   []byte
+	onInput func(s string) error
+}
+
+// New creates the UI of a Cpu using dspl and kbrd as its devices.
+func New(cpu *chip8.Cpu, dbg *chip8.Debugger, dspl *Display, kbrd *Keyboard) *UI {
+	return &UI{cpu: cpu, dbg: dbg, dspl: dspl, kbrd: kbrd, memAddr: -1}
+}
+
+// Run draws the UI and handles the keys until the user quits, the caller runs cpu.Run meanwhile.
+func (ui *UI) Run() error {
+	restore, err := makeRaw()
+	if err != nil {
+		return fmt.Errorf("can't switch the terminal to raw mode: %v", err)
+	}
+	defer restore()
+
+	ui.out = bufio.NewWriter(os.Stdout)
+	ui.out.WriteString(ALT_SCREEN + HIDE_CURSOR)
+	defer func() {
+		ui.out.WriteString(SHOW_CURSOR + MAIN_SCREEN)
+		ui.out.Flush()
+	}()
+
+	keys := make(chan byte, 64)
+	go func() {
+		buf := make([]byte, 64)
+		for {
+			n, err := os.Stdin.Read(buf)
+			if err != nil {
+				close(keys)
+				return
+			}
+			for _, ch := range buf[:n] {
+				keys <- ch
+			}
+		}
+	}()
+
+	ticker := time.NewTicker(time.Second / FPS)
+	defer ticker.Stop()
+
+	if ui.dbg.Paused() {
+		ui.status = "paused"
+	}
+	for {
+		select {
+		case ch, ok := <-keys:
+			if !ok || ui.key(ch) {
+				ui.dspl.Close()
+				return nil
+			}
+		case ev := <-ui.dbg.Events():
+			ui.status = describe(ev)
+		case <-ticker.C:
+		}
+		ui.draw()
+	}
+}
+
+func describe(ev chip8.StopEvent) string {
+	switch ev.Reason {
+	case chip8.STOP_BREAKPOINT:
+		return fmt.Sprintf("breakpoint at 0x%03X", ev.PC)
+	case chip8.STOP_WATCHPOINT:
+		return fmt.Sprintf("watchpoint 0x%03X at 0x%03X", ev.Addr, ev.PC)
+	case chip8.STOP_CONDITION:
+		return fmt.Sprintf("%s at 0x%03X", ev.Cond, ev.PC)
+	}
+	return fmt.Sprintf("%s at 0x%03X", ev.Reason, ev.PC)
+}
+
+// key handles a typed character and returns true to quit.
+func (ui *UI) key(ch byte) bool {
+	if ui.prompt != "" {
+		ui.edit(ch)
+		return false
+	}
+	if ui.kbrd.Press(ch) {
+		return false
+	}
+
+	switch ch {
+	case 'q', CTRL_C:
+		return true
+	case 's':
+		ui.dbg.StepInto()
+	case 'n':
+		ui.dbg.StepOver()
+	case 'o':
+		ui.dbg.StepOut()
+	case 'c':
+		ui.status = "running"
+		ui.dbg.Continue()
+	case 'p':
+		ui.dbg.Pause()
+	case 'b':
+		ui.ask("toggle breakpoint at (empty for PC)", ui.toggleBreakpoint)
+	case 'r':
+		ui.ask("set register (V3 0x10)", ui.setRegister)
+	case 'm':
+		ui.ask("write memory (0x300 12 34)", ui.writeMemory)
+	case 'g':
+		ui.ask("view memory at (empty follows I)", ui.gotoMemory)
+	}
+	return false
+}
+
+func (ui *UI) ask(prompt string, f func(s string) error) {
+	ui.prompt, ui.input, ui.onInput = prompt, nil, f
+}
+
+func (ui *UI) edit(ch byte) {
+	switch {
+	case ch == '\r' || ch == '\n':
+		err := ui.onInput(strings.TrimSpace(string(ui.input)))
+		if err != nil {
+			ui.status = err.Error()
+		}
+		ui.prompt = ""
+	case ch == ESC[0] || ch == CTRL_C:
+		ui.prompt = ""
+	case ch == BACKSPACE || ch == '\b':
+		if len(ui.input) > 0 {
+			ui.input = ui.input[:len(ui.input)-1]
+		}
+	case ch >= ' ' && ch < BACKSPACE:
+		ui.input = append(ui.input, ch)
+	}
+}
+
+func (ui *UI) toggleBreakpoint(s string) error {
+	addr := ui.dbg.Registers().PC
+	if s != "" {
+		var err error
+		addr, err = chip8.ParseValue(s)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, a := range ui.dbg.Breakpoints() {
+		if a == addr {
+			ui.dbg.RemoveBreakpoint(addr)
+			ui.status = fmt.Sprintf("breakpoint at 0x%03X removed", addr)
+			return nil
+		}
+	}
+	ui.dbg.AddBreakpoint(addr)
+	ui.status = fmt.Sprintf("breakpoint at 0x%03X set", addr)
+	return nil
+}
+
+func fields(s string) []string {
+	return strings.FieldsFunc(s, func(r rune) bool { return r == ' ' || r == '=' || r == ',' })
+}
+
+func (ui *UI) setRegister(s string) error {
+	f := fields(s)
+	if len(f) != 2 {
+		return fmt.Errorf("expected: <register> <value>")
+	}
+	reg, err := chip8.ParseReg(f[0])
+	if err != nil {
+		return err
+	}
+	val, err := chip8.ParseValue(f[1])
+	if err != nil {
+		return err
+	}
+	return ui.dbg.SetRegister(reg, val)
+}
+
+func (ui *UI) writeMemory(s string) error {
+	f := fields(s)
+	if len(f) < 2 {
+		return fmt.Errorf("expected: <address> <hex byte>...")
+	}
+	addr, err := chip8.ParseValue(f[0])
+	if err != nil {
+		return err
+	}
+	var data []byte
+	for _, x := range f[1:] {
+		b, err := strconv.ParseUint(strings.TrimPrefix(x, "0x"), 16, 8)
+		if err != nil {
+			return fmt.Errorf("bad byte: %s", x)
+		}
+		data = append(data, byte(b))
+	}
+	return ui.dbg.WriteMemory(addr, data)
+}
+
+func (ui *UI) gotoMemory(s string) error {
+	if s == "" {
+		ui.memAddr = -1
+		return nil
+	}
+	addr, err := chip8.ParseValue(s)
+	if err != nil {
+		return err
+	}
+	ui.memAddr = int(addr)
+	return nil
+}
+
+func (ui *UI) snapshot() *snapshot {
+	s := &snapshot{paused: ui.dbg.Paused(), breakpoints: map[uint16]bool{}}
+	for _, addr := range ui.dbg.Breakpoints() {
+		s.breakpoints[addr] = true
+	}
+	ui.dbg.Exec(func(c *chip8.Cpu) {
+		s.regs = c.Registers()
+		s.stack = c.CallStack()
+		s.memory = c.ReadMemory(0, c.MemorySize())
+		s.fb = ui.dspl.Framebuffer
+		s.platform = c.Platform()
+		s.halted = c.Halted()
+	})
+	return s
+}
+
+func (ui *UI) draw() {
+	s := ui.snapshot()
+	w := ui.out
+
+	w.WriteString(HOME)
+	for _, line := range ui.screen(s) {
+		w.WriteString(line + RESET + CLEAR_LINE + "\r\n")
+	}
+	w.WriteString("\r\n")
+
+	panels := [][]string{ui.disasm(s), ui.registers(s), ui.stack(s)}
+	widths := []int{40, 26, 12}
+	for i := 0; i < DISASM_LINES+1; i++ {
+		for j, p := range panels {
+			line := ""
+			if i < len(p) {
+				line = p[i]
+			}
+			w.WriteString(pad(line, widths[j]))
+		}
+		w.WriteString(CLEAR_LINE + "\r\n")
+	}
+	w.WriteString("\r\n")
+
+	for _, line := range ui.memory(s) {
+		w.WriteString(line + CLEAR_LINE + "\r\n")
+	}
+	w.WriteString("\r\n")
+
+	fmt.Fprintf(w, "%s%s%s%s\r\n", BOLD, ui.status, RESET, CLEAR_LINE)
+	if ui.prompt != "" {
+		fmt.Fprintf(w, "%s: %s%s %s%s", ui.prompt, string(ui.input), REVERSE, RESET, CLEAR_LINE)
+	} else {
+		w.WriteString(HELP + CLEAR_LINE)
+	}
+	w.WriteString(CLEAR_SCREEN)
+	w.Flush()
+}
+
+// screen draws two pixel rows per line with upper half blocks.
+func (ui *UI) screen(s *snapshot) []string {
+	fb := &s.fb
+	lines := []string{fmt.Sprintf("%sScreen %dx%d%s", BOLD, fb.Width(), fb.Height(), RESET)}
+	for y := 0; y < int(fb.Height()); y += 2 {
+		var b strings.Builder
+		for x := 0; x < int(fb.Width()); x++ {
+			top, bottom := fb.Pixels[y][x]&3, fb.Pixels[y+1][x]&3
+			fmt.Fprintf(&b, "\x1b[38;5;%dm\x1b[48;5;%dm▀", COLORS[top], COLORS[bottom])
+		}
+		lines = append(lines, b.String())
+	}
+	return lines
+}
+
+func (ui *UI) disasm(s *snapshot) []string {
+	lines := []string{BOLD + "Disassembly" + RESET}
+	pc := int(s.regs.PC)
+	for i := 0; i < DISASM_LINES; i++ {
+		addr := pc + (i-DISASM_LINES/2)*2
+		if addr < 0 || addr+1 >= len(s.memory) {
+			lines = append(lines, "")
+			continue
+		}
+
+		inst := uint16(s.memory[addr])<<8 | uint16(s.memory[addr+1])
+		mark := " "
+		if s.breakpoints[uint16(addr)] {
+			mark = RED + "●" + RESET
+		}
+		text := fmt.Sprintf("db 0x%02X, 0x%02X", s.memory[addr], s.memory[addr+1])
+		if in, ok := disasm.Decode(s.memory[addr:], uint16(addr), s.platform); ok {
+			text = in.String()
+		}
+		line := fmt.Sprintf("%04X  %04X  %s", addr, inst, text)
+		if addr == pc {
+			line = REVERSE + line + RESET
+		}
+		lines = append(lines, mark+" "+line)
+	}
+	return lines
+}
+
+func (ui *UI) registers(s *snapshot) []string {
+	r := &s.regs
+	lines := []string{BOLD + "Registers" + RESET}
+	for i := 0; i < 8; i++ {
+		lines = append(lines, fmt.Sprintf("V%X=%02X  V%X=%02X", i, r.V[i], i+8, r.V[i+8]))
+	}
+	lines = append(lines,
+		"",
+		fmt.Sprintf("I =%04X  PC=%04X", r.I, r.PC),
+		fmt.Sprintf("SP=%02X    DT=%02X  ST=%02X", r.SP, r.DT, r.ST),
+		"",
+		"platform "+s.platform.String(),
+	)
+
+	state := CYAN + "RUNNING" + RESET
+	if s.halted {
+		state = RED + "HALTED" + RESET
+	} else if s.paused {
+		state = YELLOW + "PAUSED" + RESET
+	}
+	return append(lines, state)
+}
+
+func (ui *UI) stack(s *snapshot) []string {
+	lines := []string{BOLD + "Stack" + RESET}
+	for i := len(s.stack) - 1; i >= 0; i-- {
+		lines = append(lines, fmt.Sprintf("%2d %04X", i, s.stack[i]))
+	}
+	return lines
+}
+
+// memory shows the rows around the viewed address, the byte at the address is highlighted.
+func (ui *UI) memory(s *snapshot) []string {
+	center, follow := ui.memAddr, ""
+	if center < 0 {
+		center, follow = int(s.regs.I), " (I)"
+	}
+
+	lines := []string{fmt.Sprintf("%sMemory @%04X%s%s", BOLD, center, follow, RESET)}
+	base := center&^0xf - 0x30
+	if base < 0 {
+		base = 0
+	}
+	if last := len(s.memory) - MEMORY_ROWS*16; base > last {
+		base = last
+	}
+	for row := 0; row < MEMORY_ROWS; row++ {
+		addr := base + row*16
+		var b strings.Builder
+		fmt.Fprintf(&b, "%04X ", addr)
+		for i := 0; i < 16; i++ {
+			if addr+i == center {
+				fmt.Fprintf(&b, " %s%02X%s", REVERSE, s.memory[addr+i], RESET)
+			} else {
+				fmt.Fprintf(&b, " %02X", s.memory[addr+i])
+			}
+		}
+		lines = append(lines, b.String())
+	}
+	return lines
+}
+
+// pad fills s with spaces to width w, escape sequences don't count.
+func pad(s string, w int) string {
+	n, esc := 0, false
+	for _, r := range s {
+		switch {
+		case esc:
+			esc = !(r >= '@' && r <= '~' && r != '[')
+		case r == 0x1b:
+			esc = true
+		default:
+			n++
+		}
+	}
+	if n >= w {
+		return s
+	}
+	return s + strings.Repeat(" ", w-n)
+}
@@ -0,0 +1,615 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/ministergoose/chip8-emu-go/chip8"
+	"github.com/ministergoose/chip8-emu-go/chip8/config"
+	"github.com/ministergoose/chip8-emu-go/chip8/hardware/raylib"
+)
+
+// command is a subcommand of the emulator.
+type command struct {
+	name     string
+	aliases  []string
+	args     string // the arguments in the usage line
+	summary  string
+	nargs    int  // number of arguments
+	optional int  // number of optional arguments after them
+	config   bool // reads the config file
+	flags    func(fs *flag.FlagSet, opts *options)
+	run      func(opts options) error
+}
+
+var COMMANDS []*command
+
+// DEFAULT_COMMAND runs a ROM given without a command.
+const DEFAULT_COMMAND = "run"
+
+var LOG_LEVELS []string = []string{"debug", "info", "quiet"}
+
+var SHELLS []string = []string{"bash", "zsh", "fish"}
+
+type options struct {
+	filePath string
+	args     []string
+	set      map[string]bool // the flags given
+
+	config     config.Config
+	configPath string
+
+	// machine
+	platform string
+	quirks   string
+	ips      int
+	tickRate int
+	random   randomOptions
+
+	// window
+	title  string
+	scale  float64
+	colors string
+	mute   bool
+	beep   float64
+	layout string
+	keymap string
+	states string
+
+	logLevel  string
+	gdbAddr   string
+	dapListen string
+	output    string
+	listing   string
+	turbo     int
+	uncapped  bool
+	headless  bool
+	frames    int
+	record    string
+	replay    string
+	from      int
+	romdb     romdbOptions
+	bench     string
+	test      testOptions
+}
+
+// randomOptions are the -rng and -seed flags.
+type randomOptions struct {
+	rng    string
+	seed   uint64
+	seeded bool // -seed was given, otherwise the clock seeds
+}
+
+// romdbOptions are the flags of the roms command.
+type romdbOptions struct {
+	platform string
+	title    string
+	palette  string
+	keys     string
+	delete   bool
+	edit     bool // a setting of the ROM was given
+}
+
+// testOptions are the flags of the test command.
+type testOptions struct {
+	cases  string
+	roms   string
+	golden string
+	update bool
+}
+
+// apply sets up the random number generator of c.
+func (o randomOptions) apply(c *chip8.Cpu) {
+	c.SetRNG(chip8.RNGS[o.rng])
+	if o.seeded {
+		c.Seed(o.seed)
+	}
+}
+
+// ticks returns the instructions per frame of -tickrate or -ips, 0 keeps the ROM's.
+func (o options) ticks() int {
+	if o.tickRate > 0 {
+		return o.tickRate
+	}
+	if o.ips > 0 {
+		return (o.ips + 59) / 60
+	}
+	return 0
+}
+
+func init() {
+	COMMANDS = []*command{
+		{
+			name: "run", args: "<rom>", nargs: 1, config: true,
+			summary: "run a ROM, an Octo source or cartridge in a window or headless",
+			flags: func(fs *flag.FlagSet, o *options) {
+				machineFlags(fs, o)
+				windowFlags(fs, o)
+				fs.BoolVar(&o.headless, "headless", false, "run without a window as fast as possible, needs -frames or -replay")
+				fs.IntVar(&o.frames, "frames", 0, "exit after `n` frames")
+				fs.StringVar(&o.output, "o", "", "save the last frame of a headless run as PNG `file`")
+				fs.IntVar(&o.turbo, "turbo", chip8.FAST_FORWARD_FRAMES, "frames per drawn frame while the fast forward key is held")
+				fs.BoolVar(&o.uncapped, "uncapped", false, "run as fast as possible, the timers still tick once per emulated frame")
+				fs.StringVar(&o.gdbAddr, "gdb", "", "wait for a GDB remote connection on `addr`, e.g. :1234")
+				fs.StringVar(&o.record, "record", "", "record the input to the movie `file` when the ROM exits")
+				fs.StringVar(&o.replay, "replay", "", "replay the movie `file` and verify its final state, -record continues it")
+				fs.IntVar(&o.from, "from", 0, "replay only the first `n` frames of the movie, then play")
+			},
+			run: run,
+		},
+		{
+			name: "debug", args: "<rom>", nargs: 1, config: true,
+			summary: "debug a ROM in the terminal, starting paused",
+			flags: func(fs *flag.FlagSet, o *options) {
+				machineFlags(fs, o)
+				fs.BoolVar(&o.mute, "mute", false, "no sound")
+			},
+			run: runTUI,
+		},
+		{
+			name: "disasm", aliases: []string{"diss"}, args: "<rom>", nargs: 1,
+			summary: "write the disassembly of a ROM",
+			flags: func(fs *flag.FlagSet, o *options) {
+				platformFlag(fs, o)
+				fs.StringVar(&o.output, "o", "", "write the listing to `file`, - for stdout (default <rom>.dis.txt)")
+			},
+			run: disassemble,
+		},
+		{
+			name: "asm", args: "<source>", nargs: 1,
+			summary: "assemble a source or compile an Octo program (.8o) to a ROM",
+			flags: func(fs *flag.FlagSet, o *options) {
+				fs.StringVar(&o.output, "o", "", "write the ROM to `file` (default <source>.ch8, .sc8 or .xo8 for Octo)")
+				fs.StringVar(&o.listing, "l", "", "write a listing with addresses to `file`, the symbols of .8o sources")
+			},
+			run: assemble,
+		},
+		{
+			name: "info", args: "<rom>", nargs: 1, config: true,
+			summary: "show the hash, platform, quirks and speed a ROM runs with",
+			flags: func(fs *flag.FlagSet, o *options) {
+				machineFlags(fs, o)
+			},
+			run: info,
+		},
+		{
+			name: "bench", args: "<rom>", nargs: 1, config: true,
+			summary: "measure the emulation speed of a ROM headless",
+			flags: func(fs *flag.FlagSet, o *options) {
+				machineFlags(fs, o)
+				fs.IntVar(&o.frames, "frames", 600, "emulate `n` frames")
+				fs.StringVar(&o.bench, "interpreter", "", "`interpreter` to measure: step, blocks (default both)")
+			},
+			run: bench,
+		},
+		{
+			name: "test", nargs: 0,
+			summary: "run the golden image regression tests",
+			flags: func(fs *flag.FlagSet, o *options) {
+				fs.StringVar(&o.test.cases, "cases", "", "test cases `file`, e.g. chip8/regression/testdata/cases.json in the repository")
+				fs.StringVar(&o.test.roms, "roms", "", "`dir`ectory of the ROMs (default roms next to the cases)")
+				fs.StringVar(&o.test.golden, "golden", "", "`dir`ectory of the golden images (default golden next to the cases)")
+				fs.BoolVar(&o.test.update, "update", false, "write the golden images instead of comparing with them")
+			},
+			run: test,
+		},
+		{
+			name: "pack", args: "<rom or .8o source>", nargs: 1,
+			summary: "write an Octo cartridge",
+			flags: func(fs *flag.FlagSet, o *options) {
+				fs.StringVar(&o.output, "o", "", "write the cartridge to `file` (default <rom>.gif)")
+				quirksFlag(fs, o)
+				speedFlags(fs, o)
+			},
+			run: pack,
+		},
+		{
+			name: "dap", nargs: 0, config: true,
+			summary: "serve a Debug Adapter Protocol session",
+			flags: func(fs *flag.FlagSet, o *options) {
+				windowFlags(fs, o)
+				fs.StringVar(&o.dapListen, "listen", "", "serve on `addr` instead of stdin/stdout")
+			},
+			run: runDAP,
+		},
+		{
+			name: "roms", args: "[rom]", optional: 1,
+			summary: "list the ROM database, show or edit the settings of a ROM",
+			flags: func(fs *flag.FlagSet, o *options) {
+				fs.StringVar(&o.romdb.platform, "platform", "", "`platform` of the ROM: chip8, schip, xochip or a database ID")
+				quirksFlag(fs, o)
+				fs.IntVar(&o.tickRate, "tickrate", 0, "instructions per `frame`")
+				fs.StringVar(&o.romdb.title, "title", "", "`title` of the ROM")
+				fs.StringVar(&o.romdb.palette, "palette", "", "background, plane 1, plane 2 and both planes `colors`, e.g. #000000,#FFFFFF")
+				fs.StringVar(&o.romdb.keys, "keys", "", "game `keys` of the ROM, e.g. up=5,down=8,left=7,right=9,a=6")
+				fs.BoolVar(&o.romdb.delete, "delete", false, "remove the ROM from the user file")
+			},
+			run: roms,
+		},
+		{
+			name: "config", args: "<dump|path> [rom]", nargs: 1, optional: 1, config: true,
+			summary: "print the config file path or the settings a ROM runs with",
+			flags: func(fs *flag.FlagSet, o *options) {
+				machineFlags(fs, o)
+				windowFlags(fs, o)
+			},
+			run: configCommand,
+		},
+		{
+			name: "completion", args: "<" + strings.Join(SHELLS, "|") + ">", nargs: 1,
+			summary: "print the shell completion script",
+			run:     completion,
+		},
+		{
+			name: "help", args: "[command]", optional: 1,
+			summary: "show the help of a command",
+			run:     help,
+		},
+	}
+}
+
+func platformFlag(fs *flag.FlagSet, o *options) {
+	fs.StringVar(&o.platform, "platform", "", "`platform`: chip8, schip, xochip (default by the extension or the ROM database)")
+}
+
+func quirksFlag(fs *flag.FlagSet, o *options) {
+	fs.StringVar(&o.quirks, "quirks", "", "quirks `preset`: vip, chip48, schip, xochip (default the platform's)")
+}
+
+func speedFlags(fs *flag.FlagSet, o *options) {
+	fs.IntVar(&o.ips, "ips", 0, fmt.Sprintf("instructions per `second` (default %d, or the cartridge's or the ROM database's)", chip8.IPS))
+	fs.IntVar(&o.tickRate, "tickrate", 0, "instructions per `frame`, instead of -ips")
+}
+
+// machineFlags are the flags of the emulated machine.
+func machineFlags(fs *flag.FlagSet, o *options) {
+	platformFlag(fs, o)
+	quirksFlag(fs, o)
+	speedFlags(fs, o)
+	fs.StringVar(&o.random.rng, "rng", "xorshift", "random number `generator` of Cxkk: xorshift, page")
+	fs.Uint64Var(&o.random.seed, "seed", 0, "seed the random number generator with `n` instead of the clock")
+}
+
+// windowFlags are the flags of the raylib window.
+func windowFlags(fs *flag.FlagSet, o *options) {
+	fs.StringVar(&o.title, "title", "Chip8 Go", "window `title`")
+	fs.Float64Var(&o.scale, "scale", 10, "window pixels per low resolution `pixel`")
+	fs.StringVar(&o.colors, "colors", "", "background, plane 1, plane 2 and both planes `colors`, e.g. #000000,#FFFFFF")
+	fs.BoolVar(&o.mute, "mute", false, "no sound")
+	fs.Float64Var(&o.beep, "beep", 0, "beep frequency in `Hz` of the programs without an audio pattern")
+	fs.StringVar(&o.layout, "layout", "", "keyboard `layout`: "+strings.Join(layoutNames(), ", ")+" (default "+raylib.DEFAULT_LAYOUT+")")
+	fs.StringVar(&o.keymap, "keymap", "", "keymap `file` over the layout, JSON or TOML of CHIP-8 key => host keys, e.g. {\"4\": [\"Q\", \"UP\"]}")
+	fs.StringVar(&o.states, "states", "", "save state `dir`ectory (default next to the ROM)")
+}
+
+func findCommand(name string) *command {
+	for _, cmd := range COMMANDS {
+		if cmd.name == name {
+			return cmd
+		}
+		for _, alias := range cmd.aliases {
+			if alias == name {
+				return cmd
+			}
+		}
+	}
+	return nil
+}
+
+// newFlagSet returns the flags of a command, every command has -log.
+func newFlagSet(cmd *command, opts *options) *flag.FlagSet {
+	fs := flag.NewFlagSet(fmt.Sprintf("%s %s", programName(), cmd.name), flag.ContinueOnError)
+	fs.StringVar(&opts.logLevel, "log", "info", "log `level`: "+strings.Join(LOG_LEVELS, ", ")+", debug traces every instruction")
+	if cmd.config {
+		fs.StringVar(&opts.configPath, "config", "", "config `file`, TOML or JSON (default "+defaultConfigPath()+")")
+	}
+	if cmd.flags != nil {
+		cmd.flags(fs, opts)
+	}
+	fs.Usage = func() {
+		commandUsage(fs.Output(), cmd, fs)
+	}
+	return fs
+}
+
+// parseArgs returns the command and its options, a ROM without a command is run.
+func parseArgs(args []string) (*command, options, error) {
+	opts := options{}
+	if len(args) == 0 {
+		usage(os.Stderr)
+		return nil, opts, fmt.Errorf("no command")
+	}
+
+	cmd := findCommand(args[0])
+	if cmd == nil {
+		if _, err := os.Stat(args[0]); err != nil && !strings.HasPrefix(args[0], "-") {
+			usage(os.Stderr)
+			return nil, opts, fmt.Errorf("unknown command: %s", args[0])
+		}
+		cmd = findCommand(DEFAULT_COMMAND)
+	} else {
+		args = args[1:]
+	}
+
+	fs := newFlagSet(cmd, &opts)
+	var files []string
+	for {
+		// flags may follow the arguments
+		err := fs.Parse(args)
+		if err != nil {
+			return nil, opts, err
+		}
+		args = fs.Args()
+		for len(args) > 0 && (args[0] == "-" || !strings.HasPrefix(args[0], "-")) {
+			files = append(files, args[0])
+			args = args[1:]
+		}
+		if len(args) == 0 {
+			break
+		}
+	}
+	opts.set = make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) {
+		opts.set[f.Name] = true
+		switch {
+		case f.Name == "seed":
+			opts.random.seeded = true
+		case cmd.name == "roms" && f.Name != "delete" && f.Name != "log":
+			opts.romdb.edit = true
+		}
+	})
+
+	n := len(files)
+	if cmd.name == "roms" && (opts.romdb.edit || opts.romdb.delete) && n != 1 {
+		fs.Usage()
+		return nil, opts, fmt.Errorf("roms needs the ROM to change")
+	}
+	if cmd.name == "test" && opts.test.cases == "" {
+		fs.Usage()
+		return nil, opts, fmt.Errorf("test needs the cases file, -cases chip8/regression/testdata/cases.json in the repository")
+	}
+	if n < cmd.nargs || n > cmd.nargs+cmd.optional {
+		fs.Usage()
+		return nil, opts, fmt.Errorf("%s takes %s", cmd.name, argsText(cmd))
+	}
+	if n > 0 {
+		opts.filePath = files[0]
+	}
+	opts.args = files
+
+	if cmd.config {
+		err := loadConfig(&opts)
+		if err != nil {
+			return nil, opts, err
+		}
+	}
+
+	return cmd, opts, checkOptions(opts)
+}
+
+func defaultConfigPath() string {
+	dir, err := config.Dir()
+	if err != nil {
+		return "none"
+	}
+	return config.Path(dir)
+}
+
+// loadConfig reads the config file and sets the flags that were not given to
+// its settings. The speed, quirks, palette and keymap are applied with the ROM,
+// whose settings come in between.
+func loadConfig(opts *options) error {
+	if opts.configPath == "" {
+		dir, err := config.Dir()
+		if err != nil {
+			return nil
+		}
+		opts.configPath = config.Path(dir)
+		if _, err := os.Stat(opts.configPath); os.IsNotExist(err) {
+			return nil
+		}
+	}
+	cfg, err := config.Load(opts.configPath)
+	if err != nil {
+		return err
+	}
+	opts.config = cfg
+
+	if cfg.Scale > 0 && !opts.set["scale"] {
+		opts.scale = cfg.Scale
+	}
+	if cfg.Audio.Mute && !opts.set["mute"] {
+		opts.mute = true
+	}
+	if cfg.Audio.Freq > 0 && !opts.set["beep"] {
+		opts.beep = cfg.Audio.Freq
+	}
+	if cfg.States != "" && !opts.set["states"] {
+		opts.states = cfg.States
+	}
+	if cfg.Layout != "" && !opts.set["layout"] {
+		opts.layout = cfg.Layout
+	}
+	return checkConfig(cfg)
+}
+
+// checkConfig rejects unknown names in the config file.
+func checkConfig(cfg config.Config) error {
+	if _, ok := chip8.QUIRK_PRESETS[cfg.Quirks]; cfg.Quirks != "" && !ok {
+		return fmt.Errorf("config: unknown quirks preset: %s", cfg.Quirks)
+	}
+	if _, err := chip8.ParsePalette(cfg.Palette, raylib.DEFAULT_PALETTE); err != nil {
+		return fmt.Errorf("config: palette: %v", err)
+	}
+	if _, err := raylib.Keymap(cfg.Layout, keyNames(cfg.Keymap)); err != nil {
+		return fmt.Errorf("config: %v", err)
+	}
+	return nil
+}
+
+func argsText(cmd *command) string {
+	if cmd.args == "" {
+		return "no arguments"
+	}
+	return cmd.args
+}
+
+// checkOptions rejects unknown names, before anything starts.
+func checkOptions(opts options) error {
+	if opts.platform != "" {
+		if _, ok := chip8.PLATFORMS[opts.platform]; !ok {
+			return fmt.Errorf("unknown platform: %s", opts.platform)
+		}
+	}
+	if opts.quirks != "" {
+		if _, ok := chip8.QUIRK_PRESETS[opts.quirks]; !ok {
+			return fmt.Errorf("unknown quirks preset: %s", opts.quirks)
+		}
+	}
+	if opts.random.rng != "" {
+		if _, ok := chip8.RNGS[opts.random.rng]; !ok {
+			return fmt.Errorf("unknown random number generator: %s", opts.random.rng)
+		}
+	}
+	if opts.bench != "" {
+		if _, ok := chip8.INTERPRETERS[opts.bench]; !ok {
+			return fmt.Errorf("unknown interpreter: %s", opts.bench)
+		}
+	}
+	if opts.colors != "" {
+		_, err := chip8.ParsePalette(strings.Split(opts.colors, ","), raylib.DEFAULT_PALETTE)
+		if err != nil {
+			return err
+		}
+	}
+	if _, ok := raylib.LAYOUTS[opts.layout]; opts.layout != "" && !ok {
+		return fmt.Errorf("unknown keyboard layout: %s", opts.layout)
+	}
+	if !contains(LOG_LEVELS, opts.logLevel) {
+		return fmt.Errorf("unknown log level: %s", opts.logLevel)
+	}
+	return nil
+}
+
+// setLogLevel silences the log for quiet, the errors of the commands are printed anyway.
+func setLogLevel(level string) {
+	if level == "quiet" {
+		log.SetOutput(io.Discard)
+	}
+}
+
+func layoutNames() []string {
+	var names []string
+	for name := range raylib.LAYOUTS {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func contains(list []string, s string) bool {
+	for _, x := range list {
+		if x == s {
+			return true
+		}
+	}
+	return false
+}
+
+func programName() string {
+	return filepath.Base(os.Args[0])
+}
+
+func usage(w io.Writer) {
+	fmt.Fprintf(w, "Usage: %s <command> [flags] [arguments]\n", programName())
+	fmt.Fprintf(w, "       %s [run flags] <rom>\n\nCommands:\n", programName())
+	for _, cmd := range COMMANDS {
+		fmt.Fprintf(w, "  %-11s %s\n", cmd.name, cmd.summary)
+	}
+	fmt.Fprintf(w, "\nRun '%s help <command>' for its flags.\n", programName())
+}
+
+func commandUsage(w io.Writer, cmd *command, fs *flag.FlagSet) {
+	fmt.Fprintf(w, "Usage: %s %s [flags] %s\n\n%s.\n", programName(), cmd.name, cmd.args, strings.ToUpper(cmd.summary[:1])+cmd.summary[1:])
+	if len(cmd.aliases) > 0 {
+		fmt.Fprintf(w, "Also: %s\n", strings.Join(cmd.aliases, ", "))
+	}
+	fmt.Fprintln(w, "\nFlags:")
+	fs.SetOutput(w)
+	fs.PrintDefaults()
+}
+
+func help(opts options) error {
+	if opts.filePath == "" {
+		usage(os.Stdout)
+		return nil
+	}
+	cmd := findCommand(opts.filePath)
+	if cmd == nil {
+		return fmt.Errorf("unknown command: %s", opts.filePath)
+	}
+	commandUsage(os.Stdout, cmd, newFlagSet(cmd, &options{}))
+	return nil
+}
+
+// commandFlags returns the flag names of a command, with the dash.
+func commandFlags(cmd *command) []string {
+	var names []string
+	newFlagSet(cmd, &options{}).VisitAll(func(f *flag.Flag) {
+		names = append(names, "-"+f.Name)
+	})
+	sort.Strings(names)
+	return names
+}
+
+func completion(opts options) error {
+	prog := programName()
+	fn := "_" + strings.NewReplacer("-", "_", ".", "_").Replace(prog)
+
+	var names []string
+	for _, cmd := range COMMANDS {
+		names = append(names, cmd.name)
+	}
+
+	switch opts.filePath {
+	case "bash", "zsh":
+		if opts.filePath == "zsh" {
+			fmt.Println("autoload -U +X bashcompinit && bashcompinit")
+		}
+		fmt.Printf("%s() {\n", fn)
+		fmt.Println(`    local cur=${COMP_WORDS[COMP_CWORD]} flags=""`)
+		fmt.Println(`    if [ "$COMP_CWORD" -eq 1 ] && [[ $cur != -* ]]; then`)
+		fmt.Printf("        COMPREPLY=($(compgen -W %q -- \"$cur\") $(compgen -f -- \"$cur\"))\n", strings.Join(names, " "))
+		fmt.Println("        return")
+		fmt.Println("    fi")
+		fmt.Println(`    case ${COMP_WORDS[1]} in`)
+		for _, cmd := range COMMANDS {
+			fmt.Printf("    %s) flags=%q ;;\n", strings.Join(append([]string{cmd.name}, cmd.aliases...), "|"), strings.Join(commandFlags(cmd), " "))
+		}
+		fmt.Printf("    *) flags=%q ;;\n", strings.Join(commandFlags(findCommand(DEFAULT_COMMAND)), " "))
+		fmt.Println("    esac")
+		fmt.Println(`    if [[ $cur == -* ]]; then`)
+		fmt.Println(`        COMPREPLY=($(compgen -W "$flags" -- "$cur"))`)
+		fmt.Println("    else")
+		fmt.Println(`        COMPREPLY=($(compgen -f -- "$cur"))`)
+		fmt.Println("    fi")
+		fmt.Println("}")
+		fmt.Printf("complete -o filenames -F %s %s\n", fn, prog)
+	case "fish":
+		for _, cmd := range COMMANDS {
+			fmt.Printf("complete -c %s -n __fish_use_subcommand -a %s -d %q\n", prog, cmd.name, cmd.summary)
+			for _, f := range commandFlags(cmd) {
+				fmt.Printf("complete -c %s -n '__fish_seen_subcommand_from %s' -o %s\n", prog, cmd.name, f[1:])
+			}
+		}
+	default:
+		return fmt.Errorf("unknown shell: %s, want %s", opts.filePath, strings.Join(SHELLS, ", "))
+	}
+	return nil
+}
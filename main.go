@@ -1,51 +1,1131 @@
-package main
-
-import (
-	"fmt"
-	"log"
-	"os"
-	"path/filepath"
-
-	"github.com/ministergoose/chip8-emu-go/chip8"
-	"github.com/ministergoose/chip8-emu-go/chip8/hardware"
-	"github.com/ministergoose/chip8-emu-go/chip8/hardware/raylib"
-)
-
-func parseArgs() (bool, string) {
-	filePath := ""
-	diss := false
-
-	if (len(os.Args) == 3) && (os.Args[1] == "diss") {
-		return true, os.Args[2]
-	} else if len(os.Args) != 2 {
-		fmt.Fprintf(os.Stderr, "Usage: %s [diss] <file path>\n", filepath.Base(os.Args[0]))
-		os.Exit(1)
-	}
-
-	filePath = os.Args[1]
-
-	return diss, filePath
-}
-
-func main() {
-	diss, filePath := parseArgs()
-
-	if diss {
-		chip8.Disassembler(filePath)
-		return
-	}
-
-	dspl := raylib.NewDisplayRaylib()
-	dspl.Init("Chip8 Go", 10.0)
-	defer dspl.Close()
-
-	kbrd := raylib.NewKeyboardRaylib()
-	snd := hardware.NewSoundStd()
-
-	Cpu := chip8.NewCPU(dspl, kbrd, snd)
-	err := Cpu.Load(filePath)
-	if err != nil {
-		log.Fatal(err)
-	}
-	Cpu.Run()
-}
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"image/color"
+	"image/png"
+	"io"
+	"log"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ministergoose/chip8-emu-go/chip8"
+	"github.com/ministergoose/chip8-emu-go/chip8/asm"
+	"github.com/ministergoose/chip8-emu-go/chip8/config"
+	"github.com/ministergoose/chip8-emu-go/chip8/dap"
+	"github.com/ministergoose/chip8-emu-go/chip8/disasm"
+	"github.com/ministergoose/chip8-emu-go/chip8/gdb"
+	"github.com/ministergoose/chip8-emu-go/chip8/hardware"
+	"github.com/ministergoose/chip8-emu-go/chip8/hardware/headless"
+	"github.com/ministergoose/chip8-emu-go/chip8/hardware/raylib"
+	"github.com/ministergoose/chip8-emu-go/chip8/octo"
+	"github.com/ministergoose/chip8-emu-go/chip8/regression"
+	"github.com/ministergoose/chip8-emu-go/chip8/romdb"
+	"github.com/ministergoose/chip8-emu-go/chip8/tui"
+)
+
+func main() {
+	cmd, opts, err := parseArgs(os.Args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
+	if err == nil {
+		setLogLevel(opts.logLevel)
+		err = cmd.run(opts)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", programName(), err)
+		os.Exit(1)
+	}
+}
+
+// newMachine creates the CPU of a ROM and loads it. The platform, quirks and
+// speed come from the extension, the config file, the ROM database and the
+// flags, the later ones win.
+func newMachine(opts options, dspl hardware.Display, kbrd hardware.Keyboard, snd hardware.Sound) (*chip8.Cpu, error) {
+	platform, quirks := romPlatform(opts.filePath)
+	if opts.config.Quirks != "" {
+		quirks = chip8.QUIRK_PRESETS[opts.config.Quirks]
+	}
+	if opts.platform != "" {
+		platform = chip8.PLATFORMS[opts.platform]
+		quirks = platform.DefaultQuirks()
+	}
+
+	c := chip8.NewCPU(dspl, kbrd, snd, quirks)
+	c.SetPlatform(platform)
+	if n := opts.config.Ticks(); n > 0 {
+		c.SetTickRate(n)
+	}
+	c.Debug = opts.logLevel == "debug"
+	c.RomDB = openRomDB()
+	err := c.Load(opts.filePath)
+	if err != nil {
+		return nil, err
+	}
+	if opts.platform != "" && c.Platform() != platform {
+		// the database picked another platform, load the ROM again without it
+		db := c.RomDB
+		c.RomDB = nil
+		c.SetPlatform(platform)
+		c.SetQuirks(quirks)
+		err = c.Load(opts.filePath)
+		c.RomDB = db
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if opts.quirks != "" {
+		c.SetQuirks(chip8.QUIRK_PRESETS[opts.quirks])
+	}
+	if n := opts.ticks(); n > 0 {
+		c.SetTickRate(n)
+	}
+	opts.random.apply(c)
+	return c, nil
+}
+
+// newWindow opens the raylib window with the -title and -scale flags and the
+// palette of the config file.
+func newWindow(opts options) *raylib.DisplayRaylib {
+	dspl := raylib.NewDisplayRaylib()
+	dspl.Init(opts.title, float32(opts.scale))
+	if len(opts.config.Palette) > 0 {
+		// checked by checkConfig
+		palette, _ := chip8.ParsePalette(opts.config.Palette, raylib.DEFAULT_PALETTE)
+		dspl.SetPalette(palette)
+	}
+	return dspl
+}
+
+// setColors applies -colors, after the ROM database.
+func setColors(dspl *raylib.DisplayRaylib, opts options) {
+	if opts.colors == "" {
+		return
+	}
+	// checked by checkOptions
+	palette, _ := chip8.ParsePalette(strings.Split(opts.colors, ","), raylib.DEFAULT_PALETTE)
+	dspl.SetPalette(palette)
+}
+
+// newKeyboard returns the raylib keyboard with the keymap of the flags or the
+// config file.
+func newKeyboard(opts options) (*raylib.KeyboardRaylib, error) {
+	kbrd := raylib.NewKeyboardRaylib()
+	keys, _, err := keymap(opts)
+	if err != nil {
+		return nil, err
+	}
+	kbrd.SetKeymap(keys)
+	return kbrd, nil
+}
+
+// keymap returns the host keys of the CHIP-8 keys and where they come from:
+// the layout, changed by the keymap of the config file and the one of the
+// rebinding screen, or by the -keymap file if -layout or -keymap is given.
+func keymap(opts options) ([16][]int32, string, error) {
+	source := "default"
+	if opts.layout != "" {
+		source = "config"
+	}
+	var maps []map[string]config.Keys
+	if opts.set["layout"] || opts.keymap != "" {
+		source = "flag"
+		if opts.keymap != "" {
+			m, err := config.LoadKeymap(opts.keymap)
+			if err != nil {
+				return [16][]int32{}, "", err
+			}
+			maps = append(maps, m)
+		}
+	} else {
+		if len(opts.config.Keymap) > 0 {
+			maps = append(maps, opts.config.Keymap)
+			source = "config"
+		}
+		if filePath := savedKeymapPath(); filePath != "" {
+			m, err := config.LoadKeymap(filePath)
+			if err == nil {
+				maps = append(maps, m)
+				source = "rebinding screen"
+			} else if !os.IsNotExist(err) {
+				return [16][]int32{}, "", err
+			}
+		}
+	}
+
+	names := make(map[string][]string)
+	for _, m := range maps {
+		for key, keys := range keyNames(m) {
+			names[key] = keys
+		}
+	}
+	keys, err := raylib.Keymap(opts.layout, names)
+	return keys, source, err
+}
+
+// keyNames returns a keymap of the config package for raylib, by upper case hex digit.
+func keyNames(m map[string]config.Keys) map[string][]string {
+	names := make(map[string][]string)
+	for key, keys := range m {
+		if i, err := strconv.ParseUint(key, 16, 4); err == nil {
+			key = fmt.Sprintf("%X", i)
+		}
+		names[key] = keys
+	}
+	return names
+}
+
+// savedKeymapPath returns the keymap file of the rebinding screen.
+func savedKeymapPath() string {
+	dir, err := config.Dir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, config.KEYMAP_FILE)
+}
+
+// saveKeymap writes the keys of the rebinding screen that differ from the
+// layout and the config file.
+func saveKeymap(opts options, keys [16][]int32) error {
+	base, err := raylib.Keymap(opts.layout, keyNames(opts.config.Keymap))
+	if err != nil {
+		return err
+	}
+	names := raylib.KeymapNames(keys)
+	baseNames := raylib.KeymapNames(base)
+	m := make(map[string]config.Keys)
+	for key := range names {
+		if strings.Join(names[key], ",") != strings.Join(baseNames[key], ",") {
+			m[key] = names[key]
+		}
+	}
+
+	filePath := savedKeymapPath()
+	if filePath == "" {
+		return fmt.Errorf("no config directory")
+	}
+	err = config.SaveKeymap(filePath, m)
+	if err != nil {
+		return err
+	}
+	if opts.set["layout"] || opts.keymap != "" {
+		log.Printf("saved keymap to %s, it applies without -layout and -keymap", filePath)
+	} else {
+		log.Printf("saved keymap to %s", filePath)
+	}
+	return nil
+}
+
+// newSound returns the beeper, or a silent one with -mute.
+func newSound(opts options) hardware.Sound {
+	if opts.mute {
+		return headless.NewSoundHeadless()
+	}
+	snd := hardware.NewSoundStd()
+	if opts.beep > 0 {
+		snd.SetFreq(opts.beep)
+	}
+	return snd
+}
+
+// run runs a ROM in a window, or headless.
+func run(opts options) error {
+	if opts.headless {
+		return runHeadless(opts)
+	}
+
+	keys, err := newKeyboard(opts)
+	if err != nil {
+		return err
+	}
+	kbrd := chip8.NewMovieKeyboard(keys)
+
+	dspl := newWindow(opts)
+	defer dspl.Close()
+
+	Cpu, err := newMachine(opts, dspl, kbrd, newSound(opts))
+	if err != nil {
+		return err
+	}
+	setColors(dspl, opts)
+	verify, err := startMovie(Cpu, kbrd, opts)
+	if err != nil {
+		return err
+	}
+	rebind := raylib.NewRebind(keys, dspl)
+	rebind.OnDone = func(keys [16][]int32) {
+		err := saveKeymap(opts, keys)
+		if err != nil {
+			log.Println(err)
+		}
+	}
+	// the replay has to stop at its last frame to be verified
+	Cpu.SetUncapped(opts.uncapped && verify == 0)
+	if kbrd.Movie() == nil {
+		Cpu.Rewind = chip8.NewRewind(chip8.REWIND_FRAMES)
+	}
+	Cpu.OnFrame = func(c *chip8.Cpu) bool {
+		if verify > 0 && c.Frames() >= verify {
+			verifyMovie(c, kbrd.Movie(), verify)
+			verify = 0
+			c.SetUncapped(opts.uncapped)
+		}
+		if opts.frames > 0 && c.Frames() >= opts.frames {
+			c.Halt()
+			return true
+		}
+		if rebind.Update() {
+			return true
+		}
+		stateHotkeys(c, statePrefix(opts), kbrd.Movie() == nil)
+		speedHotkeys(c, opts.turbo)
+		if verify > 0 && verify-c.Frames() < c.FastForward() {
+			c.SetFastForward(verify - c.Frames())
+		}
+		// there is no rewind while a movie records or replays
+		if c.Rewind != nil && raylib.RewindKeyDown() {
+			_, err := c.Rewind.Back(c)
+			if err != nil {
+				log.Println(err)
+			}
+			return true
+		}
+		return false
+	}
+
+	if opts.gdbAddr != "" {
+		dbg := chip8.NewDebugger(Cpu)
+		dbg.Pause()
+		conn, err := gdb.Accept(opts.gdbAddr)
+		if err != nil {
+			return err
+		}
+		go func() {
+			defer conn.Close()
+			err := gdb.NewServer(dbg).Serve(conn)
+			if err != nil {
+				log.Println(err)
+			}
+		}()
+	}
+
+	Cpu.Run()
+
+	if opts.record != "" {
+		return saveMovie(Cpu, kbrd.Movie(), opts.record)
+	}
+	return nil
+}
+
+// startMovie records or replays the input of c as set by -record, -replay and -from.
+// It returns the frame after which the replay is verified, 0 for none.
+func startMovie(c *chip8.Cpu, kbrd *chip8.MovieKeyboard, opts options) (int, error) {
+	if opts.replay != "" {
+		m, err := chip8.LoadMovieFile(opts.replay)
+		if err != nil {
+			return 0, err
+		}
+		err = m.Start(c)
+		if err != nil {
+			return 0, err
+		}
+		if opts.from > 0 && opts.from < m.Len() {
+			kbrd.Replay(m, opts.from)
+			return 0, nil
+		}
+		kbrd.Replay(m, m.Len())
+		return m.Len(), nil
+	}
+
+	if opts.record != "" {
+		seed := uint64(time.Now().UnixNano())
+		if opts.random.seeded {
+			seed = opts.random.seed
+		}
+		kbrd.Record(chip8.NewMovie(c, seed))
+	}
+	return 0, nil
+}
+
+func verifyMovie(c *chip8.Cpu, m *chip8.Movie, frames int) {
+	err := m.Verify(c)
+	if err != nil {
+		log.Println(err)
+		return
+	}
+	log.Printf("replay verified after %d frames", frames)
+}
+
+func saveMovie(c *chip8.Cpu, m *chip8.Movie, filePath string) error {
+	err := m.Finish(c)
+	if err != nil {
+		return err
+	}
+	err = m.SaveFile(filePath)
+	if err != nil {
+		return err
+	}
+	log.Printf("recorded %d frames to %s", m.Len(), filePath)
+	return nil
+}
+
+// runHeadless runs a ROM for a number of frames without a window or sound,
+// or replays a movie to its end.
+func runHeadless(opts options) error {
+	dspl := headless.NewDisplayHeadless()
+	snd := headless.NewSoundHeadless()
+	kbrd := chip8.NewMovieKeyboard(nil)
+
+	Cpu, err := newMachine(opts, dspl, kbrd, snd)
+	if err != nil {
+		return err
+	}
+	Cpu.SetInterpreter(chip8.INTERPRETER_BLOCKS)
+	verify, err := startMovie(Cpu, kbrd, opts)
+	if err != nil {
+		return err
+	}
+
+	frames := opts.frames
+	if frames <= 0 && opts.replay != "" {
+		frames = kbrd.Movie().Len()
+	}
+	if frames <= 0 {
+		return fmt.Errorf("-headless needs -frames")
+	}
+
+	for dspl.Frames() < frames && !Cpu.Halted() {
+		Cpu.RunFrame()
+		if verify > 0 && Cpu.Frames() == verify {
+			err = kbrd.Movie().Verify(Cpu)
+			if err != nil {
+				return err
+			}
+			log.Printf("replay verified after %d frames", verify)
+		}
+	}
+	log.Printf("%d frames, %d with changes, %d with sound", dspl.Frames(), dspl.Draws(), snd.Beeps())
+
+	if opts.record != "" {
+		err = saveMovie(Cpu, kbrd.Movie(), opts.record)
+		if err != nil {
+			return err
+		}
+	}
+
+	if opts.output == "" {
+		return nil
+	}
+	f, err := os.Create(opts.output)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	return png.Encode(f, dspl.Image())
+}
+
+// info shows how a ROM is run.
+func info(opts options) error {
+	data, err := os.ReadFile(opts.filePath)
+	if err != nil {
+		return err
+	}
+	c, err := newMachine(opts, headless.NewDisplayHeadless(), headless.NewKeyboardHeadless(), headless.NewSoundHeadless())
+	if err != nil {
+		return err
+	}
+
+	kind := "ROM"
+	switch {
+	case strings.EqualFold(filepath.Ext(opts.filePath), ".8o"):
+		kind = "Octo source"
+	case octo.IsCartridge(data):
+		kind = "Octo cartridge"
+	}
+	title := "-"
+	if c.RomDB != nil {
+		if entry, ok := c.RomDB.Lookup(romdb.Hash(data)); ok {
+			title = entry.Title
+		}
+	}
+
+	fmt.Printf("file      %s (%s, %d bytes)\n", opts.filePath, kind, len(data))
+	fmt.Printf("sha1      %s\n", romdb.Hash(data))
+	fmt.Printf("title     %s\n", title)
+	fmt.Printf("platform  %s\n", c.Platform())
+	fmt.Printf("quirks    %s\n", quirksName(c.Quirks()))
+	fmt.Printf("speed     %d instructions per frame, %d per second\n", c.TickRate(), c.TickRate()*60)
+	return nil
+}
+
+// quirksName returns the preset of q, or its values.
+func quirksName(q chip8.Quirks) string {
+	for _, name := range []string{"vip", "chip48", "schip", "xochip"} {
+		if chip8.QUIRK_PRESETS[name] == q {
+			return name
+		}
+	}
+	return fmt.Sprintf("%+v", q)
+}
+
+// paletteHeadless is a headless display that keeps the palette the ROM sets.
+type paletteHeadless struct {
+	*headless.DisplayHeadless
+	palette [4]color.RGBA
+	set     bool
+}
+
+func (d *paletteHeadless) SetPalette(palette [4]color.RGBA) {
+	d.palette = palette
+	d.set = true
+}
+
+// configCommand prints the path of the config file, or the settings a ROM
+// runs with and where each of them comes from.
+func configCommand(opts options) error {
+	switch opts.args[0] {
+	case "path":
+		if len(opts.args) > 1 {
+			return fmt.Errorf("config path takes no ROM")
+		}
+		fmt.Println(opts.configPath)
+		return nil
+	case "dump":
+	default:
+		return fmt.Errorf("unknown config command: %s", opts.args[0])
+	}
+
+	cfg := opts.config
+	res := config.Config{Scale: opts.scale, States: opts.states}
+	notes := make(map[string]string)
+	// note tells where a setting comes from, the first source that sets it wins
+	note := func(key string, flag, rom, config bool) {
+		switch {
+		case flag:
+			notes[key] = "flag"
+		case rom:
+			notes[key] = "ROM"
+		case config:
+			notes[key] = "config"
+		default:
+			notes[key] = "default"
+		}
+	}
+
+	palette := raylib.DEFAULT_PALETTE
+	if len(cfg.Palette) > 0 {
+		palette, _ = chip8.ParsePalette(cfg.Palette, palette)
+	}
+	romTicks, romQuirks, romPalette := false, false, false
+	if len(opts.args) > 1 {
+		opts.filePath = opts.args[1]
+		data, err := os.ReadFile(opts.filePath)
+		if err != nil {
+			return err
+		}
+		dspl := &paletteHeadless{DisplayHeadless: headless.NewDisplayHeadless()}
+		c, err := newMachine(opts, dspl, headless.NewKeyboardHeadless(), headless.NewSoundHeadless())
+		if err != nil {
+			return err
+		}
+		res.TickRate = c.TickRate()
+		res.Quirks = quirksName(c.Quirks())
+
+		cart := octo.IsCartridge(data)
+		entry, known := romdb.Entry{}, false
+		if c.RomDB != nil && !cart {
+			entry, known = c.RomDB.Lookup(romdb.Hash(data))
+		}
+		romTicks = cart || known && entry.TickRate > 0
+		romQuirks = cart || known
+		if dspl.set {
+			palette, romPalette = dspl.palette, true
+		}
+	} else {
+		res.TickRate = chip8.IPS / 60
+		if n := cfg.Ticks(); n > 0 {
+			res.TickRate = n
+		}
+		if n := opts.ticks(); n > 0 {
+			res.TickRate = n
+		}
+		res.Quirks = cfg.Quirks
+		if opts.quirks != "" {
+			res.Quirks = opts.quirks
+		}
+	}
+	if opts.colors != "" {
+		palette, _ = chip8.ParsePalette(strings.Split(opts.colors, ","), raylib.DEFAULT_PALETTE)
+	}
+	for _, c := range palette {
+		res.Palette = append(res.Palette, fmt.Sprintf("#%02X%02X%02X", c.R, c.G, c.B))
+	}
+
+	keys, keySource, err := keymap(opts)
+	if err != nil {
+		return err
+	}
+	res.Layout = opts.layout
+	if res.Layout == "" {
+		res.Layout = raylib.DEFAULT_LAYOUT
+	}
+	res.Keymap = make(map[string]config.Keys)
+	for key, names := range raylib.KeymapNames(keys) {
+		res.Keymap[key] = names
+	}
+
+	res.Audio.Mute = opts.mute
+	res.Audio.Freq = opts.beep
+	if res.Audio.Freq == 0 {
+		res.Audio.Freq = hardware.NewSoundStd().Freq()
+	}
+
+	note("palette", opts.colors != "", romPalette, len(cfg.Palette) > 0)
+	note("scale", opts.set["scale"], false, cfg.Scale > 0)
+	note("layout", opts.set["layout"], false, cfg.Layout != "")
+	notes["keymap"] = keySource
+	note("tickrate", opts.ticks() > 0, romTicks, cfg.Ticks() > 0)
+	note("quirks", opts.quirks != "" || opts.platform != "", romQuirks, cfg.Quirks != "")
+	note("states", opts.set["states"], false, cfg.States != "")
+	note("audio.mute", opts.set["mute"], false, cfg.Audio.Mute)
+	note("audio.freq", opts.set["beep"], false, cfg.Audio.Freq > 0)
+	if res.Quirks == "" {
+		notes["quirks"] += ", the platform's"
+	}
+	if res.States == "" {
+		notes["states"] += ", next to the ROM"
+	}
+
+	if _, err := os.Stat(opts.configPath); err == nil {
+		fmt.Printf("# config file %s\n", opts.configPath)
+	} else {
+		fmt.Printf("# no config file, %s\n", opts.configPath)
+	}
+	if len(opts.args) > 1 {
+		fmt.Printf("# settings of %s\n", opts.filePath)
+	}
+	fmt.Println()
+	return res.WriteTOML(os.Stdout, notes)
+}
+
+// bench measures how fast the interpreters emulate a ROM.
+func bench(opts options) error {
+	names := []string{"step", "blocks"}
+	if opts.bench != "" {
+		names = []string{opts.bench}
+	}
+
+	for _, name := range names {
+		dspl := headless.NewDisplayHeadless()
+		c, err := newMachine(opts, dspl, headless.NewKeyboardHeadless(), headless.NewSoundHeadless())
+		if err != nil {
+			return err
+		}
+		c.SetInterpreter(chip8.INTERPRETERS[name])
+
+		start := time.Now()
+		for dspl.Frames() < opts.frames && !c.Halted() {
+			c.RunFrame()
+		}
+		elapsed := time.Since(start)
+
+		fps := float64(dspl.Frames()) / elapsed.Seconds()
+		fmt.Printf("%-6s %d frames in %v, %.0f frames/s, %.1fx real time\n", name, dspl.Frames(), elapsed.Round(time.Microsecond), fps, fps/60)
+	}
+	return nil
+}
+
+// test runs the golden image regression tests.
+func test(opts options) error {
+	o := opts.test
+	cases, err := regression.LoadCases(o.cases)
+	if err != nil {
+		return err
+	}
+	dir := filepath.Dir(o.cases)
+	if o.roms == "" {
+		o.roms = filepath.Join(dir, "roms")
+	}
+	if o.golden == "" {
+		o.golden = filepath.Join(dir, "golden")
+	}
+
+	failed := 0
+	for _, c := range cases {
+		_, err := os.Stat(filepath.Join(o.roms, c.ROM))
+		if os.IsNotExist(err) {
+			fmt.Printf("skip  %s: %s is missing\n", c.Name, c.ROM)
+			continue
+		}
+
+		err = testCase(c, o)
+		if err != nil {
+			failed++
+			fmt.Printf("FAIL  %s: %v\n", c.Name, err)
+			continue
+		}
+		fmt.Printf("ok    %s\n", c.Name)
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d of %d cases failed", failed, len(cases))
+	}
+	return nil
+}
+
+func testCase(c regression.Case, o testOptions) error {
+	dspl, err := regression.Run(c, o.roms)
+	if err != nil {
+		return err
+	}
+
+	golden := filepath.Join(o.golden, c.Name+".png")
+	if o.update {
+		return regression.WriteImage(golden, dspl.Image())
+	}
+	want, err := regression.ReadImage(golden)
+	if err != nil {
+		return err
+	}
+	if diff := regression.Diff(want, dspl.Image()); diff != "" {
+		return fmt.Errorf("%s after %d frames differs from %s\n%s", c.ROM, c.Frames, golden, diff)
+	}
+	return nil
+}
+
+// disassemble writes the listing of a ROM, next to it unless -o is set.
+func disassemble(opts options) error {
+	rom, err := os.ReadFile(opts.filePath)
+	if err != nil {
+		return err
+	}
+	platform, _ := romPlatform(opts.filePath)
+	if opts.platform != "" {
+		platform = chip8.PLATFORMS[opts.platform]
+	}
+	prog := disasm.Disassemble(rom, disasm.Options{Platform: platform})
+
+	if opts.output == "-" {
+		return prog.WriteListing(os.Stdout)
+	}
+	output := opts.output
+	if output == "" {
+		output = fmt.Sprintf("%s.dis.txt", opts.filePath)
+	}
+	f, err := os.Create(output)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	return prog.WriteListing(f)
+}
+
+// assemble writes the ROM of a source file, next to it unless -o is set.
+func assemble(opts options) error {
+	filePath, output, listing := opts.filePath, opts.output, opts.listing
+	if strings.EqualFold(filepath.Ext(filePath), ".8o") {
+		return compileOcto(filePath, output, listing)
+	}
+
+	res, err := asm.AssembleFile(filePath)
+	if err != nil {
+		return err
+	}
+
+	if output == "" {
+		output = strings.TrimSuffix(filePath, filepath.Ext(filePath)) + ".ch8"
+	}
+	if output == filePath {
+		return fmt.Errorf("the ROM would overwrite the source %s", filePath)
+	}
+	err = os.WriteFile(output, res.ROM, 0644)
+	if err != nil {
+		return err
+	}
+
+	if listing != "" {
+		f, err := os.Create(listing)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		return res.WriteListing(f)
+	}
+	return nil
+}
+
+// compileOcto compiles an Octo program, the extension of the ROM tells the platform it needs.
+func compileOcto(filePath, output, symbols string) error {
+	res, err := octo.CompileFile(filePath)
+	if err != nil {
+		return err
+	}
+
+	base := strings.TrimSuffix(filePath, filepath.Ext(filePath))
+	if output == "" {
+		output = base + [...]string{".ch8", ".sc8", ".xo8"}[res.Platform]
+	}
+	err = os.WriteFile(output, res.ROM, 0644)
+	if err != nil {
+		return err
+	}
+
+	if symbols == "" {
+		symbols = base + ".sym"
+	}
+	f, err := os.Create(symbols)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	return res.WriteSymbols(f)
+}
+
+// pack writes a ROM or an Octo program to an Octo cartridge.
+func pack(opts options) error {
+	filePath, output, quirksPreset, tickRate := opts.filePath, opts.output, opts.quirks, opts.ticks()
+	if tickRate <= 0 {
+		tickRate = chip8.IPS / 60
+	}
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return err
+	}
+
+	platform, quirks := romPlatform(filePath)
+	program := string(data)
+	if strings.EqualFold(filepath.Ext(filePath), ".8o") {
+		res, err := octo.Compile(filePath, data)
+		if err != nil {
+			return err
+		}
+		platform = chip8.Platform(res.Platform)
+		quirks = platform.DefaultQuirks()
+	} else {
+		program = octo.ROMSource(data)
+	}
+	if quirksPreset != "" {
+		q, ok := chip8.QUIRK_PRESETS[quirksPreset]
+		if !ok {
+			return fmt.Errorf("unknown quirks preset: %s", quirksPreset)
+		}
+		quirks = q
+	}
+
+	if output == "" {
+		output = strings.TrimSuffix(filePath, filepath.Ext(filePath)) + ".gif"
+	}
+	f, err := os.Create(output)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	return octo.EncodeCartridge(f, chip8.NewCartridge(program, platform, quirks, tickRate))
+}
+
+// romPlatform guesses the platform of a ROM from its extension.
+func romPlatform(filePath string) (chip8.Platform, chip8.Quirks) {
+	switch strings.ToLower(filepath.Ext(filePath)) {
+	case ".sc8":
+		return chip8.PLATFORM_SCHIP, chip8.QUIRKS_SCHIP
+	case ".xo8":
+		return chip8.PLATFORM_XOCHIP, chip8.QUIRKS_XOCHIP
+	}
+	return chip8.PLATFORM_CHIP8, chip8.QUIRKS_COSMAC_VIP
+}
+
+// openRomDB opens the ROM database with the user file, nil when it fails.
+func openRomDB() *romdb.Database {
+	path, err := romdb.UserPath()
+	if err != nil {
+		log.Println(err)
+	}
+	db, err := romdb.Open(path)
+	if err != nil {
+		log.Println(err)
+		return nil
+	}
+	return db
+}
+
+// roms lists the ROM database, shows the entry of a ROM or edits it in the user file.
+func roms(opts options) error {
+	filePath := opts.filePath
+	path, err := romdb.UserPath()
+	if err != nil {
+		return err
+	}
+	db, err := romdb.Open(path)
+	if err != nil {
+		return err
+	}
+
+	if filePath == "" {
+		for _, e := range db.Entries() {
+			p, _, _, err := chip8.RomPlatform(e.Rom)
+			platform := p.String()
+			if err != nil {
+				platform = "-"
+			}
+			user := ""
+			if e.User {
+				user = " (user)"
+			}
+			fmt.Printf("%s  %-6s %4d  %s%s\n", e.Hash, platform, e.TickRate, e.Title, user)
+		}
+		return nil
+	}
+
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return err
+	}
+	hash := romdb.Hash(data)
+	entry, ok := db.Lookup(hash)
+
+	if opts.romdb.delete {
+		if !db.Delete(hash) {
+			return fmt.Errorf("%s is not in %s", filePath, path)
+		}
+		return db.Save()
+	}
+
+	if opts.romdb.edit {
+		if !ok {
+			platform, _ := romPlatform(filePath)
+			entry.Rom = romdb.Rom{Title: filepath.Base(filePath), File: filepath.Base(filePath), Platforms: []string{ROMDB_PLATFORM_IDS[platform]}}
+		}
+		entry.Rom, err = editRom(entry.Rom, opts)
+		if err != nil {
+			return err
+		}
+		db.Set(hash, entry.Rom)
+		err = db.Save()
+		if err != nil {
+			return err
+		}
+		entry.Hash, entry.User, ok = hash, true, true
+	}
+
+	if !ok {
+		return fmt.Errorf("%s (%s) is not in the ROM database", filePath, hash)
+	}
+	out, err := json.MarshalIndent(map[string]romdb.Rom{entry.Hash: entry.Rom}, "", "    ")
+	if err != nil {
+		return err
+	}
+	fmt.Println(string(out))
+	return nil
+}
+
+// ROMDB_PLATFORM_IDS are the database IDs of the -platform names.
+var ROMDB_PLATFORM_IDS map[chip8.Platform]string = map[chip8.Platform]string{
+	chip8.PLATFORM_CHIP8:  romdb.ORIGINAL_CHIP8,
+	chip8.PLATFORM_SCHIP:  romdb.SUPERCHIP,
+	chip8.PLATFORM_XOCHIP: romdb.XOCHIP,
+}
+
+// editRom applies the roms flags to a database entry.
+func editRom(rom romdb.Rom, opts options) (romdb.Rom, error) {
+	o := opts.romdb
+	if o.title != "" {
+		rom.Title = o.title
+	}
+	if o.platform != "" {
+		id := o.platform
+		if p, ok := chip8.PLATFORMS[o.platform]; ok {
+			id = ROMDB_PLATFORM_IDS[p]
+		} else if _, ok := chip8.ROMDB_PLATFORMS[o.platform]; !ok {
+			return rom, fmt.Errorf("unknown platform: %s", o.platform)
+		}
+		rom.Platforms = []string{id}
+	}
+	if opts.tickRate > 0 {
+		rom.TickRate = opts.tickRate
+	}
+	if opts.quirks != "" {
+		q, ok := chip8.QUIRK_PRESETS[opts.quirks]
+		if !ok {
+			return rom, fmt.Errorf("unknown quirks preset: %s", opts.quirks)
+		}
+		_, id, _, err := chip8.RomPlatform(rom)
+		if err != nil {
+			return rom, err
+		}
+		rom.QuirkyPlatforms = map[string]romdb.Quirks{id: chip8.RomQuirks(q)}
+	}
+	if o.palette != "" {
+		colors := strings.Split(o.palette, ",")
+		for _, c := range colors {
+			_, err := octo.ParseColor(c)
+			if err != nil {
+				return rom, err
+			}
+		}
+		rom.Colors = &romdb.Colors{Pixels: colors}
+	}
+	if o.keys != "" {
+		rom.Keys = make(map[string]byte)
+		for _, kv := range strings.Split(o.keys, ",") {
+			i := strings.Index(kv, "=")
+			if i < 0 {
+				return rom, fmt.Errorf("bad key: %q, want name=key", kv)
+			}
+			key, err := strconv.ParseUint(kv[i+1:], 16, 4)
+			if err != nil || !knownGameKey(kv[:i]) {
+				return rom, fmt.Errorf("bad key: %q", kv)
+			}
+			rom.Keys[kv[:i]] = byte(key)
+		}
+	}
+	return rom, nil
+}
+
+func knownGameKey(name string) bool {
+	for _, k := range romdb.KEYS {
+		if k == name {
+			return true
+		}
+	}
+	return false
+}
+
+// runTUI debugs a ROM in the terminal, starting paused.
+func runTUI(opts options) error {
+	dspl := tui.NewDisplay()
+	kbrd := tui.NewKeyboard()
+
+	Cpu, err := newMachine(opts, dspl, kbrd, newSound(opts))
+	if err != nil {
+		return err
+	}
+
+	dbg := chip8.NewDebugger(Cpu)
+	dbg.Pause()
+	<-dbg.Events()
+
+	done := make(chan struct{})
+	go func() {
+		Cpu.Run()
+		close(done)
+	}()
+
+	err = tui.New(Cpu, dbg, dspl, kbrd).Run()
+	dspl.Close()
+	<-done
+	return err
+}
+
+// speedHotkeys pauses, advances single frames and fast forwards while the key is held.
+func speedHotkeys(c *chip8.Cpu, turbo int) {
+	if raylib.PausePressed() {
+		c.SetPaused(!c.Paused())
+	}
+	if raylib.FrameAdvancePressed() {
+		c.AdvanceFrame()
+	}
+	if raylib.FastForwardKeyDown() {
+		c.SetFastForward(turbo)
+	} else {
+		c.SetFastForward(1)
+	}
+}
+
+// statePrefix returns the path of the state slots without the slot, the ROM
+// or its name in the -states directory.
+func statePrefix(opts options) string {
+	if opts.states == "" {
+		return opts.filePath
+	}
+	return filepath.Join(opts.states, filepath.Base(opts.filePath))
+}
+
+// stateHotkeys saves and loads the state slots, loading is off while a movie
+// records or replays.
+func stateHotkeys(c *chip8.Cpu, prefix string, load bool) {
+	slot, save, ok := raylib.StateSlotPressed()
+	if !ok {
+		return
+	}
+
+	statePath := fmt.Sprintf("%s.state%d", prefix, slot)
+	if save {
+		err := os.MkdirAll(filepath.Dir(statePath), 0755)
+		if err == nil {
+			err = c.SaveStateFile(statePath)
+		}
+		if err != nil {
+			log.Println(err)
+			return
+		}
+		log.Printf("saved state to %s", statePath)
+	} else if load {
+		err := c.LoadStateFile(statePath)
+		if err != nil {
+			log.Println(err)
+			return
+		}
+		log.Printf("loaded state from %s", statePath)
+	}
+}
+
+// runDAP serves one debug adapter session, the ROM comes from the launch request.
+func runDAP(opts options) error {
+	var r io.Reader = os.Stdin
+	var w io.Writer = os.Stdout
+	if opts.dapListen != "" {
+		ln, err := net.Listen("tcp", opts.dapListen)
+		if err != nil {
+			return err
+		}
+		log.Printf("waiting for DAP connection on %s", ln.Addr())
+		conn, err := ln.Accept()
+		ln.Close()
+		if err != nil {
+			return err
+		}
+		defer conn.Close()
+		r, w = conn, conn
+	} else {
+		// stdout carries the protocol
+		log.SetOutput(os.Stderr)
+	}
+
+	kbrd, err := newKeyboard(opts)
+	if err != nil {
+		return err
+	}
+	dspl := newWindow(opts)
+	defer dspl.Close()
+	setColors(dspl, opts)
+
+	Cpu := chip8.NewCPU(dspl, kbrd, newSound(opts), chip8.QUIRKS_COSMAC_VIP)
+	srv := dap.NewServer(Cpu)
+	done := make(chan error, 1)
+	go func() {
+		done <- srv.Serve(r, w)
+	}()
+
+	select {
+	case <-srv.Launched():
+		Cpu.Run()
+		srv.Terminated()
+	case err := <-done:
+		return err
+	}
+	return nil
+}